@@ -0,0 +1,81 @@
+// Command breach builds the bloom filter of the breached passwords from a
+// dump of SHA-1 hashes (HASH or HASH:COUNT lines, the format of the Have I
+// Been Pwned dumps) or of plain text passwords, one per line.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/s02190058/spa/pkg/breach"
+)
+
+var (
+	in    = flag.String("in", "", "dump path")
+	out   = flag.String("out", "breached.bloom", "filter path")
+	rate  = flag.Float64("rate", 0.001, "false positive rate")
+	plain = flag.Bool("plain", false, "the dump holds plain text passwords")
+)
+
+// scan calls f with the lines of the dump.
+func scan(path string, f func(line string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		f(scanner.Text())
+	}
+
+	return scanner.Err()
+}
+
+func main() {
+	flag.Parse()
+	if *in == "" {
+		log.Fatal("no dump, set -in")
+	}
+
+	// the dump is read twice: the size of the filter depends on the number
+	// of the passwords
+	n := 0
+	if err := scan(*in, func(string) { n++ }); err != nil {
+		log.Fatalf("unable to read the dump: %v", err)
+	}
+
+	filter := breach.NewBloom(n, *rate)
+	skipped := 0
+	if err := scan(*in, func(line string) {
+		if *plain {
+			filter.Add(line)
+			return
+		}
+
+		sum, ok := breach.ParseHash(line)
+		if !ok {
+			skipped++
+			return
+		}
+		filter.AddHash(sum)
+	}); err != nil {
+		log.Fatalf("unable to read the dump: %v", err)
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("unable to create the filter: %v", err)
+	}
+	if _, err := filter.WriteTo(file); err != nil {
+		log.Fatalf("unable to write the filter: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		log.Fatalf("unable to write the filter: %v", err)
+	}
+
+	log.Printf("%d passwords written to %s, %d lines skipped", n-skipped, *out, skipped)
+}
@@ -0,0 +1,67 @@
+// Command counters checks the vote counters of posts against the votes and
+// optionally repairs them. It exits with status 1 on errors and on
+// inconsistent counters left unrepaired.
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/s02190058/spa/internal/config"
+	"github.com/s02190058/spa/internal/repo"
+	"github.com/s02190058/spa/pkg/postgres"
+)
+
+var (
+	configPath = flag.String("config", "configs/main.yml", "config path")
+	repair     = flag.Bool("repair", false, "recalculate inconsistent counters")
+)
+
+func main() {
+	flag.Parse()
+	cfg, err := config.New(*configPath)
+	if err != nil {
+		log.Fatalf("unable to read config: %v", err)
+	}
+
+	db, err := postgres.New(
+		logrus.New(),
+		cfg.Postgres.URL(),
+		cfg.Postgres.ConnAttempts,
+		cfg.Postgres.ConnTimeout,
+		cfg.Postgres.MaxOpenConns,
+	)
+	if err != nil {
+		log.Fatalf("postgres.New: %v", err)
+	}
+	defer db.Close()
+
+	drifts, err := repo.NewPostRepo(db).CheckCounters(*repair)
+	if err != nil {
+		log.Fatalf("unable to check counters: %v", err)
+	}
+
+	for _, drift := range drifts {
+		log.Printf(
+			"post %d: upvotes %d/%d, downvotes %d/%d, score %d/%d (stored/actual)",
+			drift.PostID,
+			drift.Upvotes,
+			drift.ActualUpvotes,
+			drift.Downvotes,
+			drift.ActualDownvotes,
+			drift.Score,
+			drift.ActualUpvotes-drift.ActualDownvotes,
+		)
+	}
+
+	switch {
+	case len(drifts) == 0:
+		log.Print("all counters are consistent")
+	case *repair:
+		log.Printf("%d posts repaired", len(drifts))
+	default:
+		log.Fatalf("%d posts are inconsistent, run with -repair to fix them", len(drifts))
+	}
+}
@@ -0,0 +1,255 @@
+// Command mockoidc is an OpenID Connect issuer for local development: every
+// authorization request is approved at once as the user of the login_hint
+// parameter or of -user. Codes are exchanged with PKCE (S256) only, the ID
+// tokens are signed with an RSA key generated on start.
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	golangjwt "github.com/golang-jwt/jwt"
+	"github.com/s02190058/spa/pkg/jwt"
+	"github.com/s02190058/spa/pkg/oidc"
+)
+
+var (
+	addr     = flag.String("addr", ":8081", "listen address")
+	issuer   = flag.String("issuer", "http://localhost:8081", "issuer URL")
+	clientID = flag.String("client", "spa", "client id")
+	secret   = flag.String("secret", "", "client secret, empty for a public client")
+	user     = flag.String("user", "alice", "user of the requests without login_hint")
+	verified = flag.Bool("verified", true, "the emails are verified")
+)
+
+const (
+	// codeTTL is the time to exchange a code.
+	codeTTL = time.Minute
+	// tokenTTL is the lifetime of the ID tokens.
+	tokenTTL = 5 * time.Minute
+)
+
+// grant is an authorization waiting for its code to be exchanged.
+type grant struct {
+	user        string
+	redirectURI string
+	nonce       string
+	challenge   string
+	expires     time.Time
+}
+
+type issuerServer struct {
+	key *jwt.Key
+
+	mu     sync.Mutex
+	grants map[string]*grant
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// tokenError is an error response of the token endpoint (RFC 6749 5.2).
+func tokenError(w http.ResponseWriter, code int, err, description string) {
+	writeJSON(w, code, map[string]string{
+		"error":             err,
+		"error_description": description,
+	})
+}
+
+func (s *issuerServer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                *issuer,
+		"authorization_endpoint":                *issuer + "/authorize",
+		"token_endpoint":                        *issuer + "/token",
+		"jwks_uri":                              *issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{jwt.AlgRS256},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+	})
+}
+
+func (s *issuerServer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	jwk, _ := s.key.JWK()
+	writeJSON(w, http.StatusOK, jwt.JWKS{
+		Keys: []jwt.JWK{jwk},
+	})
+}
+
+// handleAuthorize approves the request and redirects back with the code.
+func (s *issuerServer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if query.Get("client_id") != *clientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+
+	back := redirectURI.Query()
+	back.Set("state", query.Get("state"))
+	switch {
+	case query.Get("response_type") != "code":
+		back.Set("error", "unsupported_response_type")
+	case !strings.Contains(" "+query.Get("scope")+" ", " openid "):
+		back.Set("error", "invalid_scope")
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		back.Set("error", "invalid_request")
+		back.Set("error_description", "PKCE with S256 is required")
+	default:
+		name := query.Get("login_hint")
+		if name == "" {
+			name = *user
+		}
+
+		code, err := oidc.NewVerifier()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		s.mu.Lock()
+		s.grants[code] = &grant{
+			user:        name,
+			redirectURI: redirectURI.String(),
+			nonce:       query.Get("nonce"),
+			challenge:   query.Get("code_challenge"),
+			expires:     time.Now().Add(codeTTL),
+		}
+		s.mu.Unlock()
+
+		back.Set("code", code)
+		log.Printf("authorized %q", name)
+	}
+
+	redirectURI.RawQuery = back.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// clientAuthenticated checks the client credentials of the token request,
+// sent with client_secret_basic or as client_id alone by public clients.
+func clientAuthenticated(r *http.Request) bool {
+	id, password, ok := r.BasicAuth()
+	if !ok {
+		return *secret == "" && r.PostForm.Get("client_id") == *clientID
+	}
+
+	id, _ = url.QueryUnescape(id)
+	password, _ = url.QueryUnescape(password)
+	return id == *clientID && subtle.ConstantTimeCompare([]byte(password), []byte(*secret)) == 1
+}
+
+// handleToken exchanges a code for the ID token, once.
+func (s *issuerServer) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tokenError(w, http.StatusMethodNotAllowed, "invalid_request", "POST only")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if !clientAuthenticated(r) {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "bad client credentials")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		return
+	}
+
+	s.mu.Lock()
+	code := r.PostForm.Get("code")
+	g, ok := s.grants[code]
+	delete(s.grants, code)
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(g.expires):
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "unknown or expired code")
+		return
+	case g.redirectURI != r.PostForm.Get("redirect_uri"):
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri mismatch")
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code_verifier mismatch")
+		return
+	}
+
+	now := time.Now()
+	claims := golangjwt.MapClaims{
+		"iss":                *issuer,
+		"sub":                "mock-" + g.user,
+		"aud":                *clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(tokenTTL).Unix(),
+		"email":              g.user + "@example.com",
+		"email_verified":     *verified,
+		"preferred_username": g.user,
+		"name":               g.user,
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+
+	idToken, err := s.key.Sign(claims)
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	accessToken, err := oidc.NewVerifier()
+	if err != nil {
+		tokenError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+func main() {
+	flag.Parse()
+	*issuer = strings.TrimSuffix(*issuer, "/")
+
+	key, err := jwt.GenerateKey("mock-1", jwt.AlgRS256)
+	if err != nil {
+		log.Fatalf("unable to generate the key: %v", err)
+	}
+
+	s := &issuerServer{
+		key:    key,
+		grants: make(map[string]*grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("/jwks", s.handleJWKS)
+	mux.HandleFunc("/authorize", s.handleAuthorize)
+	mux.HandleFunc("/token", s.handleToken)
+
+	log.Printf("issuer %s, client %q, listening on %s", *issuer, *clientID, *addr)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
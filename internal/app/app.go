@@ -5,18 +5,33 @@ import (
 	"github.com/sirupsen/logrus"
 	"os"
 	"os/signal"
+	"regexp"
 	"syscall"
+	"time"
 
 	"github.com/s02190058/spa/internal/config"
 	"github.com/s02190058/spa/internal/repo"
 	"github.com/s02190058/spa/internal/service"
 	"github.com/s02190058/spa/internal/transport/http"
+	"github.com/s02190058/spa/pkg/breach"
 	"github.com/s02190058/spa/pkg/hasher"
 	"github.com/s02190058/spa/pkg/httpserver"
 	"github.com/s02190058/spa/pkg/jwt"
+	"github.com/s02190058/spa/pkg/mailer"
+	"github.com/s02190058/spa/pkg/oidc"
 	"github.com/s02190058/spa/pkg/postgres"
 )
 
+const (
+	// keyCheckPeriod is the period of the checks of rotated keys.
+	keyCheckPeriod = time.Minute
+	// sessionFlushPeriod is the period of the writes of the session and the
+	// API key uses.
+	sessionFlushPeriod = 30 * time.Second
+	// mailQueueSize is the number of emails waiting for the delivery.
+	mailQueueSize = 100
+)
+
 func Run(cfg *config.Config) {
 	logger := logrus.New()
 	level, err := logrus.ParseLevel(cfg.Logger.Level)
@@ -25,18 +40,9 @@ func Run(cfg *config.Config) {
 	}
 	logger.SetLevel(level)
 	logger.SetFormatter(&logrus.JSONFormatter{})
-	dbURL := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		cfg.Postgres.Username,
-		cfg.Postgres.Password,
-		cfg.Postgres.Host,
-		cfg.Postgres.Port,
-		cfg.Postgres.Database,
-		cfg.Postgres.SSLMode,
-	)
 	db, err := postgres.New(
 		logger,
-		dbURL,
+		cfg.Postgres.URL(),
 		cfg.Postgres.ConnAttempts,
 		cfg.Postgres.ConnTimeout,
 		cfg.Postgres.MaxOpenConns,
@@ -52,17 +58,115 @@ func Run(cfg *config.Config) {
 	}()
 
 	userRepo := repo.NewUserRepo(db)
-	tokenManager, err := jwt.NewTokenManager(cfg.JWT.SigningKey, cfg.JWT.TokenTTL)
+	keys, err := newKeySet(cfg.JWT)
+	if err != nil {
+		logger.Fatalf("newKeySet: %v", err)
+	}
+	if dirKeys, ok := keys.(*jwt.DirKeys); ok {
+		dirKeys.Start(keyCheckPeriod, func(err error) {
+			logger.Errorf("DirKeys.Rotate: %v", err)
+		})
+		defer dirKeys.Stop()
+	}
+	tokenManager := jwt.NewTokenManager(keys, cfg.JWT.TokenTTL)
+	passwordHasher, err := newHasher(cfg.Hasher)
 	if err != nil {
-		logger.Fatalf("jwt.NewTokenManager: %v", err)
+		logger.Fatalf("newHasher: %v", err)
+	}
+	if cfg.Account.Deletion != service.DeletionAnonymize && cfg.Account.Deletion != service.DeletionCascade {
+		logger.Fatalf("unknown account deletion: %q", cfg.Account.Deletion)
+	}
+	if cfg.Account.VerificationKey == "" {
+		logger.Fatalf("empty account verification key")
 	}
-	passwordHasher := hasher.New(cfg.Hasher.Cost)
-	userService := service.NewUserService(userRepo, tokenManager, passwordHasher)
+	breached, err := newCorpus(cfg.Password)
+	if err != nil {
+		logger.Fatalf("newCorpus: %v", err)
+	}
+	userMailer, err := newMailer(cfg.Mailer, logger)
+	if err != nil {
+		logger.Fatalf("newMailer: %v", err)
+	}
+	mailQueue := mailer.NewQueue(userMailer, mailQueueSize)
+	mailQueue.Start(func(err error) {
+		logger.Errorf("Mailer.Send: %v", err)
+	})
+	defer mailQueue.Stop()
+	providers, err := newProviders(cfg.OIDC)
+	if err != nil {
+		logger.Fatalf("newProviders: %v", err)
+	}
+	userService := service.NewUserService(
+		userRepo,
+		tokenManager,
+		passwordHasher,
+		mailQueue,
+		service.UserOptions{
+			RefreshTTL:      cfg.JWT.RefreshTTL,
+			TOTPIssuer:      cfg.TOTP.Issuer,
+			ResetURL:        cfg.Account.ResetURL,
+			VerifyURL:       cfg.Account.VerifyURL,
+			VerificationKey: cfg.Account.VerificationKey,
+			Deletion:        cfg.Account.Deletion,
+			Lockout: service.LockoutPolicy{
+				AccountFailures: cfg.Login.AccountFailures,
+				IPFailures:      cfg.Login.IPFailures,
+				Lockout:         cfg.Login.Lockout,
+				MaxLockout:      cfg.Login.MaxLockout,
+				Window:          cfg.Login.FailureWindow,
+			},
+			Password: service.PasswordPolicy{
+				MinScore: cfg.Password.MinScore,
+				Breached: breached,
+			},
+			OIDC: service.OIDCOptions{
+				Providers:   providers,
+				CallbackURL: cfg.OIDC.CallbackURL,
+			},
+		},
+	)
+	sessionTracker := service.NewSessionTracker(userRepo, sessionFlushPeriod)
+	sessionTracker.Start(func(err error) {
+		logger.Errorf("SessionTracker.Flush: %v", err)
+	})
+	defer func() {
+		if err := sessionTracker.Stop(); err != nil {
+			logger.Errorf("SessionTracker.Stop: %v", err)
+		}
+	}()
+	keyTracker := service.NewAPIKeyTracker(userRepo, sessionFlushPeriod)
+	keyTracker.Start(func(err error) {
+		logger.Errorf("APIKeyTracker.Flush: %v", err)
+	})
+	defer func() {
+		if err := keyTracker.Stop(); err != nil {
+			logger.Errorf("APIKeyTracker.Stop: %v", err)
+		}
+	}()
 
 	postRepo := repo.NewPostRepo(db)
-	postService := service.NewPostService(postRepo)
+	postService := service.NewPostService(postRepo, cfg.Feed.DefaultCommunities)
+
+	communityRepo := repo.NewCommunityRepo(db)
+	communityService := service.NewCommunityService(communityRepo)
+
+	moderationRepo := repo.NewModerationRepo(db)
+	moderationService := service.NewModerationService(moderationRepo)
 
-	router := http.NewRouter(logger, tokenManager, userService, postService, cfg.Static)
+	router := http.NewRouter(
+		logger,
+		tokenManager,
+		sessionTracker,
+		keyTracker,
+		userService,
+		postService,
+		communityService,
+		moderationService,
+		cfg.Account,
+		cfg.Login,
+		cfg.OIDC,
+		cfg.Static,
+	)
 	server := httpserver.New(logger, router, cfg.Server.Port, cfg.Server.ShutdownTimeout)
 
 	server.Start()
@@ -81,3 +185,125 @@ func Run(cfg *config.Config) {
 		logrus.Errorf("failed to shutdown a server: %v", err)
 	}
 }
+
+// newKeySet returns the keys signing the tokens.
+func newKeySet(cfg config.JWT) (jwt.KeySet, error) {
+	if cfg.Algorithm == jwt.AlgHS256 {
+		key, err := jwt.NewHMACKey(cfg.SigningKey)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.NewStaticKeys(key)
+	}
+
+	if cfg.KeysDir != "" {
+		return jwt.NewDirKeys(cfg.KeysDir, cfg.Algorithm, cfg.RotationInterval, cfg.TokenTTL)
+	}
+
+	keys := make([]*jwt.Key, 0, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		data := []byte(k.PEM)
+		if k.File != "" {
+			var err error
+			data, err = os.ReadFile(k.File)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		key, err := jwt.ParseKey(k.ID, data)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.ID, err)
+		}
+		if key.Method.Alg() != cfg.Algorithm {
+			return nil, fmt.Errorf("key %q: %w", k.ID, jwt.ErrBadAlg)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return jwt.NewStaticKeys(keys...)
+}
+
+// newHasher returns the hasher of the algorithm.
+func newHasher(cfg config.Hasher) (hasher.Hasher, error) {
+	switch cfg.Algorithm {
+	case hasher.AlgArgon2id:
+		return hasher.NewArgon2id(hasher.Argon2Params{
+			Memory:  cfg.Memory,
+			Time:    cfg.Time,
+			Threads: cfg.Threads,
+		}), nil
+	case hasher.AlgBcrypt:
+		return hasher.NewBcrypt(cfg.Cost), nil
+	default:
+		return nil, fmt.Errorf("%q: %w", cfg.Algorithm, hasher.ErrUnknownAlgorithm)
+	}
+}
+
+// newCorpus returns the breached passwords, nil if there are none.
+func newCorpus(cfg config.Password) (breach.Corpus, error) {
+	switch {
+	case cfg.BreachedFilter != "":
+		return breach.LoadBloom(cfg.BreachedFilter)
+	case cfg.BreachedDir != "":
+		return breach.NewRangeDir(cfg.BreachedDir)
+	default:
+		return nil, nil
+	}
+}
+
+// providerName is the form of the provider names, they are part of the
+// callback URLs.
+var providerName = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// newProviders returns the OpenID Connect providers by name. Their metadata
+// is discovered on the first login, a provider being down does not stop the
+// start.
+func newProviders(cfg config.OIDC) (map[string]service.IdentityProvider, error) {
+	providers := make(map[string]service.IdentityProvider, len(cfg.Providers))
+	for _, p := range cfg.Providers {
+		if !providerName.MatchString(p.Name) {
+			return nil, fmt.Errorf("bad provider name %q", p.Name)
+		}
+		if _, ok := providers[p.Name]; ok {
+			return nil, fmt.Errorf("duplicate provider %q", p.Name)
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			return nil, fmt.Errorf("provider %q: empty issuer or client id", p.Name)
+		}
+
+		providers[p.Name] = oidc.NewProvider(oidc.Config{
+			Issuer:       p.Issuer,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			Scopes:       p.Scopes,
+		})
+	}
+
+	if len(providers) > 0 && cfg.CallbackURL == "" {
+		return nil, fmt.Errorf("empty callback url")
+	}
+
+	return providers, nil
+}
+
+// newMailer returns the mailer of the driver.
+func newMailer(cfg config.Mailer, logger *logrus.Logger) (mailer.Mailer, error) {
+	switch cfg.Driver {
+	case "log":
+		return mailer.NewLogMailer(logger), nil
+	case "file":
+		return mailer.NewFileMailer(cfg.Dir, cfg.From)
+	case "smtp":
+		return mailer.NewSMTPMailer(
+			cfg.SMTP.Host,
+			cfg.SMTP.Port,
+			cfg.SMTP.Username,
+			cfg.SMTP.Password,
+			cfg.From,
+		), nil
+	default:
+		return nil, fmt.Errorf("unknown driver %q", cfg.Driver)
+	}
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
@@ -14,6 +17,13 @@ type (
 		Logger   `yaml:"logger"`
 		JWT      `yaml:"jwt"`
 		Hasher   `yaml:"hasher"`
+		Feed     `yaml:"feed"`
+		TOTP     `yaml:"totp"`
+		Account  `yaml:"account"`
+		Mailer   `yaml:"mailer"`
+		Login    `yaml:"login"`
+		Password `yaml:"password"`
+		OIDC     `yaml:"oidc"`
 	}
 
 	Server struct {
@@ -42,16 +52,149 @@ type (
 		Level string `yaml:"level" env:"LOG_LEVEL"`
 	}
 
+	// JWT configures the tokens: access tokens live for TokenTTL, sessions
+	// last for RefreshTTL since the last refresh. Tokens are signed with
+	// SigningKey if Algorithm is HS256. RS256 and EdDSA keys are either
+	// listed in Keys, the first one signs, or kept in KeysDir, where they are
+	// rotated every RotationInterval.
 	JWT struct {
-		SigningKey string        `env:"JWT_SIGNING_KEY"`
-		TokenTTL   time.Duration `yaml:"token_ttl" env:"JWT_TOKEN_TTL"`
+		SigningKey       string        `env:"JWT_SIGNING_KEY"`
+		TokenTTL         time.Duration `yaml:"token_ttl" env:"JWT_TOKEN_TTL"`
+		RefreshTTL       time.Duration `yaml:"refresh_ttl" env:"JWT_REFRESH_TTL"`
+		Algorithm        string        `yaml:"algorithm" env:"JWT_ALGORITHM" env-default:"HS256"`
+		Keys             []JWTKey      `yaml:"keys"`
+		KeysDir          string        `yaml:"keys_dir" env:"JWT_KEYS_DIR"`
+		RotationInterval time.Duration `yaml:"rotation_interval" env:"JWT_ROTATION_INTERVAL"`
 	}
 
+	// JWTKey is a PEM encoded private key given inline or in a file.
+	JWTKey struct {
+		ID   string `yaml:"id"`
+		File string `yaml:"file"`
+		PEM  string `yaml:"pem"`
+	}
+
+	// Hasher configures the password hashes: Algorithm is argon2id or bcrypt.
+	// Bcrypt hashes take Cost, argon2id hashes take Time passes over Memory
+	// KiB with Threads threads. The hashes of the other algorithm or of other
+	// parameters are replaced on login.
 	Hasher struct {
-		Cost int `env:"HASHER_COST"`
+		Algorithm string `yaml:"algorithm" env:"HASHER_ALGORITHM" env-default:"argon2id"`
+		Cost      int    `env:"HASHER_COST"`
+		Memory    uint32 `yaml:"memory" env:"HASHER_MEMORY"`
+		Time      uint32 `yaml:"time" env:"HASHER_TIME"`
+		Threads   uint8  `yaml:"threads" env:"HASHER_THREADS"`
+	}
+
+	// TOTP configures two-factor authentication, Issuer names the service in
+	// the authenticator apps.
+	TOTP struct {
+		Issuer string `yaml:"issuer" env:"TOTP_ISSUER" env-default:"SPA"`
+	}
+
+	// Account configures the account recovery, verification and deletion:
+	// the password reset token is appended to ResetURL, the email
+	// verification token, signed with VerificationKey, to VerifyURL. Users
+	// without a verified email can not contribute if RequireVerified is set.
+	// Deletion is anonymize or cascade.
+	Account struct {
+		ResetURL        string `yaml:"reset_url" env:"ACCOUNT_RESET_URL"`
+		VerifyURL       string `yaml:"verify_url" env:"ACCOUNT_VERIFY_URL"`
+		VerificationKey string `env:"ACCOUNT_VERIFICATION_KEY"`
+		RequireVerified bool   `yaml:"require_verified" env:"ACCOUNT_REQUIRE_VERIFIED"`
+		Deletion        string `yaml:"deletion" env:"ACCOUNT_DELETION" env-default:"anonymize"`
+	}
+
+	// Mailer configures the delivery of the emails sent From: Driver log
+	// writes them to the log, file to the files of Dir and smtp sends them
+	// through the SMTP server.
+	Mailer struct {
+		Driver string `yaml:"driver" env:"MAILER_DRIVER" env-default:"log"`
+		From   string `yaml:"from" env:"MAILER_FROM"`
+		Dir    string `yaml:"dir" env:"MAILER_DIR"`
+		SMTP   `yaml:"smtp"`
+	}
+
+	SMTP struct {
+		Host     string `yaml:"host" env:"SMTP_HOST"`
+		Port     string `yaml:"port" env:"SMTP_PORT"`
+		Username string `yaml:"username" env:"SMTP_USERNAME"`
+		Password string `env:"SMTP_PASSWORD"`
+	}
+
+	// Login configures the brute-force protection of the login and the
+	// registration. The logins of a username are locked out after
+	// AccountFailures failures in a row, the logins from an IP address after
+	// IPFailures; the lockout lasts Lockout and doubles with each further
+	// failure up to MaxLockout. Failures are forgotten after FailureWindow.
+	// LoginRate and RegisterRate limit the requests per minute of an IP
+	// address, zero disables the limit.
+	Login struct {
+		AccountFailures int           `yaml:"account_failures" env:"LOGIN_ACCOUNT_FAILURES" env-default:"5"`
+		IPFailures      int           `yaml:"ip_failures" env:"LOGIN_IP_FAILURES" env-default:"20"`
+		Lockout         time.Duration `yaml:"lockout" env:"LOGIN_LOCKOUT" env-default:"1m"`
+		MaxLockout      time.Duration `yaml:"max_lockout" env:"LOGIN_MAX_LOCKOUT" env-default:"1h"`
+		FailureWindow   time.Duration `yaml:"failure_window" env:"LOGIN_FAILURE_WINDOW" env-default:"24h"`
+		LoginRate       int           `yaml:"login_rate" env:"LOGIN_RATE"`
+		RegisterRate    int           `yaml:"register_rate" env:"LOGIN_REGISTER_RATE"`
+	}
+
+	// Password configures the screening of the new passwords: passwords of a
+	// strength score (0-4) below MinScore are rejected, as are the breached
+	// passwords of the bloom filter BreachedFilter or of the range files of
+	// BreachedDir.
+	Password struct {
+		MinScore       int    `yaml:"min_score" env:"PASSWORD_MIN_SCORE" env-default:"2"`
+		BreachedFilter string `yaml:"breached_filter" env:"PASSWORD_BREACHED_FILTER"`
+		BreachedDir    string `yaml:"breached_dir" env:"PASSWORD_BREACHED_DIR"`
+	}
+
+	// OIDC configures the logins with OpenID Connect providers. The providers
+	// send the users back to CallbackURL/{name}/callback, the users are then
+	// redirected to RedirectURL with the tokens or the error in the fragment.
+	OIDC struct {
+		CallbackURL string         `yaml:"callback_url" env:"OIDC_CALLBACK_URL"`
+		RedirectURL string         `yaml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+		Providers   []OIDCProvider `yaml:"providers"`
+	}
+
+	// OIDCProvider is a provider the application is registered with as
+	// ClientID. Name is a lowercase identifier, the client secret is read from
+	// OIDC_{NAME}_CLIENT_SECRET, empty for public clients.
+	OIDCProvider struct {
+		Name         string   `yaml:"name"`
+		Issuer       string   `yaml:"issuer"`
+		ClientID     string   `yaml:"client_id"`
+		ClientSecret string   `yaml:"-"`
+		Scopes       []string `yaml:"scopes"`
+	}
+
+	// Feed lists the communities of the home feed of anonymous users and
+	// users without subscriptions.
+	Feed struct {
+		DefaultCommunities []string `yaml:"default_communities" env:"FEED_DEFAULT_COMMUNITIES" env-separator:","`
 	}
 )
 
+// SecretEnv returns the environment variable of the client secret.
+func (p OIDCProvider) SecretEnv() string {
+	name := strings.ToUpper(strings.ReplaceAll(p.Name, "-", "_"))
+	return "OIDC_" + name + "_CLIENT_SECRET"
+}
+
+// URL returns the connection string of the postgres database.
+func (p Postgres) URL() string {
+	return fmt.Sprintf(
+		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		p.Username,
+		p.Password,
+		p.Host,
+		p.Port,
+		p.Database,
+		p.SSLMode,
+	)
+}
+
 func New(path string) (*Config, error) {
 	cfg := new(Config)
 	if err := cleanenv.ReadConfig(path, cfg); err != nil {
@@ -62,5 +205,10 @@ func New(path string) (*Config, error) {
 		return nil, err
 	}
 
+	for i := range cfg.OIDC.Providers {
+		provider := &cfg.OIDC.Providers[i]
+		provider.ClientSecret = os.Getenv(provider.SecretEnv())
+	}
+
 	return cfg, nil
 }
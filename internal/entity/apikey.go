@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// The scopes of the API keys: ScopeRead reads as the user, ScopePost
+// publishes posts, comments, communities and reports and manages the
+// subscriptions, ScopeVote votes and ScopeModerate acts as a moderator. The
+// account itself is never managed with a key.
+const (
+	ScopeRead     = "read"
+	ScopePost     = "post"
+	ScopeVote     = "vote"
+	ScopeModerate = "moderate"
+)
+
+// APIKey is a personal key of a user for scripts, it grants the Scopes until
+// Expires (forever if nil). Key is shown once on creation, Prefix tells the
+// keys apart afterwards.
+type APIKey struct {
+	ID       int        `json:"id"`
+	UserID   int        `json:"-"`
+	Name     string     `json:"name"`
+	Key      string     `json:"key,omitempty"`
+	Prefix   string     `json:"prefix"`
+	Scopes   []string   `json:"scopes"`
+	Created  time.Time  `json:"created"`
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	Expires  *time.Time `json:"expires,omitempty"`
+}
@@ -2,9 +2,32 @@ package entity
 
 import "time"
 
+// DeletedComment replaces the body and the author name of deleted comments.
+const DeletedComment = "[deleted]"
+
+// Comment is a node of a comment tree. Vote is the vote of the requesting
+// user (0 if there is none), MoreReplies is the number of replies cut off by
+// the depth limit of the tree. Deleted comments stay in the tree to keep
+// their replies, but their body and author are hidden.
 type Comment struct {
+	ID          int        `json:"id"`
+	ParentID    *int       `json:"parent_id,omitempty"`
+	Author      *User      `json:"author"`
+	Body        string     `json:"body"`
+	Upvotes     int        `json:"upvotes"`
+	Downvotes   int        `json:"downvotes"`
+	Score       int        `json:"score"`
+	Vote        int        `json:"vote"`
+	Created     time.Time  `json:"created"`
+	Edited      *time.Time `json:"edited,omitempty"`
+	Deleted     bool       `json:"deleted,omitempty"`
+	Replies     []*Comment `json:"replies"`
+	MoreReplies int        `json:"more_replies,omitempty"`
+}
+
+// CommentRevision is a previous version of an edited comment.
+type CommentRevision struct {
 	ID      int       `json:"id"`
-	Author  *User     `json:"author"`
 	Body    string    `json:"body"`
 	Created time.Time `json:"created"`
 }
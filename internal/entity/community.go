@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// Community is a category of posts created by a user, its owner. Posts refer
+// to their community by its name (Post.Category). Communities seeded with the
+// schema have no owner. Moderators are the names of the users moderating the
+// community, the owner is one of them unless removed.
+type Community struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Rules       []string  `json:"rules"`
+	Icon        string    `json:"icon"`
+	Owner       *User     `json:"owner,omitempty"`
+	Moderators  []string  `json:"moderators"`
+	Posts       int       `json:"posts"`
+	Subscribers int       `json:"subscribers"`
+	Created     time.Time `json:"created"`
+}
@@ -0,0 +1,11 @@
+package entity
+
+import "time"
+
+// Identity is an account of the user at an OpenID Connect provider, the user
+// logs in with it. Email is the one the provider gave on linking.
+type Identity struct {
+	Provider string    `json:"provider"`
+	Email    string    `json:"email,omitempty"`
+	Created  time.Time `json:"created"`
+}
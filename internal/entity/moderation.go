@@ -0,0 +1,44 @@
+package entity
+
+import "time"
+
+// Moderation actions recorded in the moderation log.
+const (
+	ActionRemovePost    = "remove_post"
+	ActionRemoveComment = "remove_comment"
+	ActionLock          = "lock"
+	ActionUnlock        = "unlock"
+	ActionPin           = "pin"
+	ActionUnpin         = "unpin"
+	ActionDismiss       = "dismiss"
+	ActionBan           = "ban"
+	ActionUnban         = "unban"
+)
+
+// LogEntry is a moderation action. User is the author of the content acted
+// on, PostID and CommentID are kept after the content is removed.
+type LogEntry struct {
+	ID        int       `json:"id"`
+	Action    string    `json:"action"`
+	Moderator *User     `json:"moderator,omitempty"`
+	Community string    `json:"community"`
+	User      *User     `json:"user,omitempty"`
+	PostID    int       `json:"post_id,omitempty"`
+	CommentID int       `json:"comment_id,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	Created   time.Time `json:"created"`
+}
+
+// Ban keeps the user from posting, commenting and voting in the community,
+// site-wide if Community is empty, until Expires (forever if nil). The
+// content of shadowbanned users is shown to nobody but themselves instead.
+type Ban struct {
+	ID        int        `json:"id"`
+	User      *User      `json:"user"`
+	Community string     `json:"community,omitempty"`
+	Moderator *User      `json:"moderator,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Shadow    bool       `json:"shadow"`
+	Expires   *time.Time `json:"expires,omitempty"`
+	Created   time.Time  `json:"created"`
+}
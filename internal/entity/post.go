@@ -13,38 +13,40 @@ type Post struct {
 	Votes            []*Vote    `json:"votes"`
 	Comments         []*Comment `json:"comments"`
 	Views            int        `json:"views"`
+	Upvotes          int        `json:"upvotes"`
+	Downvotes        int        `json:"downvotes"`
 	Score            int        `json:"score"`
 	UpvotePercentage int        `json:"upvotePercentage"`
 	Created          time.Time  `json:"created"`
+	Edited           *time.Time `json:"edited,omitempty"`
+	Locked           bool       `json:"locked,omitempty"`
+	Pinned           bool       `json:"pinned,omitempty"`
+	Rank             float64    `json:"-"`
 }
 
-func (p *Post) CalcAndSetScore() {
-	upvotes := 0
-	for _, vote := range p.Votes {
-		if vote.Vote == 1 {
-			upvotes++
-		}
-	}
-
-	total := len(p.Votes)
+// PostRevision is a previous version of an edited post.
+type PostRevision struct {
+	ID      int       `json:"id"`
+	Title   string    `json:"title"`
+	Text    string    `json:"text,omitempty"`
+	URL     string    `json:"url,omitempty"`
+	Created time.Time `json:"created"`
+}
 
-	score := 2*upvotes - total // equal to upvotes - downvotes
-	p.Score = score
+// PostList is a page of a listing. Pinned posts of a community are given on
+// the first page of its listing.
+type PostList struct {
+	Posts      []*Post `json:"posts"`
+	Pinned     []*Post `json:"pinned,omitempty"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 func (p *Post) CalcAndSetUpvotePercentage() {
-	upvotes := 0
-	for _, vote := range p.Votes {
-		if vote.Vote == 1 {
-			upvotes++
-		}
-	}
-
-	total := len(p.Votes)
+	total := p.Upvotes + p.Downvotes
 
 	upvotePercentage := 0
 	if total > 0 {
-		upvotePercentage = (100 * upvotes) / total
+		upvotePercentage = (100 * p.Upvotes) / total
 	}
 	p.UpvotePercentage = upvotePercentage
 }
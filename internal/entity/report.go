@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// ReportGroup gathers the open reports of a post or a comment (CommentID
+// set). Text is the text of the post or the body of the comment, Author is
+// the author of the reported content.
+type ReportGroup struct {
+	PostID        int       `json:"post_id"`
+	CommentID     int       `json:"comment_id,omitempty"`
+	Community     string    `json:"community"`
+	Title         string    `json:"title"`
+	Text          string    `json:"text"`
+	Author        *User     `json:"author"`
+	Reports       int       `json:"reports"`
+	Reasons       []string  `json:"reasons"`
+	FirstReported time.Time `json:"first_reported"`
+	LastReported  time.Time `json:"last_reported"`
+}
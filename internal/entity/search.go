@@ -0,0 +1,31 @@
+package entity
+
+import "time"
+
+const (
+	SearchPost    = "post"
+	SearchComment = "comment"
+)
+
+// SearchResult is a post or a comment matching a search query. Title is the
+// title of the post (of the commented post for comments), Snippet is an
+// excerpt of the matching text, HTML escaped, with the matches enclosed
+// in <mark> tags.
+type SearchResult struct {
+	Type      string    `json:"type"`
+	PostID    int       `json:"post_id"`
+	CommentID int       `json:"comment_id,omitempty"`
+	Title     string    `json:"title"`
+	Category  string    `json:"category"`
+	Author    *User     `json:"author"`
+	Snippet   string    `json:"snippet"`
+	Created   time.Time `json:"created"`
+	Rank      float64   `json:"rank"`
+	Key       int       `json:"-"`
+}
+
+// SearchResults is a page of search results, see PostList.
+type SearchResults struct {
+	Results    []*SearchResult `json:"results"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// Client describes the device a request comes from.
+type Client struct {
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+}
+
+// Session is a login of a user on a device. It lasts until Expires and is
+// prolonged on every refresh. LastUsed and Client are of the last request
+// made with the session, Current marks the session of the request.
+type Session struct {
+	ID     int `json:"id"`
+	UserID int `json:"-"`
+	Client
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+	Expires  time.Time `json:"expires"`
+	Current  bool      `json:"current"`
+}
+
+// Tokens are issued on login. Token is the short-lived access token,
+// RefreshToken is exchanged for new tokens once. Users with two-factor
+// authentication get a Challenge instead, exchanged for the tokens with a
+// code.
+type Tokens struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Challenge    string `json:"challenge,omitempty"`
+}
@@ -0,0 +1,8 @@
+package entity
+
+// TOTPEnrollment is shown once on enrollment: the secret is entered into an
+// authenticator app by hand or by scanning the URI as a QR code.
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
@@ -1,7 +1,22 @@
 package entity
 
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// User is carried in the access tokens. Moderates lists the communities
+// moderated by the user, moderators have the RoleModerator role unless they
+// are admins. Users with TOTPEnabled log in with a second factor. Email is
+// optional, password reset links are sent to it once it is Verified.
 type User struct {
-	ID                int    `json:"id"`
-	Username          string `json:"username"`
-	EncryptedPassword string `json:"-"`
+	ID                int      `json:"id"`
+	Username          string   `json:"username"`
+	Role              string   `json:"role,omitempty"`
+	Moderates         []string `json:"moderates,omitempty"`
+	EncryptedPassword string   `json:"-"`
+	TOTPEnabled       bool     `json:"-"`
+	Email             string   `json:"-"`
+	Verified          bool     `json:"verified,omitempty"`
 }
@@ -0,0 +1,427 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/s02190058/spa/internal/service"
+)
+
+// setPassword replaces the password of the user, revokes the sessions of
+// the user but the kept one, 0 keeps none, and deletes the API keys.
+func setPassword(tx *sql.Tx, userID int, encryptedPassword string, keepSession int) error {
+	query := "UPDATE users " +
+		"SET encrypted_password = $1 " +
+		"WHERE id = $2 AND deleted IS NULL"
+
+	res, err := tx.Exec(query, encryptedPassword, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrUserNotFound
+	}
+
+	query = "UPDATE sessions " +
+		"SET revoked = now() " +
+		"WHERE user_id = $1 AND id <> $2 AND revoked IS NULL"
+
+	if _, err := tx.Exec(query, userID, keepSession); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	// the change of the password may follow a takeover of the account
+	query = "DELETE FROM api_keys " +
+		"WHERE user_id = $1"
+
+	if _, err := tx.Exec(query, userID); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// SetPassword replaces the password of the user, the other sessions and the
+// API keys of the user are revoked.
+func (r *UserRepo) SetPassword(userID int, encryptedPassword string, keepSession int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := setPassword(tx, userID, encryptedPassword, keepSession); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// RehashPassword replaces the hash of the password of the user with a new
+// hash of the same password, unless the password has been changed meanwhile.
+func (r *UserRepo) RehashPassword(userID int, encryptedPassword, newEncryptedPassword string) error {
+	query := "UPDATE users " +
+		"SET encrypted_password = $1 " +
+		"WHERE id = $2 AND encrypted_password = $3"
+
+	if _, err := r.db.Exec(query, newEncryptedPassword, userID, encryptedPassword); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// SetEmail sets the email of the user, empty removes it. The new email is
+// not verified. An email verified by another user is not taken, the others
+// may claim it until one of them verifies it.
+func (r *UserRepo) SetEmail(userID int, email string) error {
+	if email != "" {
+		query := "SELECT EXISTS (" +
+			"SELECT FROM users " +
+			"WHERE lower(email) = lower($1) AND email_verified AND id <> $2" +
+			")"
+
+		var taken bool
+		if err := r.db.QueryRow(query, email, userID).Scan(&taken); err != nil {
+			// TODO: change default logger
+			log.Printf("DB.QueryRow: %v", err)
+			return service.ErrInternal
+		}
+		if taken {
+			return service.ErrEmailExists
+		}
+	}
+
+	query := "UPDATE users " +
+		"SET email = NULLIF($1, ''), email_verified = FALSE " +
+		"WHERE id = $2 AND deleted IS NULL"
+
+	res, err := r.db.Exec(query, email, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// releaseEmail removes the email verified by the user from the other users,
+// who have not verified it.
+func releaseEmail(tx *sql.Tx, userID int, email string) error {
+	query := "UPDATE users " +
+		"SET email = NULL " +
+		"WHERE lower(email) = lower($1) AND id <> $2 AND NOT email_verified"
+
+	if _, err := tx.Exec(query, email, userID); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// VerifyEmail marks the email of the user verified, unless it has been
+// replaced or another user has verified it first. The claims of the other
+// users on the email are dropped.
+func (r *UserRepo) VerifyEmail(userID int, email string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "UPDATE users " +
+		"SET email_verified = TRUE " +
+		"WHERE id = $1 AND email = $2 AND deleted IS NULL"
+
+	res, err := tx.Exec(query, userID, email)
+	if err != nil {
+		pqErr, ok := err.(*pq.Error)
+		if ok && pqErr.Code.Name() == "unique_violation" {
+			return service.ErrEmailExists
+		}
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrInvalidVerificationToken
+	}
+
+	if err := releaseEmail(tx, userID, email); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// AddPasswordReset stores the hash of a password reset token of the user
+// unless a token was requested after since, and reports whether it was
+// stored.
+func (r *UserRepo) AddPasswordReset(userID int, hash string, expires, since time.Time) (bool, error) {
+	query := "INSERT INTO password_resets (user_id, hash, expires) " +
+		"SELECT $1, $2, $3 " +
+		"WHERE NOT EXISTS (" +
+		"SELECT " +
+		"FROM password_resets " +
+		"WHERE user_id = $1 AND created > $4" +
+		")"
+
+	res, err := r.db.Exec(query, userID, hash, expires, since)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return false, service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return false, service.ErrInternal
+	}
+
+	return n > 0, nil
+}
+
+// GetPasswordReset returns the user of the password reset token, the token
+// must be unused and not expired.
+func (r *UserRepo) GetPasswordReset(hash string) (int, error) {
+	query := "SELECT user_id " +
+		"FROM password_resets " +
+		"WHERE hash = $1 AND used IS NULL AND expires > now()"
+
+	var userID int
+	if err := r.db.QueryRow(
+		query,
+		hash,
+	).Scan(
+		&userID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, service.ErrInvalidResetToken
+		}
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return 0, service.ErrInternal
+	}
+
+	return userID, nil
+}
+
+// ResetPassword replaces the password of the user of the reset token,
+// revokes all the sessions of the user and deletes the API keys. The token
+// can not be used again.
+func (r *UserRepo) ResetPassword(hash, encryptedPassword string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "UPDATE password_resets " +
+		"SET used = now() " +
+		"WHERE hash = $1 AND used IS NULL AND expires > now() " +
+		"RETURNING user_id"
+
+	var userID int
+	if err := tx.QueryRow(
+		query,
+		hash,
+	).Scan(
+		&userID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.ErrInvalidResetToken
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return service.ErrInternal
+	}
+
+	// the other links sent to the user stop working as well
+	query = "UPDATE password_resets " +
+		"SET used = now() " +
+		"WHERE user_id = $1 AND used IS NULL"
+
+	if _, err := tx.Exec(query, userID); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	if err := setPassword(tx, userID, encryptedPassword, 0); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// DeleteUser deletes the account of the user. The row of the user is kept
+// under the new name, without the credentials, the email, the identities,
+// the API keys and the sessions.
+// With cascade the posts of the user are deleted, the comments are removed
+// like deleted comments and the votes are withdrawn; otherwise the content
+// stays under the new name.
+func (r *UserRepo) DeleteUser(userID int, name string, cascade bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "UPDATE users " +
+		"SET name = $1, encrypted_password = '', role = 'user', email = NULL, " +
+		"totp_secret = NULL, totp_enabled = FALSE, deleted = now() " +
+		"WHERE id = $2 AND deleted IS NULL"
+
+	res, err := tx.Exec(query, name, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrUserNotFound
+	}
+
+	queries := []string{
+		"DELETE FROM sessions WHERE user_id = $1",
+		"DELETE FROM login_challenges WHERE user_id = $1",
+		"DELETE FROM recovery_codes WHERE user_id = $1",
+		"DELETE FROM password_resets WHERE user_id = $1",
+		"DELETE FROM identities WHERE user_id = $1",
+		"DELETE FROM oidc_states WHERE user_id = $1",
+		"DELETE FROM api_keys WHERE user_id = $1",
+		"DELETE FROM subscriptions WHERE user_id = $1",
+		"DELETE FROM moderators WHERE user_id = $1",
+		"UPDATE categories SET user_id = NULL WHERE user_id = $1",
+	}
+	if cascade {
+		queries = append(
+			queries,
+			"DELETE FROM posts WHERE user_id = $1",
+			"DELETE FROM comment_revisions WHERE comment_id IN (SELECT id FROM comments WHERE user_id = $1)",
+			"UPDATE comments SET body = '', deleted = COALESCE(deleted, now()) WHERE user_id = $1",
+			"UPDATE posts p "+
+				"SET upvotes = p.upvotes - (v.vote > 0)::int, downvotes = p.downvotes - (v.vote < 0)::int, "+
+				"score = p.score - v.vote "+
+				"FROM votes v "+
+				"WHERE v.post_id = p.id AND v.user_id = $1",
+			"DELETE FROM votes WHERE user_id = $1",
+			"UPDATE comments c "+
+				"SET upvotes = c.upvotes - (v.vote > 0)::int, downvotes = c.downvotes - (v.vote < 0)::int, "+
+				"score = c.score - v.vote "+
+				"FROM comment_votes v "+
+				"WHERE v.comment_id = c.id AND v.user_id = $1",
+			"DELETE FROM comment_votes WHERE user_id = $1",
+		)
+	}
+
+	for _, query := range queries {
+		if _, err := tx.Exec(query, userID); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Exec: %v", err)
+			return service.ErrInternal
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
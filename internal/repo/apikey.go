@@ -0,0 +1,173 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+// activeKey is the condition of the keys not expired, the api_keys table is
+// aliased k.
+const activeKey = "(k.expires IS NULL OR k.expires > now())"
+
+// AddAPIKey stores the key under its hash unless the user has max keys
+// already.
+func (r *UserRepo) AddAPIKey(key *entity.APIKey, hash string, max int) (*entity.APIKey, error) {
+	query := "INSERT INTO api_keys (user_id, name, prefix, hash, scopes, expires) " +
+		"SELECT $1, $2, $3, $4, $5, $6 " +
+		"WHERE (SELECT count(*) FROM api_keys WHERE user_id = $1) < $7 " +
+		"RETURNING id, created"
+
+	if err := r.db.QueryRow(
+		query,
+		key.UserID,
+		key.Name,
+		key.Prefix,
+		hash,
+		pq.Array(key.Scopes),
+		key.Expires,
+		max,
+	).Scan(
+		&key.ID,
+		&key.Created,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrTooManyKeys
+		}
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return key, nil
+}
+
+// GetAPIKeys returns the keys of the user, the expired ones too, the newest
+// first.
+func (r *UserRepo) GetAPIKeys(userID int) ([]*entity.APIKey, error) {
+	query := "SELECT k.id, k.user_id, k.name, k.prefix, k.scopes, k.created, k.last_used, k.expires " +
+		"FROM api_keys k " +
+		"WHERE k.user_id = $1 " +
+		"ORDER BY k.created DESC, k.id DESC"
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	keys := make([]*entity.APIKey, 0)
+	for rows.Next() {
+		key := new(entity.APIKey)
+		if err := rows.Scan(
+			&key.ID,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Scopes),
+			&key.Created,
+			&key.LastUsed,
+			&key.Expires,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey deletes the key of the user.
+func (r *UserRepo) DeleteAPIKey(id, userID int) error {
+	query := "DELETE FROM api_keys " +
+		"WHERE id = $1 AND user_id = $2"
+
+	res, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrKeyNotFound
+	}
+
+	return nil
+}
+
+// GetAPIKey returns the key of the hash, unless it expired.
+func (r *UserRepo) GetAPIKey(hash string) (*entity.APIKey, error) {
+	query := "SELECT k.id, k.user_id, k.scopes " +
+		"FROM api_keys k " +
+		"WHERE k.hash = $1 AND " + activeKey
+
+	key := new(entity.APIKey)
+	if err := r.db.QueryRow(
+		query,
+		hash,
+	).Scan(
+		&key.ID,
+		&key.UserID,
+		pq.Array(&key.Scopes),
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidKey
+		}
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return key, nil
+}
+
+// UpdateAPIKeyUses records the last uses of the keys with one query. Uses
+// older than the recorded ones are ignored.
+func (r *UserRepo) UpdateAPIKeyUses(uses []service.APIKeyUse) error {
+	ids := make([]int64, 0, len(uses))
+	times := make([]string, 0, len(uses))
+	for _, use := range uses {
+		ids = append(ids, int64(use.ID))
+		times = append(times, use.Time.Format(time.RFC3339Nano))
+	}
+
+	query := "UPDATE api_keys k " +
+		"SET last_used = u.last_used " +
+		"FROM unnest($1::bigint[], $2::timestamptz[]) " +
+		"AS u (id, last_used) " +
+		"WHERE k.id = u.id AND (k.last_used IS NULL OR k.last_used < u.last_used)"
+
+	if _, err := r.db.Exec(
+		query,
+		pq.Array(ids),
+		pq.Array(times),
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
@@ -0,0 +1,357 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+// activeBan is the condition of the bans (aliased b) in effect.
+const activeBan = "(b.expires IS NULL OR b.expires > now())"
+
+// visible is the condition hiding the content of shadowbanned authors from
+// everyone but the authors themselves. The content is aliased alias, category
+// is the SQL expression of its community and viewerID is the requesting user.
+func visible(alias, category string, viewerID int) string {
+	return fmt.Sprintf(
+		"(%[1]s.user_id = %[3]d OR NOT EXISTS ("+
+			"SELECT "+
+			"FROM bans b "+
+			"WHERE b.user_id = %[1]s.user_id AND b.shadow "+
+			"AND (b.category_id IS NULL OR b.category_id = %[2]s) "+
+			"AND "+activeBan+
+			"))",
+		alias,
+		category,
+		viewerID,
+	)
+}
+
+// checkBanned checks that the user is not banned from the community, neither
+// site-wide. Shadowbanned users are not told about their bans.
+func checkBanned(tx *sql.Tx, userID, categoryID int) error {
+	query := "SELECT EXISTS (" +
+		"SELECT " +
+		"FROM bans b " +
+		"WHERE b.user_id = $1 AND NOT b.shadow " +
+		"AND (b.category_id IS NULL OR b.category_id = $2) " +
+		"AND " + activeBan +
+		")"
+
+	var banned bool
+	if err := tx.QueryRow(
+		query,
+		userID,
+		categoryID,
+	).Scan(
+		&banned,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return service.ErrInternal
+	}
+
+	if banned {
+		return service.ErrBanned
+	}
+
+	return nil
+}
+
+// checkBannedFromPost checks that the user is not banned from the community
+// of the post.
+func checkBannedFromPost(tx *sql.Tx, userID, postID int) error {
+	query := "SELECT category_id " +
+		"FROM posts " +
+		"WHERE id = $1"
+
+	var categoryID int
+	if err := tx.QueryRow(
+		query,
+		postID,
+	).Scan(
+		&categoryID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.ErrPostNotFound
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return service.ErrInternal
+	}
+
+	return checkBanned(tx, userID, categoryID)
+}
+
+// logBan records the ban or the unban in the moderation log, site-wide bans
+// have no community.
+func logBan(tx *sql.Tx, action string, moderatorID int, categoryID sql.NullInt64, userID int, details string) error {
+	query := "INSERT INTO moderation_log (action, moderator_id, category_id, user_id, details) " +
+		"VALUES ($1, $2, $3, $4, $5)"
+
+	if _, err := tx.Exec(
+		query,
+		action,
+		moderatorID,
+		categoryID,
+		userID,
+		details,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+const banColumns = "b.id, u.id, u.name, COALESCE(c.name, ''), m.id, m.name, " +
+	"b.reason, b.shadow, b.expires, b.created "
+
+const banTables = "FROM bans b " +
+	"JOIN users u " +
+	"ON b.user_id = u.id " +
+	"LEFT JOIN categories c " +
+	"ON b.category_id = c.id " +
+	"LEFT JOIN users m " +
+	"ON b.moderator_id = m.id "
+
+func scanBan(row rowScanner) (*entity.Ban, error) {
+	ban := new(entity.Ban)
+	ban.User = new(entity.User)
+	var moderatorID sql.NullInt64
+	var moderatorName sql.NullString
+	if err := row.Scan(
+		&ban.ID,
+		&ban.User.ID,
+		&ban.User.Username,
+		&ban.Community,
+		&moderatorID,
+		&moderatorName,
+		&ban.Reason,
+		&ban.Shadow,
+		&ban.Expires,
+		&ban.Created,
+	); err != nil {
+		return nil, err
+	}
+
+	if moderatorID.Valid {
+		ban.Moderator = &entity.User{
+			ID:       int(moderatorID.Int64),
+			Username: moderatorName.String,
+		}
+	}
+
+	return ban, nil
+}
+
+func getBan(q queryRower, id int) (*entity.Ban, error) {
+	query := "SELECT " + banColumns +
+		banTables +
+		"WHERE b.id = $1 AND " + activeBan
+
+	ban, err := scanBan(q.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrBanNotFound
+		}
+		// TODO: change default logger
+		log.Printf("QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return ban, nil
+}
+
+// GetBan returns the ban in effect.
+func (r *ModerationRepo) GetBan(id int) (*entity.Ban, error) {
+	return getBan(r.db, id)
+}
+
+// GetBans returns the bans in effect in the community, site-wide bans if
+// community is empty.
+func (r *ModerationRepo) GetBans(community string) ([]*entity.Ban, error) {
+	query := "SELECT " + banColumns +
+		banTables +
+		"WHERE COALESCE(c.name, '') = $1 AND " + activeBan + " " +
+		"ORDER BY b.id DESC"
+
+	rows, err := r.db.Query(query, community)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	bans := make([]*entity.Ban, 0)
+	for rows.Next() {
+		ban, err := scanBan(rows)
+		if err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		bans = append(bans, ban)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return bans, nil
+}
+
+// AddBan bans the user, a previous ban of the user in the same scope is
+// replaced.
+func (r *ModerationRepo) AddBan(ban *entity.Ban) (*entity.Ban, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "SELECT id " +
+		"FROM users " +
+		"WHERE name = $1"
+
+	var userID int
+	if err := tx.QueryRow(
+		query,
+		ban.User.Username,
+	).Scan(
+		&userID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrUserNotFound
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	var categoryID sql.NullInt64
+	if ban.Community != "" {
+		query = "SELECT id " +
+			"FROM categories " +
+			"WHERE name = $1"
+
+		if err := tx.QueryRow(
+			query,
+			ban.Community,
+		).Scan(
+			&categoryID,
+		); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, service.ErrCommunityNotFound
+			}
+			// TODO: change default logger
+			log.Printf("Tx.QueryRow: %v", err)
+			return nil, service.ErrInternal
+		}
+	}
+
+	query = "INSERT INTO bans (user_id, category_id, moderator_id, reason, shadow, expires) " +
+		"VALUES ($1, $2, $3, $4, $5, $6) " +
+		"ON CONFLICT (user_id, COALESCE(category_id, 0)) DO UPDATE " +
+		"SET moderator_id = excluded.moderator_id, reason = excluded.reason, " +
+		"shadow = excluded.shadow, expires = excluded.expires, created = now() " +
+		"RETURNING id"
+
+	var id int
+	if err := tx.QueryRow(
+		query,
+		userID,
+		categoryID,
+		ban.Moderator.ID,
+		ban.Reason,
+		ban.Shadow,
+		ban.Expires,
+	).Scan(
+		&id,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	if err := logBan(tx, entity.ActionBan, ban.Moderator.ID, categoryID, userID, ban.Reason); err != nil {
+		return nil, err
+	}
+
+	ban, err = getBan(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return ban, nil
+}
+
+// DeleteBan lifts the ban on behalf of the moderator.
+func (r *ModerationRepo) DeleteBan(id, moderatorID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "DELETE FROM bans " +
+		"WHERE id = $1 " +
+		"RETURNING user_id, category_id"
+
+	var userID int
+	var categoryID sql.NullInt64
+	if err := tx.QueryRow(
+		query,
+		id,
+	).Scan(
+		&userID,
+		&categoryID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.ErrBanNotFound
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return service.ErrInternal
+	}
+
+	if err := logBan(tx, entity.ActionUnban, moderatorID, categoryID, userID, ""); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
@@ -0,0 +1,405 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/lib/pq"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+type CommunityRepo struct {
+	db *sql.DB
+}
+
+func NewCommunityRepo(db *sql.DB) *CommunityRepo {
+	return &CommunityRepo{
+		db: db,
+	}
+}
+
+const communityColumns = "c.id, c.name, c.description, c.rules, c.icon, u.id, u.name, " +
+	"(SELECT COUNT(*) FROM posts p WHERE p.category_id = c.id), " +
+	"(SELECT COUNT(*) FROM subscriptions s WHERE s.category_id = c.id), " +
+	"ARRAY(" +
+	"SELECT mu.name " +
+	"FROM moderators m " +
+	"JOIN users mu " +
+	"ON m.user_id = mu.id " +
+	"WHERE m.category_id = c.id " +
+	"ORDER BY mu.name" +
+	"), c.created "
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// queryRower is either *sql.DB or *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanCommunity(row rowScanner) (*entity.Community, error) {
+	community := new(entity.Community)
+	var ownerID sql.NullInt64
+	var ownerName sql.NullString
+	if err := row.Scan(
+		&community.ID,
+		&community.Name,
+		&community.Description,
+		pq.Array(&community.Rules),
+		&community.Icon,
+		&ownerID,
+		&ownerName,
+		&community.Posts,
+		&community.Subscribers,
+		pq.Array(&community.Moderators),
+		&community.Created,
+	); err != nil {
+		return nil, err
+	}
+
+	if community.Rules == nil {
+		community.Rules = []string{}
+	}
+	if community.Moderators == nil {
+		community.Moderators = []string{}
+	}
+	if ownerID.Valid {
+		community.Owner = &entity.User{
+			ID:       int(ownerID.Int64),
+			Username: ownerName.String,
+		}
+	}
+
+	return community, nil
+}
+
+func (r *CommunityRepo) GetAll() ([]*entity.Community, error) {
+	query := "SELECT " + communityColumns +
+		"FROM categories c " +
+		"LEFT JOIN users u " +
+		"ON c.user_id = u.id " +
+		"ORDER BY c.name"
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	communities := make([]*entity.Community, 0)
+	for rows.Next() {
+		community, err := scanCommunity(rows)
+		if err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		communities = append(communities, community)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return communities, nil
+}
+
+func getCommunity(q queryRower, name string) (*entity.Community, error) {
+	query := "SELECT " + communityColumns +
+		"FROM categories c " +
+		"LEFT JOIN users u " +
+		"ON c.user_id = u.id " +
+		"WHERE c.name = $1"
+
+	community, err := scanCommunity(q.QueryRow(query, name))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrCommunityNotFound
+		}
+		// TODO: change default logger
+		log.Printf("QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return community, nil
+}
+
+func (r *CommunityRepo) Get(name string) (*entity.Community, error) {
+	return getCommunity(r.db, name)
+}
+
+func (r *CommunityRepo) Add(community *entity.Community) (*entity.Community, error) {
+	// the owner is the first moderator
+	query := "WITH c AS (" +
+		"INSERT INTO categories (name, description, rules, icon, user_id) " +
+		"VALUES ($1, $2, $3, $4, $5) " +
+		"RETURNING id, user_id, created" +
+		"), m AS (" +
+		"INSERT INTO moderators (user_id, category_id) " +
+		"SELECT user_id, id FROM c" +
+		") " +
+		"SELECT id, created FROM c"
+
+	if err := r.db.QueryRow(
+		query,
+		community.Name,
+		community.Description,
+		pq.Array(community.Rules),
+		community.Icon,
+		community.Owner.ID,
+	).Scan(
+		&community.ID,
+		&community.Created,
+	); err != nil {
+		pqErr, ok := err.(*pq.Error)
+		if !ok {
+			// TODO: change default logger
+			log.Printf("DB.QueryRow: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		var retErr error
+		switch pqErr.Code.Name() {
+		case "unique_violation":
+			retErr = service.ErrCommunityExists
+		default:
+			// TODO: change default logger
+			log.Printf("DB.QueryRow: %v", err)
+			retErr = service.ErrInternal
+		}
+		return nil, retErr
+	}
+
+	community.Moderators = []string{community.Owner.Username}
+
+	return community, nil
+}
+
+func (r *CommunityRepo) Update(
+	name string,
+	userID int,
+	description string,
+	rules []string,
+	icon string,
+) (*entity.Community, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "SELECT user_id " +
+		"FROM categories " +
+		"WHERE name = $1 " +
+		"FOR UPDATE"
+
+	var ownerID sql.NullInt64
+	if err := tx.QueryRow(
+		query,
+		name,
+	).Scan(
+		&ownerID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrCommunityNotFound
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	if !ownerID.Valid || int(ownerID.Int64) != userID {
+		return nil, service.ErrUnauthorized
+	}
+
+	query = "UPDATE categories " +
+		"SET description = $1, rules = $2, icon = $3 " +
+		"WHERE name = $4"
+
+	if _, err := tx.Exec(
+		query,
+		description,
+		pq.Array(rules),
+		icon,
+		name,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	community, err := getCommunity(tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return community, nil
+}
+
+// GetSubscriptions returns the communities the user is subscribed to.
+func (r *CommunityRepo) GetSubscriptions(userID int) ([]*entity.Community, error) {
+	query := "SELECT " + communityColumns +
+		"FROM subscriptions s " +
+		"JOIN categories c " +
+		"ON s.category_id = c.id " +
+		"LEFT JOIN users u " +
+		"ON c.user_id = u.id " +
+		"WHERE s.user_id = $1 " +
+		"ORDER BY c.name"
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	communities := make([]*entity.Community, 0)
+	for rows.Next() {
+		community, err := scanCommunity(rows)
+		if err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		communities = append(communities, community)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return communities, nil
+}
+
+// Subscribe subscribes the user to the community, subscribing twice has no
+// effect.
+func (r *CommunityRepo) Subscribe(name string, userID int) (*entity.Community, error) {
+	query := "INSERT INTO subscriptions (user_id, category_id) " +
+		"SELECT $1, id " +
+		"FROM categories " +
+		"WHERE name = $2 " +
+		"ON CONFLICT DO NOTHING"
+
+	if _, err := r.db.Exec(query, userID, name); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return getCommunity(r.db, name)
+}
+
+func (r *CommunityRepo) Unsubscribe(name string, userID int) (*entity.Community, error) {
+	query := "DELETE FROM subscriptions " +
+		"WHERE user_id = $1 " +
+		"AND category_id = (SELECT id FROM categories WHERE name = $2)"
+
+	if _, err := r.db.Exec(query, userID, name); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return getCommunity(r.db, name)
+}
+
+// AddModerator appoints the user a moderator of the community, appointing
+// twice has no effect.
+func (r *CommunityRepo) AddModerator(name, username string) (*entity.Community, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "SELECT id " +
+		"FROM users " +
+		"WHERE name = $1"
+
+	var userID int
+	if err := tx.QueryRow(
+		query,
+		username,
+	).Scan(
+		&userID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrUserNotFound
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	query = "INSERT INTO moderators (user_id, category_id) " +
+		"SELECT $1, id " +
+		"FROM categories " +
+		"WHERE name = $2 " +
+		"ON CONFLICT DO NOTHING"
+
+	if _, err := tx.Exec(query, userID, name); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	community, err := getCommunity(tx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return community, nil
+}
+
+func (r *CommunityRepo) RemoveModerator(name, username string) (*entity.Community, error) {
+	query := "DELETE FROM moderators " +
+		"WHERE user_id = (SELECT id FROM users WHERE name = $1) " +
+		"AND category_id = (SELECT id FROM categories WHERE name = $2)"
+
+	if _, err := r.db.Exec(query, username, name); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return getCommunity(r.db, name)
+}
@@ -0,0 +1,130 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+
+	"github.com/s02190058/spa/internal/service"
+)
+
+// CounterDrift is a post whose stored vote counters differ from its votes.
+type CounterDrift struct {
+	PostID          int
+	Upvotes         int
+	Downvotes       int
+	Score           int
+	ActualUpvotes   int
+	ActualDownvotes int
+}
+
+// CheckCounters returns the posts with vote counters inconsistent with the
+// votes table. With repair set the counters are recalculated as well; vote
+// changes and other writes of posts are blocked until the repair is done.
+func (r *PostRepo) CheckCounters(repair bool) ([]*CounterDrift, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if repair {
+		// transactions changing votes are waited for and new ones are blocked,
+		// so the counters can not change between the check and the repair.
+		// The votes lock the post (SELECT ... FOR UPDATE) before the votes,
+		// the tables are locked in the same order
+		for _, lock := range []string{
+			"LOCK TABLE posts IN EXCLUSIVE MODE",
+			"LOCK TABLE votes IN SHARE MODE",
+		} {
+			if _, err := tx.Exec(lock); err != nil {
+				// TODO: change default logger
+				log.Printf("Tx.Exec: %v", err)
+				return nil, service.ErrInternal
+			}
+		}
+	}
+
+	query := "SELECT p.id, p.upvotes, p.downvotes, p.score, " +
+		"COALESCE(v.upvotes, 0), COALESCE(v.downvotes, 0) " +
+		"FROM posts p " +
+		"LEFT JOIN (" +
+		"SELECT post_id, " +
+		"COUNT(*) FILTER (WHERE vote > 0) AS upvotes, " +
+		"COUNT(*) FILTER (WHERE vote < 0) AS downvotes " +
+		"FROM votes " +
+		"GROUP BY post_id" +
+		") v " +
+		"ON v.post_id = p.id " +
+		"WHERE p.upvotes <> COALESCE(v.upvotes, 0) " +
+		"OR p.downvotes <> COALESCE(v.downvotes, 0) " +
+		"OR p.score <> COALESCE(v.upvotes, 0) - COALESCE(v.downvotes, 0) " +
+		"ORDER BY p.id"
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	drifts := make([]*CounterDrift, 0)
+	for rows.Next() {
+		drift := new(CounterDrift)
+		if err := rows.Scan(
+			&drift.PostID,
+			&drift.Upvotes,
+			&drift.Downvotes,
+			&drift.Score,
+			&drift.ActualUpvotes,
+			&drift.ActualDownvotes,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		drifts = append(drifts, drift)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	if !repair {
+		return drifts, nil
+	}
+
+	query = "UPDATE posts " +
+		"SET upvotes = $1, downvotes = $2, score = $1 - $2 " +
+		"WHERE id = $3"
+
+	for _, drift := range drifts {
+		if _, err := tx.Exec(
+			query,
+			drift.ActualUpvotes,
+			drift.ActualDownvotes,
+			drift.PostID,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Exec: %v", err)
+			return nil, service.ErrInternal
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return drifts, nil
+}
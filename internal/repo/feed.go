@@ -0,0 +1,102 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+// getCategoryIDs returns the ids of the rows selected by the query.
+func getCategoryIDs(tx *sql.Tx, query string, args ...interface{}) ([]string, error) {
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		ids = append(ids, strconv.Itoa(id))
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return ids, nil
+}
+
+// GetFeed returns a single page of posts of the communities the user is
+// subscribed to. Anonymous users (userID 0) and users without subscriptions
+// get the posts of the default communities.
+func (r *PostRepo) GetFeed(userID int, defaults []string, q service.PostQuery) ([]*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	var ids []string
+	if userID != 0 {
+		query := "SELECT category_id " +
+			"FROM subscriptions " +
+			"WHERE user_id = $1"
+
+		ids, err = getCategoryIDs(tx, query, userID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ids) == 0 {
+		query := "SELECT id " +
+			"FROM categories " +
+			"WHERE name = ANY($1)"
+
+		ids, err = getCategoryIDs(tx, query, pq.Array(defaults))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ids) == 0 {
+		return []*entity.Post{}, nil
+	}
+
+	posts, err := getWithConditions(tx, q, fmt.Sprintf("p.category_id IN (%s)", strings.Join(ids, ", ")))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return posts, nil
+}
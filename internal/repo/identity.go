@@ -0,0 +1,267 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+// The unique indexes of the identities: an account of a provider belongs to
+// one user, a user links one account of each provider.
+const (
+	identitySubjectIndex  = "identities_provider_subject_idx"
+	identityProviderIndex = "identities_user_id_provider_idx"
+)
+
+// identityError maps the violations of the unique indexes of the users and
+// the identities.
+func identityError(err error, op string) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok || pqErr.Code.Name() != "unique_violation" {
+		// TODO: change default logger
+		log.Printf("%s: %v", op, err)
+		return service.ErrInternal
+	}
+
+	switch pqErr.Constraint {
+	case identitySubjectIndex:
+		return service.ErrIdentityLinked
+	case identityProviderIndex:
+		return service.ErrProviderLinked
+	case emailIndex:
+		return service.ErrEmailExists
+	default:
+		return service.ErrAlreadyExists
+	}
+}
+
+// AddOIDCState stores a login in progress at a provider under the hash of
+// its state.
+func (r *UserRepo) AddOIDCState(hash string, state *service.OIDCState, expires time.Time) error {
+	query := "INSERT INTO oidc_states (hash, provider, verifier, nonce, user_id, binding, expires) " +
+		"VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7)"
+
+	if _, err := r.db.Exec(
+		query,
+		hash,
+		state.Provider,
+		state.Verifier,
+		state.Nonce,
+		state.UserID,
+		state.Binding,
+		expires,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// UseOIDCState deletes the login of the state hash and returns it, unless it
+// expired. The expired logins are deleted as well.
+func (r *UserRepo) UseOIDCState(hash string) (*service.OIDCState, error) {
+	query := "DELETE FROM oidc_states " +
+		"WHERE hash = $1 " +
+		"RETURNING provider, verifier, nonce, COALESCE(user_id, 0), binding, expires > now()"
+
+	state := new(service.OIDCState)
+	var valid bool
+	if err := r.db.QueryRow(
+		query,
+		hash,
+	).Scan(
+		&state.Provider,
+		&state.Verifier,
+		&state.Nonce,
+		&state.UserID,
+		&state.Binding,
+		&valid,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidState
+		}
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	query = "DELETE FROM oidc_states " +
+		"WHERE expires < now()"
+
+	if _, err := r.db.Exec(query); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	if !valid {
+		return nil, service.ErrInvalidState
+	}
+
+	return state, nil
+}
+
+// GetByIdentity returns the user the account of the provider is linked to.
+func (r *UserRepo) GetByIdentity(provider, subject string) (*entity.User, error) {
+	return r.get(
+		"u.id = (SELECT i.user_id FROM identities i WHERE i.provider = $1 AND i.subject = $2)",
+		provider,
+		subject,
+	)
+}
+
+// AddIdentity links the account of the provider to the user. Linking the
+// same account again updates its email.
+func (r *UserRepo) AddIdentity(userID int, provider, subject, email string) error {
+	query := "INSERT INTO identities (user_id, provider, subject, email) " +
+		"VALUES ($1, $2, $3, NULLIF($4, '')) " +
+		"ON CONFLICT (provider, subject) DO UPDATE " +
+		"SET email = EXCLUDED.email " +
+		"WHERE identities.user_id = EXCLUDED.user_id " +
+		"RETURNING id"
+
+	var id int
+	if err := r.db.QueryRow(
+		query,
+		userID,
+		provider,
+		subject,
+		email,
+	).Scan(
+		&id,
+	); err != nil {
+		// the conflicting identity belongs to another user
+		if errors.Is(err, sql.ErrNoRows) {
+			return service.ErrIdentityLinked
+		}
+		return identityError(err, "DB.QueryRow")
+	}
+
+	return nil
+}
+
+// AddUserWithIdentity registers the user along with the account of the
+// provider the user logged in with. The email of the user is taken as
+// verified, the unverified claims of the others on it are dropped.
+func (r *UserRepo) AddUserWithIdentity(user *entity.User, provider, subject string) (*entity.User, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "INSERT INTO users (name, encrypted_password, email, email_verified) " +
+		"VALUES ($1, $2, NULLIF($3, ''), $3 <> '') " +
+		"RETURNING id"
+
+	if err := tx.QueryRow(
+		query,
+		user.Username,
+		user.EncryptedPassword,
+		user.Email,
+	).Scan(
+		&user.ID,
+	); err != nil {
+		return nil, identityError(err, "Tx.QueryRow")
+	}
+	user.Verified = user.Email != ""
+
+	query = "INSERT INTO identities (user_id, provider, subject, email) " +
+		"VALUES ($1, $2, $3, NULLIF($4, ''))"
+
+	if _, err := tx.Exec(query, user.ID, provider, subject, user.Email); err != nil {
+		return nil, identityError(err, "Tx.Exec")
+	}
+
+	if user.Verified {
+		if err := releaseEmail(tx, user.ID, user.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return user, nil
+}
+
+// GetIdentities returns the identities linked to the user.
+func (r *UserRepo) GetIdentities(userID int) ([]*entity.Identity, error) {
+	query := "SELECT provider, COALESCE(email, ''), created " +
+		"FROM identities " +
+		"WHERE user_id = $1 " +
+		"ORDER BY provider"
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	identities := make([]*entity.Identity, 0)
+	for rows.Next() {
+		identity := new(entity.Identity)
+		if err := rows.Scan(
+			&identity.Provider,
+			&identity.Email,
+			&identity.Created,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		identities = append(identities, identity)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return identities, nil
+}
+
+// DeleteIdentity unlinks the account of the provider from the user.
+func (r *UserRepo) DeleteIdentity(userID int, provider string) error {
+	query := "DELETE FROM identities " +
+		"WHERE user_id = $1 AND provider = $2"
+
+	res, err := r.db.Exec(query, userID, provider)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrIdentityNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/s02190058/spa/internal/service"
+)
+
+// GetLockout returns the time until which the logins of the keys are locked
+// out, zero if none of them is.
+func (r *UserRepo) GetLockout(keys []string) (time.Time, error) {
+	query := "SELECT COALESCE(max(locked_until), 'epoch') " +
+		"FROM login_failures " +
+		"WHERE key = ANY($1)"
+
+	var until time.Time
+	if err := r.db.QueryRow(
+		query,
+		pq.Array(keys),
+	).Scan(
+		&until,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return time.Time{}, service.ErrInternal
+	}
+
+	return until, nil
+}
+
+// AddLoginFailure counts a failed login of the key and returns the number
+// of failures in a row. Failures before since are forgotten.
+func (r *UserRepo) AddLoginFailure(key string, since time.Time) (int, error) {
+	query := "INSERT INTO login_failures (key) " +
+		"VALUES ($1) " +
+		"ON CONFLICT (key) DO UPDATE " +
+		"SET failures = CASE WHEN login_failures.last_failure < $2 THEN 1 " +
+		"ELSE login_failures.failures + 1 END, " +
+		"last_failure = now() " +
+		"RETURNING failures"
+
+	var failures int
+	if err := r.db.QueryRow(
+		query,
+		key,
+		since,
+	).Scan(
+		&failures,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return 0, service.ErrInternal
+	}
+
+	return failures, nil
+}
+
+// LockLogin locks the logins of the key out until the time.
+func (r *UserRepo) LockLogin(key string, until time.Time) error {
+	query := "UPDATE login_failures " +
+		"SET locked_until = $1 " +
+		"WHERE key = $2"
+
+	if _, err := r.db.Exec(query, until, key); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// ClearLoginFailures forgets the failures of the key along with the failures
+// before since that no longer lock anything out.
+func (r *UserRepo) ClearLoginFailures(key string, since time.Time) error {
+	query := "DELETE FROM login_failures " +
+		"WHERE key = $1 OR last_failure < $2 AND (locked_until IS NULL OR locked_until < now())"
+
+	if _, err := r.db.Exec(query, key, since); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
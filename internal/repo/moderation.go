@@ -0,0 +1,279 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+// maxPinned is the number of pinned posts shown on top of a community
+// listing.
+const maxPinned = 10
+
+// checkUnlocked checks that the post is open for comments and returns its
+// community. The post row is shared locked, so that it can not be locked
+// until the end of the transaction.
+func checkUnlocked(tx *sql.Tx, id int) (int, error) {
+	query := "SELECT locked, category_id " +
+		"FROM posts " +
+		"WHERE id = $1 " +
+		"FOR SHARE"
+
+	var locked bool
+	var categoryID int
+	if err := tx.QueryRow(
+		query,
+		id,
+	).Scan(
+		&locked,
+		&categoryID,
+	); err != nil {
+		var retErr error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			retErr = service.ErrPostNotFound
+		default:
+			// TODO: change default logger
+			log.Printf("Tx.QueryRow: %v", err)
+			retErr = service.ErrInternal
+		}
+		return 0, retErr
+	}
+
+	if locked {
+		return 0, service.ErrPostLocked
+	}
+
+	return categoryID, nil
+}
+
+// logAction records the moderation action on the post, or on its comment
+// unless commentID is 0, in the moderation log. It must be called before the
+// post is deleted.
+func logAction(tx *sql.Tx, action string, moderatorID, postID, commentID int, details string) error {
+	query := "INSERT INTO moderation_log (action, moderator_id, category_id, user_id, post_id, comment_id, details) " +
+		"SELECT $1, $2, p.category_id, COALESCE(c.user_id, p.user_id), p.id, c.id, $3 " +
+		"FROM posts p " +
+		"LEFT JOIN comments c " +
+		"ON c.id = $4 AND c.post_id = p.id " +
+		"WHERE p.id = $5"
+
+	if _, err := tx.Exec(
+		query,
+		action,
+		moderatorID,
+		details,
+		commentID,
+		postID,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// getOwner returns the author of the post, or of its comment unless
+// commentID is 0, and the community of the post. Deleted comments are not
+// found.
+func getOwner(q queryRower, postID, commentID int) (int, string, error) {
+	if commentID == 0 {
+		query := "SELECT p.user_id, c.name " +
+			"FROM posts p " +
+			"JOIN categories c " +
+			"ON p.category_id = c.id " +
+			"WHERE p.id = $1"
+
+		var userID int
+		var category string
+		if err := q.QueryRow(
+			query,
+			postID,
+		).Scan(
+			&userID,
+			&category,
+		); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, "", service.ErrPostNotFound
+			}
+			// TODO: change default logger
+			log.Printf("QueryRow: %v", err)
+			return 0, "", service.ErrInternal
+		}
+
+		return userID, category, nil
+	}
+
+	query := "SELECT cm.user_id, c.name " +
+		"FROM comments cm " +
+		"JOIN posts p " +
+		"ON cm.post_id = p.id " +
+		"JOIN categories c " +
+		"ON p.category_id = c.id " +
+		"WHERE cm.id = $1 AND cm.post_id = $2 AND cm.deleted IS NULL"
+
+	var userID int
+	var category string
+	if err := q.QueryRow(
+		query,
+		commentID,
+		postID,
+	).Scan(
+		&userID,
+		&category,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", service.ErrCommentNotFound
+		}
+		// TODO: change default logger
+		log.Printf("QueryRow: %v", err)
+		return 0, "", service.ErrInternal
+	}
+
+	return userID, category, nil
+}
+
+// GetPostOwner returns the author and the community of the post.
+func (r *PostRepo) GetPostOwner(postID int) (int, string, error) {
+	return getOwner(r.db, postID, 0)
+}
+
+// GetCommentOwner returns the author of the comment and the community of its
+// post. Deleted comments are not found.
+func (r *PostRepo) GetCommentOwner(postID, commentID int) (int, string, error) {
+	return getOwner(r.db, postID, commentID)
+}
+
+// setFlag sets the boolean column of the post on behalf of the moderator
+// (userID) and returns the post seen by the moderator. The change is
+// recorded as the action.
+func (r *PostRepo) setFlag(postID, userID int, column string, value bool, action string) (*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := fmt.Sprintf("UPDATE posts SET %s = $1 WHERE id = $2", column)
+
+	res, err := tx.Exec(query, value, postID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return nil, service.ErrInternal
+	}
+	if n == 0 {
+		return nil, service.ErrPostNotFound
+	}
+
+	if err := logAction(tx, action, userID, postID, 0, ""); err != nil {
+		return nil, err
+	}
+
+	post, err := get(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return post, nil
+}
+
+// SetLocked locks the post for new comments or unlocks it.
+func (r *PostRepo) SetLocked(postID, userID int, locked bool) (*entity.Post, error) {
+	action := entity.ActionLock
+	if !locked {
+		action = entity.ActionUnlock
+	}
+	return r.setFlag(postID, userID, "locked", locked, action)
+}
+
+// SetPinned pins the post to the top of its community listing or unpins it.
+func (r *PostRepo) SetPinned(postID, userID int, pinned bool) (*entity.Post, error) {
+	action := entity.ActionPin
+	if !pinned {
+		action = entity.ActionUnpin
+	}
+	return r.setFlag(postID, userID, "pinned", pinned, action)
+}
+
+// GetPinned returns the pinned posts of the community, the newest first.
+func (r *PostRepo) GetPinned(category string, userID int) ([]*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "SELECT id " +
+		"FROM categories " +
+		"WHERE name = $1"
+
+	var categoryID int
+	if err := tx.QueryRow(
+		query,
+		category,
+	).Scan(
+		&categoryID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrInvalidCategory
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	posts, err := getWithConditions(
+		tx,
+		service.PostQuery{
+			Rank:   "created",
+			Limit:  maxPinned,
+			UserID: userID,
+		},
+		fmt.Sprintf("p.category_id = %d", categoryID),
+		"p.pinned",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return posts, nil
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/lib/pq"
+
 	"github.com/s02190058/spa/internal/entity"
 	"github.com/s02190058/spa/internal/service"
 )
@@ -20,22 +22,32 @@ func NewPostRepo(db *sql.DB) *PostRepo {
 	}
 }
 
-func getVotesByPostID(tx *sql.Tx, id int) ([]*entity.Vote, error) {
-	query := "SELECT user_id, vote " +
+// getVotesByPostIDs returns the votes of the posts grouped by post id, only
+// the votes of the user unless userID is 0.
+func getVotesByPostIDs(tx *sql.Tx, ids []int, userID int) (map[int][]*entity.Vote, error) {
+	query := "SELECT post_id, user_id, vote " +
 		"FROM votes " +
-		"WHERE post_id = $1"
+		"WHERE post_id = ANY($1)"
+
+	args := []interface{}{pq.Array(ids)}
+	if userID != 0 {
+		query += " AND user_id = $2"
+		args = append(args, userID)
+	}
 
-	rows, err := tx.Query(query, id)
+	rows, err := tx.Query(query, args...)
 	if err != nil {
 		// TODO: change default logger
 		log.Printf("Tx.Query: %v", err)
 		return nil, service.ErrInternal
 	}
 
-	votes := make([]*entity.Vote, 0)
+	votes := make(map[int][]*entity.Vote, len(ids))
 	for rows.Next() {
+		var postID int
 		vote := new(entity.Vote)
 		if err := rows.Scan(
+			&postID,
 			&vote.UserID,
 			&vote.Vote,
 		); err != nil {
@@ -44,7 +56,7 @@ func getVotesByPostID(tx *sql.Tx, id int) ([]*entity.Vote, error) {
 			return nil, service.ErrInternal
 		}
 
-		votes = append(votes, vote)
+		votes[postID] = append(votes[postID], vote)
 	}
 	if err := rows.Err(); err != nil {
 		// TODO: change default logger
@@ -55,37 +67,96 @@ func getVotesByPostID(tx *sql.Tx, id int) ([]*entity.Vote, error) {
 	return votes, nil
 }
 
-func getCommentsByPostID(tx *sql.Tx, id int) ([]*entity.Comment, error) {
-	query := "SELECT c.id, u.id, u.name, c.body, c.created " +
+// getCommentTrees returns the comment trees growing from the comments that
+// match start, grouped by post id. Replies deeper than depth levels are not
+// loaded, only counted. Only the comments visible to the user are loaded,
+// with the votes of the user.
+// Start refers to the comments table aliased c, its arguments are args, the
+// depth and the user id are passed as the next arguments.
+func getCommentTrees(tx *sql.Tx, start string, depth, userID int, args ...interface{}) (map[int][]*entity.Comment, error) {
+	depthArg := fmt.Sprintf("$%d", len(args)+1)
+	userArg := fmt.Sprintf("$%d", len(args)+2)
+	// replies to the comments hidden from the user are hidden as well
+	isVisible := visible("c", "(SELECT category_id FROM posts WHERE id = c.post_id)", userID)
+	query := "WITH RECURSIVE tree AS (" +
+		"SELECT c.id, c.post_id, c.parent_id, c.user_id, c.body, " +
+		"c.upvotes, c.downvotes, c.score, c.created, c.edited, c.deleted, 1 AS depth " +
+		"FROM comments c " +
+		"WHERE " + start + " AND " + isVisible +
+		" UNION ALL " +
+		"SELECT c.id, c.post_id, c.parent_id, c.user_id, c.body, " +
+		"c.upvotes, c.downvotes, c.score, c.created, c.edited, c.deleted, t.depth + 1 " +
 		"FROM comments c " +
+		"JOIN tree t " +
+		"ON c.parent_id = t.id " +
+		"WHERE t.depth < " + depthArg + " AND " + isVisible +
+		") " +
+		"SELECT t.post_id, t.id, t.parent_id, u.id, u.name, t.body, " +
+		"t.upvotes, t.downvotes, t.score, COALESCE(v.vote, 0), t.created, t.edited, " +
+		"t.deleted IS NOT NULL, t.depth, " +
+		"CASE WHEN t.depth = " + depthArg + " " +
+		"THEN (SELECT COUNT(*) FROM comments r WHERE r.parent_id = t.id) " +
+		"ELSE 0 END " +
+		"FROM tree t " +
 		"JOIN users u " +
-		"ON c.user_id = u.id " +
-		"WHERE c.post_id = $1"
+		"ON t.user_id = u.id " +
+		"LEFT JOIN comment_votes v " +
+		"ON v.comment_id = t.id AND v.user_id = " + userArg +
+		" ORDER BY t.depth, t.id"
 
-	rows, err := tx.Query(query, id)
+	rows, err := tx.Query(query, append(args, depth, userID)...)
 	if err != nil {
 		// TODO: change default logger
 		log.Printf("Tx.Query: %v", err)
 		return nil, service.ErrInternal
 	}
 
-	comments := make([]*entity.Comment, 0)
+	trees := make(map[int][]*entity.Comment)
+	comments := make(map[int]*entity.Comment)
 	for rows.Next() {
+		var postID, level int
 		comment := new(entity.Comment)
 		comment.Author = new(entity.User)
+		comment.Replies = []*entity.Comment{}
 		if err := rows.Scan(
+			&postID,
 			&comment.ID,
+			&comment.ParentID,
 			&comment.Author.ID,
 			&comment.Author.Username,
 			&comment.Body,
+			&comment.Upvotes,
+			&comment.Downvotes,
+			&comment.Score,
+			&comment.Vote,
 			&comment.Created,
+			&comment.Edited,
+			&comment.Deleted,
+			&level,
+			&comment.MoreReplies,
 		); err != nil {
 			// TODO: change default logger
 			log.Printf("Rows.Scan: %v", err)
 			return nil, service.ErrInternal
 		}
 
-		comments = append(comments, comment)
+		// the contents of deleted comments are kept for moderation only
+		if comment.Deleted {
+			comment.Body = entity.DeletedComment
+			comment.Author = &entity.User{
+				Username: entity.DeletedComment,
+			}
+			comment.Edited = nil
+		}
+
+		comments[comment.ID] = comment
+		// parents precede their replies as the rows are ordered by depth
+		if level == 1 {
+			trees[postID] = append(trees[postID], comment)
+		} else {
+			parent := comments[*comment.ParentID]
+			parent.Replies = append(parent.Replies, comment)
+		}
 	}
 	if err := rows.Err(); err != nil {
 		// TODO: change default logger
@@ -93,12 +164,112 @@ func getCommentsByPostID(tx *sql.Tx, id int) ([]*entity.Comment, error) {
 		return nil, service.ErrInternal
 	}
 
-	return comments, nil
+	return trees, nil
 }
 
-func getWithConditions(tx *sql.Tx, conditions ...string) ([]*entity.Post, error) {
-	query := "SELECT p.id, t.name, c.name, p.title, p.text, p.url, u.id, u.name, p.views, p.created " +
-		"FROM posts p " +
+// fillPosts loads the comment trees of the posts with a constant number of
+// queries regardless of the number of posts. Votes of the posts are loaded by
+// the callers.
+func fillPosts(tx *sql.Tx, posts []*entity.Post, userID int) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID
+	}
+
+	comments, err := getCommentTrees(
+		tx,
+		"c.post_id = ANY($1) AND c.parent_id IS NULL",
+		service.CommentDepth,
+		userID,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, post := range posts {
+		post.CalcAndSetUpvotePercentage()
+
+		post.Comments = comments[post.ID]
+		if post.Comments == nil {
+			post.Comments = []*entity.Comment{}
+		}
+	}
+
+	return nil
+}
+
+// fillUserVotes loads the votes of the user on the posts of a listing, the
+// votes of the others are left out: listings carry the vote counters. The
+// posts of anonymous users get no votes.
+func fillUserVotes(tx *sql.Tx, posts []*entity.Post, userID int) error {
+	var votes map[int][]*entity.Vote
+	if userID != 0 && len(posts) > 0 {
+		ids := make([]int, len(posts))
+		for i, post := range posts {
+			ids[i] = post.ID
+		}
+
+		var err error
+		votes, err = getVotesByPostIDs(tx, ids, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, post := range posts {
+		post.Votes = votes[post.ID]
+		if post.Votes == nil {
+			post.Votes = []*entity.Vote{}
+		}
+	}
+
+	return nil
+}
+
+// getWithConditions returns a single page of posts matching the conditions
+// and visible to the user of the query. The conditions refer to the posts
+// table aliased p.
+func getWithConditions(tx *sql.Tx, q service.PostQuery, conditions ...string) ([]*entity.Post, error) {
+	conditions = append(conditions, visible("p", "p.category_id", q.UserID))
+
+	args := []interface{}{q.Now.Unix()}
+	if !q.Since.IsZero() {
+		args = append(args, q.Since)
+		conditions = append(conditions, fmt.Sprintf("p.created >= $%d", len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE "
+		for i, condition := range conditions {
+			if i > 0 {
+				where += " AND "
+			}
+			where += condition
+		}
+	}
+
+	// the rank is calculated over a derived table, so that the rank expression
+	// can only refer to the columns exposed there (see service.Ranker)
+	query := "SELECT p.id, t.name, c.name, p.title, p.text, p.url, u.id, u.name, " +
+		"p.views, p.upvotes, p.downvotes, p.score, p.created, p.edited, p.locked, p.pinned, r.rank " +
+		"FROM (" +
+		"SELECT id, (" + q.Rank + ")::float8 AS rank " +
+		"FROM (" +
+		"SELECT p.id, p.score, p.upvotes, p.downvotes, " +
+		"extract(epoch FROM p.created)::float8 AS created, " +
+		"$1::float8 AS now " +
+		"FROM posts p" +
+		where +
+		") s" +
+		") r " +
+		"JOIN posts p " +
+		"ON r.id = p.id " +
 		"JOIN types t " +
 		"ON p.type_id = t.id " +
 		"JOIN categories c " +
@@ -106,17 +277,13 @@ func getWithConditions(tx *sql.Tx, conditions ...string) ([]*entity.Post, error)
 		"JOIN users u " +
 		"ON p.user_id = u.id"
 
-	if len(conditions) > 0 {
-		query += " WHERE "
-		for i, condition := range conditions {
-			if i > 0 {
-				query += " AND "
-			}
-			query += condition
-		}
+	if q.After != nil {
+		args = append(args, q.After.Rank, q.After.ID)
+		query += fmt.Sprintf(" WHERE (r.rank, r.id) < ($%d, $%d)", len(args)-1, len(args))
 	}
+	query += fmt.Sprintf(" ORDER BY r.rank DESC, r.id DESC LIMIT %d", q.Limit)
 
-	rows, err := tx.Query(query)
+	rows, err := tx.Query(query, args...)
 	if err != nil {
 		// TODO: change default logger
 		log.Printf("Tx.Query: %v", err)
@@ -137,7 +304,14 @@ func getWithConditions(tx *sql.Tx, conditions ...string) ([]*entity.Post, error)
 			&post.Author.ID,
 			&post.Author.Username,
 			&post.Views,
+			&post.Upvotes,
+			&post.Downvotes,
+			&post.Score,
 			&post.Created,
+			&post.Edited,
+			&post.Locked,
+			&post.Pinned,
+			&post.Rank,
 		); err != nil {
 			// TODO: change default logger
 			log.Printf("Rows.Scan: %v", err)
@@ -146,27 +320,24 @@ func getWithConditions(tx *sql.Tx, conditions ...string) ([]*entity.Post, error)
 
 		posts = append(posts, post)
 	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
 
-	for _, post := range posts {
-		votes, err := getVotesByPostID(tx, post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Votes = votes
-		post.CalcAndSetScore()
-		post.CalcAndSetUpvotePercentage()
+	if err := fillUserVotes(tx, posts, q.UserID); err != nil {
+		return nil, err
+	}
 
-		comments, err := getCommentsByPostID(tx, post.ID)
-		if err != nil {
-			return nil, err
-		}
-		post.Comments = comments
+	if err := fillPosts(tx, posts, q.UserID); err != nil {
+		return nil, err
 	}
 
 	return posts, nil
 }
 
-func (r *PostRepo) GetAll() ([]*entity.Post, error) {
+func (r *PostRepo) GetAll(q service.PostQuery) ([]*entity.Post, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		// TODO: change default logger
@@ -180,7 +351,7 @@ func (r *PostRepo) GetAll() ([]*entity.Post, error) {
 		}
 	}()
 
-	posts, err := getWithConditions(tx)
+	posts, err := getWithConditions(tx, q)
 	if err != nil {
 		return nil, err
 	}
@@ -194,8 +365,10 @@ func (r *PostRepo) GetAll() ([]*entity.Post, error) {
 	return posts, nil
 }
 
-func get(tx *sql.Tx, id int) (*entity.Post, error) {
-	query := "SELECT p.id, t.name, c.name, p.title, p.text, p.url, u.id, u.name, p.views, p.created " +
+// get returns the post requested by the user, see fillPosts.
+func get(tx *sql.Tx, id, userID int) (*entity.Post, error) {
+	query := "SELECT p.id, t.name, c.name, p.title, p.text, p.url, u.id, u.name, " +
+		"p.views, p.upvotes, p.downvotes, p.score, p.created, p.edited, p.locked, p.pinned " +
 		"FROM posts p " +
 		"JOIN types t " +
 		"ON p.type_id = t.id " +
@@ -203,7 +376,7 @@ func get(tx *sql.Tx, id int) (*entity.Post, error) {
 		"ON p.category_id = c.id " +
 		"JOIN users u " +
 		"ON p.user_id = u.id " +
-		"WHERE p.id = $1"
+		"WHERE p.id = $1 AND " + visible("p", "p.category_id", userID)
 
 	post := new(entity.Post)
 	post.Author = new(entity.User)
@@ -220,31 +393,39 @@ func get(tx *sql.Tx, id int) (*entity.Post, error) {
 		&post.Author.ID,
 		&post.Author.Username,
 		&post.Views,
+		&post.Upvotes,
+		&post.Downvotes,
+		&post.Score,
 		&post.Created,
+		&post.Edited,
+		&post.Locked,
+		&post.Pinned,
 	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrPostNotFound
+		}
 		// TODO: change default logger
 		log.Printf("Tx.QueryRow: %v", err)
 		return nil, service.ErrInternal
 	}
 
-	votes, err := getVotesByPostID(tx, id)
+	votes, err := getVotesByPostIDs(tx, []int{id}, 0)
 	if err != nil {
 		return nil, err
 	}
-	post.Votes = votes
-	post.CalcAndSetScore()
-	post.CalcAndSetUpvotePercentage()
+	post.Votes = votes[id]
+	if post.Votes == nil {
+		post.Votes = []*entity.Vote{}
+	}
 
-	comments, err := getCommentsByPostID(tx, id)
-	if err != nil {
+	if err := fillPosts(tx, []*entity.Post{post}, userID); err != nil {
 		return nil, err
 	}
-	post.Comments = comments
 
 	return post, nil
 }
 
-func (r *PostRepo) Get(id int) (*entity.Post, error) {
+func (r *PostRepo) Get(id, userID int) (*entity.Post, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		// TODO: change default logger
@@ -278,7 +459,7 @@ func (r *PostRepo) Get(id int) (*entity.Post, error) {
 		return nil, service.ErrPostNotFound
 	}
 
-	post, err := get(tx, id)
+	post, err := get(tx, id, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -292,7 +473,7 @@ func (r *PostRepo) Get(id int) (*entity.Post, error) {
 	return post, nil
 }
 
-func (r *PostRepo) GetByCategory(category string) ([]*entity.Post, error) {
+func (r *PostRepo) GetByCategory(category string, q service.PostQuery) ([]*entity.Post, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		// TODO: change default logger
@@ -325,7 +506,8 @@ func (r *PostRepo) GetByCategory(category string) ([]*entity.Post, error) {
 		return nil, service.ErrInternal
 	}
 
-	posts, err := getWithConditions(tx, fmt.Sprintf("c.id = %d", categoryID))
+	// pinned posts are listed apart, on top of the first page
+	posts, err := getWithConditions(tx, q, fmt.Sprintf("p.category_id = %d", categoryID), "NOT p.pinned")
 	if err != nil {
 		return nil, err
 	}
@@ -339,7 +521,7 @@ func (r *PostRepo) GetByCategory(category string) ([]*entity.Post, error) {
 	return posts, nil
 }
 
-func (r *PostRepo) GetByUsername(username string) ([]*entity.Post, error) {
+func (r *PostRepo) GetByUsername(username string, q service.PostQuery) ([]*entity.Post, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		// TODO: change default logger
@@ -372,7 +554,7 @@ func (r *PostRepo) GetByUsername(username string) ([]*entity.Post, error) {
 		return nil, service.ErrInternal
 	}
 
-	posts, err := getWithConditions(tx, fmt.Sprintf("u.id = %d", userID))
+	posts, err := getWithConditions(tx, q, fmt.Sprintf("p.user_id = %d", userID))
 	if err != nil {
 		return nil, err
 	}
@@ -438,6 +620,10 @@ func (r *PostRepo) Add(post *entity.Post) (*entity.Post, error) {
 		return nil, service.ErrInternal
 	}
 
+	if err := checkBanned(tx, post.Author.ID, categoryID); err != nil {
+		return nil, err
+	}
+
 	query = "INSERT INTO posts (type_id, category_id, title, text, url, user_id) " +
 		"VALUES ($1, $2, $3, $4, $5, $6) " +
 		"RETURNING id, created"
@@ -473,6 +659,10 @@ func (r *PostRepo) Add(post *entity.Post) (*entity.Post, error) {
 		return nil, service.ErrInternal
 	}
 
+	if err := updateCounters(tx, "posts", post.ID, 0, post.Votes[0].Vote); err != nil {
+		return nil, err
+	}
+
 	if err := tx.Commit(); err != nil {
 		// TODO: change default logger
 		log.Printf("Tx.Commit: %v", err)
@@ -482,32 +672,28 @@ func (r *PostRepo) Add(post *entity.Post) (*entity.Post, error) {
 	return post, nil
 }
 
-func checkPost(tx *sql.Tx, id int) error {
-
-	query := "SELECT " +
-		"FROM posts " +
-		"WHERE id = $1"
+// GetPostType returns the type of the post, it never changes.
+func (r *PostRepo) GetPostType(postID int) (string, error) {
+	query := "SELECT t.name " +
+		"FROM posts p " +
+		"JOIN types t " +
+		"ON p.type_id = t.id " +
+		"WHERE p.id = $1"
 
-	if err := tx.QueryRow(
-		query,
-		id,
-	).Scan(); err != nil {
-		var retErr error
-		switch {
-		case errors.Is(err, sql.ErrNoRows):
-			retErr = service.ErrPostNotFound
-		default:
-			// TODO: change default logger
-			log.Printf("Tx.QueryRow: %v", err)
-			retErr = service.ErrInternal
+	var typ string
+	if err := r.db.QueryRow(query, postID).Scan(&typ); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", service.ErrPostNotFound
 		}
-		return retErr
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return "", service.ErrInternal
 	}
 
-	return nil
+	return typ, nil
 }
 
-func (r *PostRepo) AddVote(postID, userID, vote int) (*entity.Post, error) {
+func (r *PostRepo) Update(postID, userID int, title, text, url string) (*entity.Post, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		// TODO: change default logger
@@ -521,18 +707,24 @@ func (r *PostRepo) AddVote(postID, userID, vote int) (*entity.Post, error) {
 		}
 	}()
 
-	if err := checkPost(tx, postID); err != nil {
+	if err := lockPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	if err := checkBannedFromPost(tx, userID, postID); err != nil {
 		return nil, err
 	}
 
-	query := "UPDATE votes " +
-		"SET vote = $1 " +
-		"WHERE post_id = $2 AND user_id = $3"
+	// the current version becomes a revision dated by its own creation time
+	query := "INSERT INTO post_revisions (post_id, title, text, url, created) " +
+		"SELECT id, title, text, url, COALESCE(edited, created) " +
+		"FROM posts " +
+		"WHERE id = $1 AND user_id = $2"
 
-	res, err := tx.Exec(query, vote, postID, userID)
+	res, err := tx.Exec(query, postID, userID)
 	if err != nil {
 		// TODO: change default logger
-		log.Printf("tx.Exec: %v", err)
+		log.Printf("Tx.Exec: %v", err)
 		return nil, service.ErrInternal
 	}
 
@@ -543,68 +735,26 @@ func (r *PostRepo) AddVote(postID, userID, vote int) (*entity.Post, error) {
 		return nil, service.ErrInternal
 	}
 	if n == 0 {
-
-		query = "INSERT INTO votes (post_id, user_id, vote) " +
-			"VALUES ($1, $2, $3)"
-
-		if _, err := tx.Exec(
-			query,
-			postID,
-			userID,
-			vote,
-		); err != nil {
-			// TODO: change default logger
-			log.Printf("tx.Exec: %v", err)
-			return nil, service.ErrInternal
-		}
-	}
-
-	post, err := get(tx, postID)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := tx.Commit(); err != nil {
-		// TODO: change default logger
-		log.Printf("Tx.Commit: %v", err)
-		return nil, service.ErrInternal
-	}
-
-	return post, nil
-}
-
-func (r *PostRepo) DeleteVote(postID, userID int) (*entity.Post, error) {
-	tx, err := r.db.Begin()
-	if err != nil {
-		// TODO: change default logger
-		log.Printf("DB.Begin: %v", err)
-		return nil, service.ErrInternal
-	}
-	defer func() {
-		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
-			// TODO: change default logger
-			log.Printf("Tx.Rollback: %v", err)
-		}
-	}()
-
-	if err := checkPost(tx, postID); err != nil {
-		return nil, err
+		return nil, service.ErrUnauthorized
 	}
 
-	query := "DELETE FROM votes " +
-		"WHERE post_id = $1 AND user_id = $2"
+	query = "UPDATE posts " +
+		"SET title = $1, text = $2, url = $3, edited = now() " +
+		"WHERE id = $4"
 
 	if _, err := tx.Exec(
 		query,
+		title,
+		text,
+		url,
 		postID,
-		userID,
 	); err != nil {
 		// TODO: change default logger
 		log.Printf("Tx.Exec: %v", err)
 		return nil, service.ErrInternal
 	}
 
-	post, err := get(tx, postID)
+	post, err := get(tx, postID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -618,7 +768,9 @@ func (r *PostRepo) DeleteVote(postID, userID int) (*entity.Post, error) {
 	return post, nil
 }
 
-func (r *PostRepo) AddComment(postID, userID int, body string) (*entity.Post, error) {
+// GetRevisions returns the revisions of the post seen by the user, the newest
+// first.
+func (r *PostRepo) GetRevisions(postID, userID int) ([]*entity.PostRevision, error) {
 	tx, err := r.db.Begin()
 	if err != nil {
 		// TODO: change default logger
@@ -632,27 +784,43 @@ func (r *PostRepo) AddComment(postID, userID int, body string) (*entity.Post, er
 		}
 	}()
 
-	if err := checkPost(tx, postID); err != nil {
+	if err := checkVisiblePost(tx, postID, userID); err != nil {
 		return nil, err
 	}
 
-	query := "INSERT INTO comments (post_id, user_id, body) " +
-		"VALUES ($1, $2, $3)"
+	query := "SELECT id, title, text, url, created " +
+		"FROM post_revisions " +
+		"WHERE post_id = $1 " +
+		"ORDER BY id DESC"
 
-	if _, err := tx.Exec(
-		query,
-		postID,
-		userID,
-		body,
-	); err != nil {
+	rows, err := tx.Query(query, postID)
+	if err != nil {
 		// TODO: change default logger
-		log.Printf("Tx.Exec: %v", err)
+		log.Printf("Tx.Query: %v", err)
 		return nil, service.ErrInternal
 	}
 
-	post, err := get(tx, postID)
-	if err != nil {
-		return nil, err
+	revisions := make([]*entity.PostRevision, 0)
+	for rows.Next() {
+		revision := new(entity.PostRevision)
+		if err := rows.Scan(
+			&revision.ID,
+			&revision.Title,
+			&revision.Text,
+			&revision.URL,
+			&revision.Created,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -661,13 +829,13 @@ func (r *PostRepo) AddComment(postID, userID int, body string) (*entity.Post, er
 		return nil, service.ErrInternal
 	}
 
-	return post, nil
+	return revisions, nil
 }
 
-func checkComment(tx *sql.Tx, id int) error {
+func checkPost(tx *sql.Tx, id int) error {
 
 	query := "SELECT " +
-		"FROM comments " +
+		"FROM posts " +
 		"WHERE id = $1"
 
 	if err := tx.QueryRow(
@@ -677,7 +845,7 @@ func checkComment(tx *sql.Tx, id int) error {
 		var retErr error
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
-			retErr = service.ErrCommentNotFound
+			retErr = service.ErrPostNotFound
 		default:
 			// TODO: change default logger
 			log.Printf("Tx.QueryRow: %v", err)
@@ -689,49 +857,549 @@ func checkComment(tx *sql.Tx, id int) error {
 	return nil
 }
 
-func (r *PostRepo) DeleteComment(postID, commentID, userID int) (*entity.Post, error) {
-	tx, err := r.db.Begin()
-	if err != nil {
-		// TODO: change default logger
-		log.Printf("DB.Begin: %v", err)
-		return nil, service.ErrInternal
-	}
-	defer func() {
-		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+// checkVisiblePost checks that the post exists and is seen by the user, the
+// posts of shadowbanned authors are seen by nobody else.
+func checkVisiblePost(tx *sql.Tx, id, userID int) error {
+	query := "SELECT " +
+		"FROM posts p " +
+		"WHERE p.id = $1 AND " + visible("p", "p.category_id", userID)
+
+	if err := tx.QueryRow(
+		query,
+		id,
+	).Scan(); err != nil {
+		var retErr error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			retErr = service.ErrPostNotFound
+		default:
 			// TODO: change default logger
-			log.Printf("Tx.Rollback: %v", err)
+			log.Printf("Tx.QueryRow: %v", err)
+			retErr = service.ErrInternal
 		}
-	}()
-
-	if err := checkPost(tx, postID); err != nil {
-		return nil, err
+		return retErr
 	}
 
-	if err := checkComment(tx, commentID); err != nil {
-		return nil, err
-	}
+	return nil
+}
 
-	query := "DELETE FROM comments " +
-		"WHERE id = $1 AND post_id = $2 AND user_id = $3"
+// lockPost locks the post row until the end of the transaction. Vote
+// changes of a post are serialized by this lock, so that the counters of the
+// post are updated consistently with the votes.
+func lockPost(tx *sql.Tx, id int) error {
+	query := "SELECT " +
+		"FROM posts " +
+		"WHERE id = $1 " +
+		"FOR UPDATE"
 
-	res, err := tx.Exec(query, commentID, postID, userID)
-	if err != nil {
-		// TODO: change default logger
-		log.Printf("Tx.Exec: %v", err)
-		return nil, service.ErrInternal
+	if err := tx.QueryRow(
+		query,
+		id,
+	).Scan(); err != nil {
+		var retErr error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			retErr = service.ErrPostNotFound
+		default:
+			// TODO: change default logger
+			log.Printf("Tx.QueryRow: %v", err)
+			retErr = service.ErrInternal
+		}
+		return retErr
 	}
 
-	n, err := res.RowsAffected()
-	if err != nil {
-		// TODO: change default logger
-		log.Printf("Result.RowsAffected: %v", err)
-		return nil, service.ErrInternal
-	}
-	if n == 0 {
+	return nil
+}
+
+// getVote returns the vote of the user for the post, 0 if the user has not voted.
+func getVote(tx *sql.Tx, postID, userID int) (int, error) {
+	query := "SELECT vote " +
+		"FROM votes " +
+		"WHERE post_id = $1 AND user_id = $2"
+
+	var vote int
+	if err := tx.QueryRow(
+		query,
+		postID,
+		userID,
+	).Scan(
+		&vote,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return 0, service.ErrInternal
+	}
+
+	return vote, nil
+}
+
+// updateCounters adjusts the vote counters of the post or comment (table
+// posts or comments) after the vote of a user changed from oldVote to newVote,
+// 0 stands for no vote.
+func updateCounters(tx *sql.Tx, table string, id, oldVote, newVote int) error {
+	upvotes, downvotes := 0, 0
+	switch {
+	case oldVote > 0:
+		upvotes--
+	case oldVote < 0:
+		downvotes--
+	}
+	switch {
+	case newVote > 0:
+		upvotes++
+	case newVote < 0:
+		downvotes++
+	}
+
+	query := "UPDATE " + table + " " +
+		"SET upvotes = upvotes + $1, downvotes = downvotes + $2, score = score + $3 " +
+		"WHERE id = $4"
+
+	if _, err := tx.Exec(
+		query,
+		upvotes,
+		downvotes,
+		newVote-oldVote,
+		id,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+func (r *PostRepo) AddVote(postID, userID, vote int) (*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := lockPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	if err := checkBannedFromPost(tx, userID, postID); err != nil {
+		return nil, err
+	}
+
+	oldVote, err := getVote(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldVote != vote {
+		query := "INSERT INTO votes (post_id, user_id, vote) " +
+			"VALUES ($1, $2, $3)"
+		if oldVote != 0 {
+			query = "UPDATE votes " +
+				"SET vote = $3 " +
+				"WHERE post_id = $1 AND user_id = $2"
+		}
+
+		if _, err := tx.Exec(
+			query,
+			postID,
+			userID,
+			vote,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("tx.Exec: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		if err := updateCounters(tx, "posts", postID, oldVote, vote); err != nil {
+			return nil, err
+		}
+	}
+
+	post, err := get(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return post, nil
+}
+
+func (r *PostRepo) DeleteVote(postID, userID int) (*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := lockPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	if err := checkBannedFromPost(tx, userID, postID); err != nil {
+		return nil, err
+	}
+
+	oldVote, err := getVote(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldVote != 0 {
+		query := "DELETE FROM votes " +
+			"WHERE post_id = $1 AND user_id = $2"
+
+		if _, err := tx.Exec(
+			query,
+			postID,
+			userID,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Exec: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		if err := updateCounters(tx, "posts", postID, oldVote, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	post, err := get(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return post, nil
+}
+
+func (r *PostRepo) AddComment(postID, userID, parentID int, body string) (*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	categoryID, err := checkUnlocked(tx, postID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBanned(tx, userID, categoryID); err != nil {
+		return nil, err
+	}
+
+	parent := sql.NullInt64{}
+	if parentID != 0 {
+		if err := checkParent(tx, postID, parentID); err != nil {
+			return nil, err
+		}
+		parent = sql.NullInt64{Int64: int64(parentID), Valid: true}
+	}
+
+	query := "INSERT INTO comments (post_id, user_id, parent_id, body) " +
+		"VALUES ($1, $2, $3, $4)"
+
+	if _, err := tx.Exec(
+		query,
+		postID,
+		userID,
+		parent,
+		body,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	post, err := get(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return post, nil
+}
+
+// checkParent checks that the comment replied to belongs to the post.
+func checkParent(tx *sql.Tx, postID, id int) error {
+	query := "SELECT " +
+		"FROM comments " +
+		"WHERE id = $1 AND post_id = $2 AND deleted IS NULL"
+
+	if err := tx.QueryRow(
+		query,
+		id,
+		postID,
+	).Scan(); err != nil {
+		var retErr error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			retErr = service.ErrParentNotFound
+		default:
+			// TODO: change default logger
+			log.Printf("Tx.QueryRow: %v", err)
+			retErr = service.ErrInternal
+		}
+		return retErr
+	}
+
+	return nil
+}
+
+// checkVisibleComment checks that the comment of the post exists and is seen
+// by the user, see checkVisiblePost.
+func checkVisibleComment(tx *sql.Tx, postID, id, userID int) error {
+	query := "SELECT " +
+		"FROM comments c " +
+		"JOIN posts p " +
+		"ON c.post_id = p.id " +
+		"WHERE c.id = $1 AND c.post_id = $2 AND c.deleted IS NULL AND " + visible("c", "p.category_id", userID)
+
+	if err := tx.QueryRow(
+		query,
+		id,
+		postID,
+	).Scan(); err != nil {
+		var retErr error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			retErr = service.ErrCommentNotFound
+		default:
+			// TODO: change default logger
+			log.Printf("Tx.QueryRow: %v", err)
+			retErr = service.ErrInternal
+		}
+		return retErr
+	}
+
+	return nil
+}
+
+func (r *PostRepo) GetComment(postID, commentID, userID, depth int) (*entity.Comment, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	trees, err := getCommentTrees(tx, "c.id = $1 AND c.post_id = $2", depth, userID, commentID, postID)
+	if err != nil {
+		return nil, err
+	}
+	if len(trees[postID]) == 0 {
+		return nil, service.ErrCommentNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return trees[postID][0], nil
+}
+
+func checkComment(tx *sql.Tx, id int) error {
+
+	query := "SELECT " +
+		"FROM comments " +
+		"WHERE id = $1 AND deleted IS NULL"
+
+	if err := tx.QueryRow(
+		query,
+		id,
+	).Scan(); err != nil {
+		var retErr error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			retErr = service.ErrCommentNotFound
+		default:
+			// TODO: change default logger
+			log.Printf("Tx.QueryRow: %v", err)
+			retErr = service.ErrInternal
+		}
+		return retErr
+	}
+
+	return nil
+}
+
+// DeleteComment deletes the comment on behalf of the user, the deletion is
+// recorded in the moderation log if the user is not the author.
+func (r *PostRepo) DeleteComment(postID, commentID, userID int, moderated bool) (*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	if err := checkComment(tx, commentID); err != nil {
+		return nil, err
+	}
+
+	// the comment is only marked as deleted to keep its replies in place
+	query := "UPDATE comments " +
+		"SET deleted = now() " +
+		"WHERE id = $1 AND post_id = $2 AND deleted IS NULL"
+
+	res, err := tx.Exec(query, commentID, postID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return nil, service.ErrInternal
+	}
+	if n == 0 {
+		return nil, service.ErrCommentNotFound
+	}
+
+	if moderated {
+		if err := logAction(tx, entity.ActionRemoveComment, userID, postID, commentID, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	post, err := get(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return post, err
+}
+
+func (r *PostRepo) UpdateComment(postID, commentID, userID int, body string) (*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	if err := lockComment(tx, postID, commentID); err != nil {
+		return nil, err
+	}
+
+	if err := checkBannedFromPost(tx, userID, postID); err != nil {
+		return nil, err
+	}
+
+	// the current version becomes a revision dated by its own creation time
+	query := "INSERT INTO comment_revisions (comment_id, body, created) " +
+		"SELECT id, body, COALESCE(edited, created) " +
+		"FROM comments " +
+		"WHERE id = $1 AND user_id = $2"
+
+	res, err := tx.Exec(query, commentID, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return nil, service.ErrInternal
+	}
+	if n == 0 {
 		return nil, service.ErrUnauthorized
 	}
 
-	post, err := get(tx, postID)
+	query = "UPDATE comments " +
+		"SET body = $1, edited = now() " +
+		"WHERE id = $2"
+
+	if _, err := tx.Exec(query, body, commentID); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	post, err := get(tx, postID, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -742,10 +1410,78 @@ func (r *PostRepo) DeleteComment(postID, commentID, userID int) (*entity.Post, e
 		return nil, service.ErrInternal
 	}
 
-	return post, err
+	return post, nil
+}
+
+// GetCommentRevisions returns the revisions of the comment seen by the user,
+// the newest first.
+func (r *PostRepo) GetCommentRevisions(postID, commentID, userID int) ([]*entity.CommentRevision, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := checkVisiblePost(tx, postID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := checkVisibleComment(tx, postID, commentID, userID); err != nil {
+		return nil, err
+	}
+
+	query := "SELECT id, body, created " +
+		"FROM comment_revisions " +
+		"WHERE comment_id = $1 " +
+		"ORDER BY id DESC"
+
+	rows, err := tx.Query(query, commentID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	revisions := make([]*entity.CommentRevision, 0)
+	for rows.Next() {
+		revision := new(entity.CommentRevision)
+		if err := rows.Scan(
+			&revision.ID,
+			&revision.Body,
+			&revision.Created,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		revisions = append(revisions, revision)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return revisions, nil
 }
 
-func (r *PostRepo) Delete(postID, userID int) error {
+// Delete deletes the post on behalf of the user, the deletion is recorded in
+// the moderation log if the user is not the author.
+func (r *PostRepo) Delete(postID, userID int, moderated bool) error {
 	tx, err := r.db.Begin()
 	if err != nil {
 		// TODO: change default logger
@@ -763,10 +1499,16 @@ func (r *PostRepo) Delete(postID, userID int) error {
 		return err
 	}
 
+	if moderated {
+		if err := logAction(tx, entity.ActionRemovePost, userID, postID, 0, ""); err != nil {
+			return err
+		}
+	}
+
 	query := "DELETE FROM posts " +
-		"WHERE id = $1 AND user_id = $2"
+		"WHERE id = $1"
 
-	res, err := tx.Exec(query, postID, userID)
+	res, err := tx.Exec(query, postID)
 	if err != nil {
 		// TODO: change default logger
 		log.Printf("Tx.Exec: %v", err)
@@ -780,7 +1522,7 @@ func (r *PostRepo) Delete(postID, userID int) error {
 		return service.ErrInternal
 	}
 	if n == 0 {
-		return service.ErrUnauthorized
+		return service.ErrPostNotFound
 	}
 
 	if err := tx.Commit(); err != nil {
@@ -791,3 +1533,191 @@ func (r *PostRepo) Delete(postID, userID int) error {
 
 	return nil
 }
+
+// lockComment locks the comment row of the post until the end of the
+// transaction, see lockPost. Deleted comments are not found.
+func lockComment(tx *sql.Tx, postID, id int) error {
+	query := "SELECT " +
+		"FROM comments " +
+		"WHERE id = $1 AND post_id = $2 AND deleted IS NULL " +
+		"FOR UPDATE"
+
+	if err := tx.QueryRow(
+		query,
+		id,
+		postID,
+	).Scan(); err != nil {
+		var retErr error
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			retErr = service.ErrCommentNotFound
+		default:
+			// TODO: change default logger
+			log.Printf("Tx.QueryRow: %v", err)
+			retErr = service.ErrInternal
+		}
+		return retErr
+	}
+
+	return nil
+}
+
+// getCommentVote returns the vote of the user for the comment, 0 if the user
+// has not voted.
+func getCommentVote(tx *sql.Tx, commentID, userID int) (int, error) {
+	query := "SELECT vote " +
+		"FROM comment_votes " +
+		"WHERE comment_id = $1 AND user_id = $2"
+
+	var vote int
+	if err := tx.QueryRow(
+		query,
+		commentID,
+		userID,
+	).Scan(
+		&vote,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, nil
+		}
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return 0, service.ErrInternal
+	}
+
+	return vote, nil
+}
+
+func (r *PostRepo) AddCommentVote(postID, commentID, userID, vote int) (*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	if err := lockComment(tx, postID, commentID); err != nil {
+		return nil, err
+	}
+
+	if err := checkBannedFromPost(tx, userID, postID); err != nil {
+		return nil, err
+	}
+
+	oldVote, err := getCommentVote(tx, commentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldVote != vote {
+		query := "INSERT INTO comment_votes (comment_id, user_id, vote) " +
+			"VALUES ($1, $2, $3)"
+		if oldVote != 0 {
+			query = "UPDATE comment_votes " +
+				"SET vote = $3 " +
+				"WHERE comment_id = $1 AND user_id = $2"
+		}
+
+		if _, err := tx.Exec(
+			query,
+			commentID,
+			userID,
+			vote,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Exec: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		if err := updateCounters(tx, "comments", commentID, oldVote, vote); err != nil {
+			return nil, err
+		}
+	}
+
+	post, err := get(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return post, nil
+}
+
+func (r *PostRepo) DeleteCommentVote(postID, commentID, userID int) (*entity.Post, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	if err := checkPost(tx, postID); err != nil {
+		return nil, err
+	}
+
+	if err := lockComment(tx, postID, commentID); err != nil {
+		return nil, err
+	}
+
+	if err := checkBannedFromPost(tx, userID, postID); err != nil {
+		return nil, err
+	}
+
+	oldVote, err := getCommentVote(tx, commentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if oldVote != 0 {
+		query := "DELETE FROM comment_votes " +
+			"WHERE comment_id = $1 AND user_id = $2"
+
+		if _, err := tx.Exec(
+			query,
+			commentID,
+			userID,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Exec: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		if err := updateCounters(tx, "comments", commentID, oldVote, 0); err != nil {
+			return nil, err
+		}
+	}
+
+	post, err := get(tx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return post, nil
+}
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/s02190058/spa/internal/service"
+)
+
+// benchDBEnv names the variable with the URL of the database the benchmarks
+// seed and clean up. They are skipped without it, the database of the
+// application is never used.
+const benchDBEnv = "SPA_BENCH_PG_URL"
+
+// benchComments is the number of comments of a seeded post.
+const benchComments = 3
+
+type pqConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.QueryerContext
+	driver.ExecerContext
+}
+
+// countingConn counts the statements sent through the connection.
+type countingConn struct {
+	pqConn
+	statements *int64
+}
+
+func (c *countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	atomic.AddInt64(c.statements, 1)
+	return c.pqConn.QueryContext(ctx, query, args)
+}
+
+func (c *countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	atomic.AddInt64(c.statements, 1)
+	return c.pqConn.ExecContext(ctx, query, args)
+}
+
+type countingConnector struct {
+	driver.Connector
+	statements *int64
+}
+
+func (c *countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &countingConn{
+		pqConn:     conn.(pqConn),
+		statements: c.statements,
+	}, nil
+}
+
+// seedPosts adds posts of the user until it has n posts.
+func seedPosts(db *sql.DB, userID, have, n int) error {
+	query := "WITH p AS (" +
+		"INSERT INTO posts (type_id, category_id, title, text, user_id, upvotes, score) " +
+		"SELECT (SELECT min(id) FROM types), (SELECT min(id) FROM categories), 'bench ' || i, 'bench text', $1, 1, 1 " +
+		"FROM generate_series($2::int, $3::int) i " +
+		"RETURNING id" +
+		"), v AS (" +
+		"INSERT INTO votes (post_id, user_id, vote) " +
+		"SELECT id, $1, 1 FROM p" +
+		") " +
+		"INSERT INTO comments (post_id, user_id, body) " +
+		"SELECT p.id, $1, 'bench comment' " +
+		"FROM p, generate_series(1, $4::int)"
+
+	_, err := db.Exec(query, userID, have+1, n, benchComments)
+	return err
+}
+
+// BenchmarkGetByUsername lists growing numbers of posts of a temporary user
+// and reports the statements sent to the database by a listing. The user and
+// its posts are removed afterwards.
+func BenchmarkGetByUsername(b *testing.B) {
+	url := os.Getenv(benchDBEnv)
+	if url == "" {
+		b.Skipf("%s is not set", benchDBEnv)
+	}
+
+	connector, err := pq.NewConnector(url)
+	if err != nil {
+		b.Fatalf("pq.NewConnector: %v", err)
+	}
+
+	var statements int64
+	db := sql.OpenDB(&countingConnector{
+		Connector:  connector,
+		statements: &statements,
+	})
+	defer db.Close()
+
+	username := fmt.Sprintf("bench-%d", time.Now().UnixNano())
+	var userID int
+	if err := db.QueryRow(
+		"INSERT INTO users (name, encrypted_password) VALUES ($1, '') RETURNING id",
+		username,
+	).Scan(&userID); err != nil {
+		b.Fatalf("unable to create a user: %v", err)
+	}
+	defer func() {
+		if _, err := db.Exec("DELETE FROM users WHERE id = $1", userID); err != nil {
+			b.Errorf("unable to delete the user %s: %v", username, err)
+		}
+	}()
+
+	postRepo := NewPostRepo(db)
+
+	have := 0
+	for _, n := range []int{10, 100, 500, 1000} {
+		if err := seedPosts(db, userID, have, n); err != nil {
+			b.Fatalf("unable to seed posts: %v", err)
+		}
+		have = n
+
+		b.Run(fmt.Sprintf("posts=%d", n), func(b *testing.B) {
+			atomic.StoreInt64(&statements, 0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := postRepo.GetByUsername(username, service.PostQuery{
+					Rank:  "created",
+					Now:   time.Now(),
+					Limit: n,
+				}); err != nil {
+					b.Fatalf("unable to list posts: %v", err)
+				}
+			}
+			b.ReportMetric(float64(atomic.LoadInt64(&statements))/float64(b.N), "statements/op")
+		})
+	}
+}
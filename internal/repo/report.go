@@ -0,0 +1,284 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lib/pq"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+type ModerationRepo struct {
+	db *sql.DB
+}
+
+func NewModerationRepo(db *sql.DB) *ModerationRepo {
+	return &ModerationRepo{
+		db: db,
+	}
+}
+
+// nullID turns 0 into NULL.
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// GetTarget returns the author and the community of the post, or of its
+// comment unless commentID is 0.
+func (r *ModerationRepo) GetTarget(postID, commentID int) (int, string, error) {
+	return getOwner(r.db, postID, commentID)
+}
+
+func (r *ModerationRepo) AddReport(postID, commentID, userID int, reason string) error {
+	if _, _, err := getOwner(r.db, postID, commentID); err != nil {
+		return err
+	}
+
+	query := "INSERT INTO reports (post_id, comment_id, user_id, reason) " +
+		"VALUES ($1, $2, $3, $4) " +
+		"ON CONFLICT DO NOTHING"
+
+	if _, err := r.db.Exec(
+		query,
+		postID,
+		nullID(commentID),
+		userID,
+		reason,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// GetQueue returns the open reports of the communities grouped by the
+// reported content, all communities if communities is nil.
+func (r *ModerationRepo) GetQueue(communities []string, limit int) ([]*entity.ReportGroup, error) {
+	var args []interface{}
+	where := "WHERE r.resolved IS NULL AND cm.deleted IS NULL"
+	if communities != nil {
+		args = append(args, pq.Array(communities))
+		where += " AND c.name = ANY($1)"
+	}
+
+	query := "SELECT r.post_id, COALESCE(r.comment_id, 0), c.name, p.title, COALESCE(cm.body, p.text), " +
+		"u.id, u.name, COUNT(*), array_agg(r.reason ORDER BY r.created), min(r.created), max(r.created) " +
+		"FROM reports r " +
+		"JOIN posts p " +
+		"ON r.post_id = p.id " +
+		"JOIN categories c " +
+		"ON p.category_id = c.id " +
+		"LEFT JOIN comments cm " +
+		"ON r.comment_id = cm.id " +
+		"JOIN users u " +
+		"ON COALESCE(cm.user_id, p.user_id) = u.id " +
+		where + " " +
+		"GROUP BY r.post_id, r.comment_id, c.name, p.title, cm.body, p.text, u.id, u.name " +
+		fmt.Sprintf("ORDER BY COUNT(*) DESC, min(r.created) LIMIT %d", limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	groups := make([]*entity.ReportGroup, 0)
+	for rows.Next() {
+		group := new(entity.ReportGroup)
+		group.Author = new(entity.User)
+		if err := rows.Scan(
+			&group.PostID,
+			&group.CommentID,
+			&group.Community,
+			&group.Title,
+			&group.Text,
+			&group.Author.ID,
+			&group.Author.Username,
+			&group.Reports,
+			pq.Array(&group.Reasons),
+			&group.FirstReported,
+			&group.LastReported,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return groups, nil
+}
+
+// Resolve closes the open reports of the content with the action, see
+// service.ModerationService.Resolve.
+func (r *ModerationRepo) Resolve(postID, commentID, moderatorID int, action, reason string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "UPDATE reports " +
+		"SET resolved = now(), resolution = $1 " +
+		"WHERE post_id = $2 AND comment_id IS NOT DISTINCT FROM $3 AND resolved IS NULL"
+
+	res, err := tx.Exec(query, action, postID, nullID(commentID))
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrReportNotFound
+	}
+
+	if err := logAction(tx, action, moderatorID, postID, commentID, reason); err != nil {
+		return err
+	}
+
+	switch action {
+	case entity.ActionRemovePost:
+		// the reports of the post are not tied to it and stay
+		query = "DELETE FROM posts " +
+			"WHERE id = $1"
+
+		if _, err := tx.Exec(query, postID); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Exec: %v", err)
+			return service.ErrInternal
+		}
+	case entity.ActionRemoveComment:
+		query = "UPDATE comments " +
+			"SET deleted = now() " +
+			"WHERE id = $1 AND post_id = $2 AND deleted IS NULL"
+
+		if _, err := tx.Exec(query, commentID, postID); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Exec: %v", err)
+			return service.ErrInternal
+		}
+	case entity.ActionBan:
+		query = "INSERT INTO bans (user_id, category_id, moderator_id, reason) " +
+			"SELECT COALESCE(c.user_id, p.user_id), p.category_id, $1, $2 " +
+			"FROM posts p " +
+			"LEFT JOIN comments c " +
+			"ON c.id = $3 AND c.post_id = p.id " +
+			"WHERE p.id = $4 " +
+			"ON CONFLICT (user_id, COALESCE(category_id, 0)) DO UPDATE " +
+			"SET moderator_id = excluded.moderator_id, reason = excluded.reason, " +
+			"shadow = FALSE, expires = NULL, created = now()"
+
+		if _, err := tx.Exec(query, moderatorID, reason, commentID, postID); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Exec: %v", err)
+			return service.ErrInternal
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// GetLog returns the latest entries of the moderation log of the community,
+// the site-wide entries if community is empty.
+func (r *ModerationRepo) GetLog(community string, limit int) ([]*entity.LogEntry, error) {
+	var args []interface{}
+	where := "WHERE l.category_id IS NULL"
+	if community != "" {
+		args = append(args, community)
+		where = "WHERE c.name = $1"
+	}
+
+	query := "SELECT l.id, l.action, m.id, m.name, COALESCE(c.name, ''), u.id, u.name, " +
+		"COALESCE(l.post_id, 0), COALESCE(l.comment_id, 0), l.details, l.created " +
+		"FROM moderation_log l " +
+		"LEFT JOIN categories c " +
+		"ON l.category_id = c.id " +
+		"LEFT JOIN users m " +
+		"ON l.moderator_id = m.id " +
+		"LEFT JOIN users u " +
+		"ON l.user_id = u.id " +
+		where + " " +
+		fmt.Sprintf("ORDER BY l.id DESC LIMIT %d", limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	entries := make([]*entity.LogEntry, 0)
+	for rows.Next() {
+		entry := new(entity.LogEntry)
+		var moderatorID, userID sql.NullInt64
+		var moderatorName, userName sql.NullString
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.Action,
+			&moderatorID,
+			&moderatorName,
+			&entry.Community,
+			&userID,
+			&userName,
+			&entry.PostID,
+			&entry.CommentID,
+			&entry.Details,
+			&entry.Created,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		if moderatorID.Valid {
+			entry.Moderator = &entity.User{ID: int(moderatorID.Int64), Username: moderatorName.String}
+		}
+		if userID.Valid {
+			entry.User = &entity.User{ID: int(userID.Int64), Username: userName.String}
+		}
+
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,143 @@
+package repo
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"strings"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+// the matches are marked with control characters by the storage, so that
+// the snippets can be escaped before the marks are turned into tags
+const (
+	startMark = "\x02"
+	stopMark  = "\x03"
+)
+
+var headlineOptions = "StartSel=" + startMark + ", StopSel=" + stopMark +
+	", MaxFragments=2, MaxWords=30, MinWords=10"
+
+var snippetReplacer = strings.NewReplacer(startMark, "<mark>", stopMark, "</mark>")
+
+// Search returns a single page of posts and comments matching all the terms.
+// Both are ranked with ts_rank_cd, matches in post titles weigh more than
+// matches in post texts. Keys are 2 * id for posts and 2 * id + 1 for
+// comments, they are unique across both.
+func (r *PostRepo) Search(q service.SearchQuery) ([]*entity.SearchResult, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	tsqueries := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		switch term.Kind {
+		case service.TermPhrase:
+			tsqueries = append(tsqueries, "phraseto_tsquery('english', "+arg(term.Text)+")")
+		case service.TermPrefix:
+			tsqueries = append(tsqueries, "to_tsquery('english', "+arg(term.Text)+" || ':*')")
+		default:
+			tsqueries = append(tsqueries, "plainto_tsquery('english', "+arg(term.Text)+")")
+		}
+	}
+
+	var conditions []string
+	if q.Category != "" {
+		conditions = append(conditions, "c.name = "+arg(q.Category))
+	}
+	if q.Author != "" {
+		conditions = append(conditions, "u.name = "+arg(q.Author))
+	}
+	if !q.From.IsZero() {
+		conditions = append(conditions, "r.created >= "+arg(q.From))
+	}
+	if !q.To.IsZero() {
+		conditions = append(conditions, "r.created < "+arg(q.To))
+	}
+	if q.After != nil {
+		conditions = append(conditions, "(r.rank, r.key) < ("+arg(q.After.Rank)+", "+arg(q.After.ID)+")")
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// snippets are only made for the rows of the page
+	query := "WITH q AS (SELECT " + strings.Join(tsqueries, " && ") + " AS query) " +
+		"SELECT r.kind, r.post_id, r.comment_id, p.title, c.name, u.id, u.name, " +
+		"ts_headline('english', " +
+		"CASE WHEN r.kind = 'post' THEN p.title || ' ' || p.text ELSE cm.body END, " +
+		"q.query, " + arg(headlineOptions) + "), " +
+		"r.created, r.rank, r.key " +
+		"FROM (" +
+		"SELECT 'post' AS kind, p.id AS post_id, 0::bigint AS comment_id, p.user_id, p.created, " +
+		"ts_rank_cd(p.search, q.query)::float8 AS rank, 2 * p.id AS key " +
+		"FROM posts p, q " +
+		"WHERE p.search @@ q.query " +
+		"AND " + visible("p", "p.category_id", q.UserID) + " " +
+		"UNION ALL " +
+		"SELECT 'comment', c.post_id, c.id, c.user_id, c.created, " +
+		"ts_rank_cd(c.search, q.query)::float8, 2 * c.id + 1 " +
+		"FROM comments c, q " +
+		"WHERE c.search @@ q.query " +
+		"AND c.deleted IS NULL " +
+		"AND " + visible("c", "(SELECT category_id FROM posts WHERE id = c.post_id)", q.UserID) +
+		") r " +
+		"CROSS JOIN q " +
+		"JOIN posts p " +
+		"ON r.post_id = p.id " +
+		"JOIN categories c " +
+		"ON p.category_id = c.id " +
+		"JOIN users u " +
+		"ON r.user_id = u.id " +
+		"LEFT JOIN comments cm " +
+		"ON r.kind = 'comment' AND r.comment_id = cm.id" +
+		where +
+		fmt.Sprintf(" ORDER BY r.rank DESC, r.key DESC LIMIT %d", q.Limit)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	results := make([]*entity.SearchResult, 0)
+	for rows.Next() {
+		result := new(entity.SearchResult)
+		result.Author = new(entity.User)
+		if err := rows.Scan(
+			&result.Type,
+			&result.PostID,
+			&result.CommentID,
+			&result.Title,
+			&result.Category,
+			&result.Author.ID,
+			&result.Author.Username,
+			&result.Snippet,
+			&result.Created,
+			&result.Rank,
+			&result.Key,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		result.Snippet = snippetReplacer.Replace(html.EscapeString(result.Snippet))
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return results, nil
+}
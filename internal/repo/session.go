@@ -0,0 +1,301 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+// activeSession is the condition of the sessions (aliased s) neither revoked
+// nor expired.
+const activeSession = "s.revoked IS NULL AND s.expires > now()"
+
+// AddSession starts a session of the user on the client with the hash of its
+// refresh token.
+func (r *UserRepo) AddSession(
+	userID int,
+	refreshHash string,
+	expires time.Time,
+	client entity.Client,
+) (*entity.Session, error) {
+	query := "INSERT INTO sessions (user_id, refresh_hash, expires, ip, user_agent) " +
+		"VALUES ($1, $2, $3, $4, $5) " +
+		"RETURNING id, created, last_used"
+
+	session := &entity.Session{
+		UserID:  userID,
+		Client:  client,
+		Expires: expires,
+	}
+	if err := r.db.QueryRow(
+		query,
+		userID,
+		refreshHash,
+		expires,
+		client.IP,
+		client.UserAgent,
+	).Scan(
+		&session.ID,
+		&session.Created,
+		&session.LastUsed,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return session, nil
+}
+
+// RotateSession replaces the refresh token of the session and prolongs the
+// session used by the client. A refresh token already replaced is a sign of
+// theft, its session is revoked.
+func (r *UserRepo) RotateSession(
+	refreshHash, newHash string,
+	expires time.Time,
+	client entity.Client,
+) (*entity.Session, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "SELECT s.id, s.user_id, s.created " +
+		"FROM sessions s " +
+		"WHERE s.refresh_hash = $1 AND " + activeSession + " " +
+		"FOR UPDATE"
+
+	session := &entity.Session{
+		Client:  client,
+		Expires: expires,
+	}
+	if err := tx.QueryRow(
+		query,
+		refreshHash,
+	).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.Created,
+	); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			// TODO: change default logger
+			log.Printf("Tx.QueryRow: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		if err := revokeReused(tx, refreshHash); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			// TODO: change default logger
+			log.Printf("Tx.Commit: %v", err)
+			return nil, service.ErrInternal
+		}
+		return nil, service.ErrInvalidRefreshToken
+	}
+
+	query = "UPDATE sessions " +
+		"SET previous_hash = refresh_hash, refresh_hash = $1, expires = $2, " +
+		"last_used = now(), ip = $3, user_agent = $4 " +
+		"WHERE id = $5 " +
+		"RETURNING last_used"
+
+	if err := tx.QueryRow(
+		query,
+		newHash,
+		expires,
+		client.IP,
+		client.UserAgent,
+		session.ID,
+	).Scan(
+		&session.LastUsed,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.QueryRow: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return session, nil
+}
+
+// revokeReused revokes the session whose previous refresh token is reused.
+func revokeReused(tx *sql.Tx, refreshHash string) error {
+	query := "UPDATE sessions " +
+		"SET revoked = now() " +
+		"WHERE previous_hash = $1 AND revoked IS NULL"
+
+	if _, err := tx.Exec(query, refreshHash); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// GetSessions returns the active sessions of the user, the last used first.
+func (r *UserRepo) GetSessions(userID int) ([]*entity.Session, error) {
+	query := "SELECT s.id, s.user_id, s.ip, s.user_agent, s.created, s.last_used, s.expires " +
+		"FROM sessions s " +
+		"WHERE s.user_id = $1 AND " + activeSession + " " +
+		"ORDER BY s.last_used DESC, s.id DESC"
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	sessions := make([]*entity.Session, 0)
+	for rows.Next() {
+		session := new(entity.Session)
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.IP,
+			&session.UserAgent,
+			&session.Created,
+			&session.LastUsed,
+			&session.Expires,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return sessions, nil
+}
+
+// UpdateSessionUses records the last uses of the sessions with one query.
+// Uses older than the recorded ones are ignored.
+func (r *UserRepo) UpdateSessionUses(uses []service.SessionUse) error {
+	ids := make([]int64, 0, len(uses))
+	times := make([]string, 0, len(uses))
+	ips := make([]string, 0, len(uses))
+	userAgents := make([]string, 0, len(uses))
+	for _, use := range uses {
+		ids = append(ids, int64(use.ID))
+		times = append(times, use.Time.Format(time.RFC3339Nano))
+		ips = append(ips, use.IP)
+		userAgents = append(userAgents, use.UserAgent)
+	}
+
+	query := "UPDATE sessions s " +
+		"SET last_used = u.last_used, ip = u.ip, user_agent = u.user_agent " +
+		"FROM unnest($1::bigint[], $2::timestamptz[], $3::text[], $4::text[]) " +
+		"AS u (id, last_used, ip, user_agent) " +
+		"WHERE s.id = u.id AND s.last_used < u.last_used"
+
+	if _, err := r.db.Exec(
+		query,
+		pq.Array(ids),
+		pq.Array(times),
+		pq.Array(ips),
+		pq.Array(userAgents),
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// CheckSession checks that the session is neither revoked nor expired.
+func (r *UserRepo) CheckSession(id int) error {
+	query := "SELECT EXISTS (" +
+		"SELECT " +
+		"FROM sessions s " +
+		"WHERE s.id = $1 AND " + activeSession +
+		")"
+
+	var active bool
+	if err := r.db.QueryRow(
+		query,
+		id,
+	).Scan(
+		&active,
+	); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return service.ErrInternal
+	}
+
+	if !active {
+		return service.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeSession revokes the session of the user.
+func (r *UserRepo) RevokeSession(id, userID int) error {
+	query := "UPDATE sessions s " +
+		"SET revoked = now() " +
+		"WHERE s.id = $1 AND s.user_id = $2 AND " + activeSession
+
+	res, err := r.db.Exec(query, id, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeSessions revokes all the sessions of the user but the kept one, 0
+// keeps none.
+func (r *UserRepo) RevokeSessions(userID, keepID int) error {
+	query := "UPDATE sessions s " +
+		"SET revoked = now() " +
+		"WHERE s.user_id = $1 AND s.id <> $2 AND " + activeSession
+
+	if _, err := r.db.Exec(query, userID, keepID); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
@@ -0,0 +1,326 @@
+package repo
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/s02190058/spa/internal/service"
+)
+
+// SetTOTPSecret sets the secret of a pending enrollment, the secret of an
+// enabled second factor can not be replaced.
+func (r *UserRepo) SetTOTPSecret(userID int, secret string) error {
+	query := "UPDATE users " +
+		"SET totp_secret = $1 " +
+		"WHERE id = $2 AND NOT totp_enabled"
+
+	res, err := r.db.Exec(query, secret, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrTwoFactorEnabled
+	}
+
+	return nil
+}
+
+// GetTOTP returns the secret of the user, empty if the user never enrolled,
+// and whether it is confirmed.
+func (r *UserRepo) GetTOTP(userID int) (string, bool, error) {
+	query := "SELECT COALESCE(totp_secret, ''), totp_enabled " +
+		"FROM users " +
+		"WHERE id = $1"
+
+	var secret string
+	var enabled bool
+	if err := r.db.QueryRow(
+		query,
+		userID,
+	).Scan(
+		&secret,
+		&enabled,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", false, service.ErrUserNotFound
+		}
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return "", false, service.ErrInternal
+	}
+
+	return secret, enabled, nil
+}
+
+// EnableTOTP confirms the enrollment with the code of the step and replaces
+// the recovery codes of the user.
+func (r *UserRepo) EnableTOTP(userID int, step int64, codeHashes []string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "UPDATE users " +
+		"SET totp_enabled = TRUE, totp_last_step = $1 " +
+		"WHERE id = $2 AND totp_secret IS NOT NULL AND NOT totp_enabled"
+
+	res, err := tx.Exec(query, step, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrTwoFactorEnabled
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	query := "DELETE FROM recovery_codes " +
+		"WHERE user_id = $1"
+
+	if _, err := tx.Exec(query, userID); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	query = "INSERT INTO recovery_codes (user_id, hash) " +
+		"SELECT $1, unnest($2::text[])"
+
+	if _, err := tx.Exec(query, userID, pq.Array(codeHashes)); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// UseTOTPStep marks the code of the step used, codes of the same or earlier
+// steps are rejected afterwards.
+func (r *UserRepo) UseTOTPStep(userID int, step int64) error {
+	query := "UPDATE users " +
+		"SET totp_last_step = $1 " +
+		"WHERE id = $2 AND totp_enabled AND totp_last_step < $1"
+
+	res, err := r.db.Exec(query, step, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrInvalidCode
+	}
+
+	return nil
+}
+
+// GetRecoveryCodes returns the unused recovery codes of the user.
+func (r *UserRepo) GetRecoveryCodes(userID int) ([]service.RecoveryCode, error) {
+	query := "SELECT id, hash " +
+		"FROM recovery_codes " +
+		"WHERE user_id = $1 AND used IS NULL"
+
+	rows, err := r.db.Query(query, userID)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Query: %v", err)
+		return nil, service.ErrInternal
+	}
+	defer rows.Close()
+
+	codes := make([]service.RecoveryCode, 0)
+	for rows.Next() {
+		var code service.RecoveryCode
+		if err := rows.Scan(
+			&code.ID,
+			&code.Hash,
+		); err != nil {
+			// TODO: change default logger
+			log.Printf("Rows.Scan: %v", err)
+			return nil, service.ErrInternal
+		}
+
+		codes = append(codes, code)
+	}
+	if err := rows.Err(); err != nil {
+		// TODO: change default logger
+		log.Printf("Rows.Err: %v", err)
+		return nil, service.ErrInternal
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode marks the recovery code used.
+func (r *UserRepo) UseRecoveryCode(id int) error {
+	query := "UPDATE recovery_codes " +
+		"SET used = now() " +
+		"WHERE id = $1 AND used IS NULL"
+
+	res, err := r.db.Exec(query, id)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrInvalidCode
+	}
+
+	return nil
+}
+
+// DisableTOTP removes the second factor and the recovery codes of the user.
+func (r *UserRepo) DisableTOTP(userID int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Begin: %v", err)
+		return service.ErrInternal
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+			// TODO: change default logger
+			log.Printf("Tx.Rollback: %v", err)
+		}
+	}()
+
+	query := "UPDATE users " +
+		"SET totp_secret = NULL, totp_enabled = FALSE, totp_last_step = 0 " +
+		"WHERE id = $1"
+
+	if _, err := tx.Exec(query, userID); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	query = "DELETE FROM recovery_codes " +
+		"WHERE user_id = $1"
+
+	if _, err := tx.Exec(query, userID); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	if err := tx.Commit(); err != nil {
+		// TODO: change default logger
+		log.Printf("Tx.Commit: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// AddChallenge stores the hash of a login challenge of the user.
+func (r *UserRepo) AddChallenge(userID int, hash string, expires time.Time) error {
+	query := "INSERT INTO login_challenges (user_id, hash, expires) " +
+		"VALUES ($1, $2, $3)"
+
+	if _, err := r.db.Exec(query, userID, hash, expires); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
+
+// UseChallenge counts an attempt to pass the challenge and returns its user.
+// Expired challenges and challenges out of attempts are rejected.
+func (r *UserRepo) UseChallenge(hash string, maxAttempts int) (int, error) {
+	query := "UPDATE login_challenges " +
+		"SET attempts = attempts + 1 " +
+		"WHERE hash = $1 AND expires > now() AND attempts < $2 " +
+		"RETURNING user_id"
+
+	var userID int
+	if err := r.db.QueryRow(
+		query,
+		hash,
+		maxAttempts,
+	).Scan(
+		&userID,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, service.ErrInvalidChallenge
+		}
+		// TODO: change default logger
+		log.Printf("DB.QueryRow: %v", err)
+		return 0, service.ErrInternal
+	}
+
+	return userID, nil
+}
+
+// DeleteChallenge deletes the passed challenge along with the expired ones.
+func (r *UserRepo) DeleteChallenge(hash string) error {
+	query := "DELETE FROM login_challenges " +
+		"WHERE hash = $1 OR expires < now()"
+
+	if _, err := r.db.Exec(query, hash); err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	return nil
+}
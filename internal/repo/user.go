@@ -9,6 +9,9 @@ import (
 	"log"
 )
 
+// emailIndex is the unique index of the verified emails.
+const emailIndex = "users_verified_email_idx"
+
 type UserRepo struct {
 	db *sql.DB
 }
@@ -19,18 +22,27 @@ func NewUserRepo(db *sql.DB) *UserRepo {
 	}
 }
 
+// Add adds the user, the email is not verified. An email verified by
+// another user is not taken.
 func (r *UserRepo) Add(user *entity.User) (*entity.User, error) {
-	query := "INSERT INTO users (name, encrypted_password) " +
-		"VALUES ($1, $2) " +
+	query := "INSERT INTO users (name, encrypted_password, email) " +
+		"SELECT $1, $2, NULLIF($3, '') " +
+		"WHERE NOT EXISTS (" +
+		"SELECT FROM users WHERE lower(email) = lower($3) AND email_verified" +
+		") " +
 		"RETURNING ID"
 
 	if err := r.db.QueryRow(
 		query,
 		user.Username,
 		user.EncryptedPassword,
+		user.Email,
 	).Scan(
 		&user.ID,
 	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, service.ErrEmailExists
+		}
 		pqErr, ok := err.(*pq.Error)
 		if !ok {
 			// TODO: change default logger
@@ -54,19 +66,41 @@ func (r *UserRepo) Add(user *entity.User) (*entity.User, error) {
 }
 
 func (r *UserRepo) GetByUsername(username string) (*entity.User, error) {
+	return r.get("u.name = $1", username)
+}
 
-	query := "SELECT id, name, encrypted_password " +
-		"FROM users " +
-		"WHERE name = $1"
+func (r *UserRepo) GetByID(id int) (*entity.User, error) {
+	return r.get("u.id = $1", id)
+}
+
+// get returns the user matching the condition, the users table is aliased u.
+func (r *UserRepo) get(condition string, args ...interface{}) (*entity.User, error) {
+	query := "SELECT u.id, u.name, u.encrypted_password, u.role, u.totp_enabled, " +
+		"COALESCE(u.email, ''), u.email_verified, " +
+		"ARRAY(" +
+		"SELECT c.name " +
+		"FROM moderators m " +
+		"JOIN categories c " +
+		"ON m.category_id = c.id " +
+		"WHERE m.user_id = u.id " +
+		"ORDER BY c.name" +
+		") " +
+		"FROM users u " +
+		"WHERE " + condition
 
 	user := new(entity.User)
 	if err := r.db.QueryRow(
 		query,
-		username,
+		args...,
 	).Scan(
 		&user.ID,
 		&user.Username,
 		&user.EncryptedPassword,
+		&user.Role,
+		&user.TOTPEnabled,
+		&user.Email,
+		&user.Verified,
+		pq.Array(&user.Moderates),
 	); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, service.ErrUserNotFound
@@ -78,3 +112,28 @@ func (r *UserRepo) GetByUsername(username string) (*entity.User, error) {
 
 	return user, nil
 }
+
+func (r *UserRepo) SetRole(username, role string) error {
+	query := "UPDATE users " +
+		"SET role = $1 " +
+		"WHERE name = $2"
+
+	res, err := r.db.Exec(query, role, username)
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("DB.Exec: %v", err)
+		return service.ErrInternal
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		// TODO: change default logger
+		log.Printf("Result.RowsAffected: %v", err)
+		return service.ErrInternal
+	}
+	if n == 0 {
+		return service.ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+	"github.com/google/uuid"
+	"github.com/s02190058/spa/internal/entity"
+)
+
+var (
+	ErrInvalidEmail      = errors.New("invalid email")
+	ErrEmailExists       = errors.New("email already in use")
+	ErrInvalidResetToken = errors.New("invalid reset token")
+)
+
+// The ways to delete an account: DeletionAnonymize keeps the content of the
+// user under a random name, DeletionCascade removes it.
+const (
+	DeletionAnonymize = "anonymize"
+	DeletionCascade   = "cascade"
+)
+
+const (
+	// resetTTL is the lifetime of the password reset links.
+	resetTTL = time.Hour
+	// resetCooldown is the time between the password reset links of a user.
+	resetCooldown = 5 * time.Minute
+)
+
+// ChangePassword replaces the password of the user, the old password is
+// required unless the user registered through an identity provider and has
+// none yet. The other sessions and the API keys of the user are revoked.
+func (s *UserService) ChangePassword(userID, session int, password, newPassword string, client entity.Client) error {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkCurrentPassword(user, password, client); err != nil {
+		return err
+	}
+
+	if err := s.checkPassword(user.Username, newPassword); err != nil {
+		return err
+	}
+
+	encryptedPassword, err := s.passwordHasher.Encrypt(newPassword)
+	if err != nil {
+		return ErrInternal
+	}
+
+	return s.repo.SetPassword(userID, encryptedPassword, session)
+}
+
+// checkCurrentPassword confirms a change of the account with the password.
+// The users registered through an identity provider have no password until
+// they set one, the session is all they can show. Wrong passwords count
+// toward the lockout like failed logins, a stolen session does not allow to
+// guess the password.
+func (s *UserService) checkCurrentPassword(user *entity.User, password string, client entity.Client) error {
+	if user.EncryptedPassword == "" {
+		return nil
+	}
+
+	if err := s.checkLockout(user.Username, client); err != nil {
+		return err
+	}
+	if !s.passwordHasher.Compare(user.EncryptedPassword, password) {
+		if err := s.loginFailed(user.Username, client); err != nil {
+			return err
+		}
+		return ErrWrongPassword
+	}
+
+	return s.loginSucceeded(user.Username)
+}
+
+func validateEmail(email string) error {
+	if validation.Validate(email, validation.Length(3, 254), is.Email) != nil {
+		return ErrInvalidEmail
+	}
+
+	return nil
+}
+
+// SetEmail sets the email the password reset links are sent to, empty
+// removes it. A link confirming the new email is sent to it.
+func (s *UserService) SetEmail(userID int, email string) error {
+	if email == "" {
+		return s.repo.SetEmail(userID, email)
+	}
+
+	if err := validateEmail(email); err != nil {
+		return err
+	}
+
+	if err := s.repo.SetEmail(userID, email); err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	return s.sendVerification(user)
+}
+
+// RequestPasswordReset mails a password reset link to the verified email of
+// the user, at most one per resetCooldown. Whether the user exists and has
+// an email is not revealed, the mail is sent in the background.
+func (s *UserService) RequestPasswordReset(username string) error {
+	user, err := s.repo.GetByUsername(username)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email == "" || !user.Verified {
+		return nil
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return ErrInternal
+	}
+
+	now := time.Now()
+	added, err := s.repo.AddPasswordReset(user.ID, hash, now.Add(resetTTL), now.Add(-resetCooldown))
+	if err != nil {
+		return err
+	}
+	if !added {
+		return nil
+	}
+
+	link := s.opts.ResetURL + "?" + url.Values{"token": {token}}.Encode()
+	return s.sendMail("reset_password", user, link)
+}
+
+// ResetPassword sets the new password of the user of the reset token, all
+// the sessions and the API keys of the user are revoked.
+func (s *UserService) ResetPassword(token, newPassword string) error {
+	userID, err := s.repo.GetPasswordReset(hashToken(token))
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkPassword(user.Username, newPassword); err != nil {
+		return err
+	}
+
+	encryptedPassword, err := s.passwordHasher.Encrypt(newPassword)
+	if err != nil {
+		return ErrInternal
+	}
+
+	return s.repo.ResetPassword(hashToken(token), encryptedPassword)
+}
+
+// DeleteAccount deletes the account of the user, the password is required
+// if the user has one. The content of the user is anonymized or removed as
+// configured.
+func (s *UserService) DeleteAccount(userID int, password string, client entity.Client) error {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkCurrentPassword(user, password, client); err != nil {
+		return err
+	}
+
+	id := uuid.New()
+	name := "deleted-" + hex.EncodeToString(id[:8])
+
+	return s.repo.DeleteUser(userID, name, s.opts.Deletion == DeletionCascade)
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+	"github.com/s02190058/spa/internal/entity"
+)
+
+var (
+	ErrInvalidKeyName   = errors.New("invalid key name")
+	ErrInvalidScope     = errors.New("invalid scope")
+	ErrInvalidKeyExpiry = errors.New("invalid key expiry")
+	ErrTooManyKeys      = errors.New("too many keys")
+	ErrKeyNotFound      = errors.New("key not found")
+	ErrInvalidKey       = errors.New("invalid key")
+)
+
+// APIKeyPrefix starts the API keys, which tells them from the access tokens.
+const APIKeyPrefix = "spa_"
+
+const (
+	// maxAPIKeys limits the keys of a user.
+	maxAPIKeys = 20
+	// keyPrefixLength is the number of the characters of a key kept to tell
+	// the keys apart.
+	keyPrefixLength = len(APIKeyPrefix) + 6
+)
+
+var scopes = map[string]bool{
+	entity.ScopeRead:     true,
+	entity.ScopePost:     true,
+	entity.ScopeVote:     true,
+	entity.ScopeModerate: true,
+}
+
+// IsAPIKey tells whether the credential is an API key.
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+// CreateAPIKey creates a key of the user granting the scopes, a zero expires
+// means a key that never expires. The key is returned only here.
+func (s *UserService) CreateAPIKey(userID int, name string, keyScopes []string, expires time.Time) (*entity.APIKey, error) {
+	if validation.Validate(name, validation.Required, validation.Length(1, 64)) != nil {
+		return nil, ErrInvalidKeyName
+	}
+	if len(keyScopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	unique := make([]string, 0, len(keyScopes))
+	seen := make(map[string]bool, len(keyScopes))
+	for _, scope := range keyScopes {
+		if !scopes[scope] {
+			return nil, ErrInvalidScope
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			unique = append(unique, scope)
+		}
+	}
+
+	key := &entity.APIKey{
+		UserID: userID,
+		Name:   name,
+		Scopes: unique,
+	}
+	if !expires.IsZero() {
+		if !expires.After(time.Now()) {
+			return nil, ErrInvalidKeyExpiry
+		}
+		key.Expires = &expires
+	}
+
+	token, _, err := newToken()
+	if err != nil {
+		return nil, ErrInternal
+	}
+	key.Key = APIKeyPrefix + token
+	key.Prefix = key.Key[:keyPrefixLength]
+
+	return s.repo.AddAPIKey(key, hashToken(key.Key), maxAPIKeys)
+}
+
+// GetAPIKeys lists the keys of the user, without the keys themselves.
+func (s *UserService) GetAPIKeys(userID int) ([]*entity.APIKey, error) {
+	return s.repo.GetAPIKeys(userID)
+}
+
+// RevokeAPIKey deletes the key of the user, it stops working at once.
+func (s *UserService) RevokeAPIKey(userID, id int) error {
+	return s.repo.DeleteAPIKey(id, userID)
+}
+
+// CheckAPIKey returns the user of the key and the key with the scopes it
+// grants. Expired keys are rejected. The uses of the keys are recorded by
+// APIKeyTracker.
+func (s *UserService) CheckAPIKey(key string) (*entity.User, *entity.APIKey, error) {
+	apiKey, err := s.repo.GetAPIKey(hashToken(key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.repo.GetByID(apiKey.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, apiKey, nil
+}
+
+// APIKeyUse is the last use of an API key.
+type APIKeyUse struct {
+	ID   int
+	Time time.Time
+}
+
+type apiKeyUseRepo interface {
+	UpdateAPIKeyUses(uses []APIKeyUse) error
+}
+
+// APIKeyTracker records the uses of the API keys like SessionTracker does
+// for the sessions: in memory, written in batches.
+type APIKeyTracker struct {
+	repo   apiKeyUseRepo
+	period time.Duration
+
+	mu   sync.Mutex
+	uses map[int]time.Time
+
+	done chan struct{}
+}
+
+func NewAPIKeyTracker(repo apiKeyUseRepo, period time.Duration) *APIKeyTracker {
+	return &APIKeyTracker{
+		repo:   repo,
+		period: period,
+		uses:   make(map[int]time.Time),
+		done:   make(chan struct{}),
+	}
+}
+
+// Touch records a use of the key.
+func (t *APIKeyTracker) Touch(id int) {
+	t.mu.Lock()
+	t.uses[id] = time.Now()
+	t.mu.Unlock()
+}
+
+// Flush writes the collected uses.
+func (t *APIKeyTracker) Flush() error {
+	t.mu.Lock()
+	uses := make([]APIKeyUse, 0, len(t.uses))
+	for id, used := range t.uses {
+		uses = append(uses, APIKeyUse{
+			ID:   id,
+			Time: used,
+		})
+	}
+	t.uses = make(map[int]time.Time)
+	t.mu.Unlock()
+
+	if len(uses) == 0 {
+		return nil
+	}
+
+	return t.repo.UpdateAPIKeyUses(uses)
+}
+
+// Start writes the uses every period until Stop.
+func (t *APIKeyTracker) Start(notify func(error)) {
+	go func() {
+		ticker := time.NewTicker(t.period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.Flush(); err != nil {
+					notify(err)
+				}
+			case <-t.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic writes and writes the uses left.
+func (t *APIKeyTracker) Stop() error {
+	close(t.done)
+	return t.Flush()
+}
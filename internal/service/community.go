@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+	"regexp"
+
+	"github.com/go-ozzo/ozzo-validation"
+	"github.com/go-ozzo/ozzo-validation/is"
+
+	"github.com/s02190058/spa/internal/entity"
+)
+
+const (
+	maxRules = 15
+)
+
+var (
+	ErrInvalidCommunityName = errors.New("invalid community name")
+	ErrInvalidDescription   = errors.New("invalid community description")
+	ErrInvalidRules         = errors.New("invalid community rules")
+	ErrInvalidIcon          = errors.New("invalid community icon")
+	ErrCommunityExists      = errors.New("community already exists")
+	ErrCommunityNotFound    = errors.New("community not found")
+)
+
+// community names are used in urls
+var communityName = regexp.MustCompile(`^[A-Za-z0-9_]{3,21}$`)
+
+type communityRepo interface {
+	GetAll() ([]*entity.Community, error)
+	Get(name string) (*entity.Community, error)
+	Add(community *entity.Community) (*entity.Community, error)
+	Update(name string, userID int, description string, rules []string, icon string) (*entity.Community, error)
+	GetSubscriptions(userID int) ([]*entity.Community, error)
+	Subscribe(name string, userID int) (*entity.Community, error)
+	Unsubscribe(name string, userID int) (*entity.Community, error)
+	AddModerator(name, username string) (*entity.Community, error)
+	RemoveModerator(name, username string) (*entity.Community, error)
+}
+
+type CommunityService struct {
+	repo communityRepo
+}
+
+func NewCommunityService(repo communityRepo) *CommunityService {
+	return &CommunityService{
+		repo: repo,
+	}
+}
+
+func validateCommunity(description string, rules []string, icon string) error {
+	if validation.Validate(description, validation.Length(0, 500)) != nil {
+		return ErrInvalidDescription
+	}
+
+	if len(rules) > maxRules {
+		return ErrInvalidRules
+	}
+	for _, rule := range rules {
+		if validation.Validate(rule, validation.Required, validation.Length(1, 300)) != nil {
+			return ErrInvalidRules
+		}
+	}
+
+	if validation.Validate(icon, validation.Length(0, 2048), is.URL) != nil {
+		return ErrInvalidIcon
+	}
+
+	return nil
+}
+
+func (s *CommunityService) GetAll() ([]*entity.Community, error) {
+	return s.repo.GetAll()
+}
+
+func (s *CommunityService) Get(name string) (*entity.Community, error) {
+	return s.repo.Get(name)
+}
+
+// Add creates a community owned by the user. Names are unique regardless
+// of the case.
+func (s *CommunityService) Add(name, description string, rules []string, icon string, owner *entity.User) (*entity.Community, error) {
+	if !communityName.MatchString(name) {
+		return nil, ErrInvalidCommunityName
+	}
+	if rules == nil {
+		rules = []string{}
+	}
+	if err := validateCommunity(description, rules, icon); err != nil {
+		return nil, err
+	}
+
+	return s.repo.Add(&entity.Community{
+		Name:        name,
+		Description: description,
+		Rules:       rules,
+		Icon:        icon,
+		Owner:       owner,
+	})
+}
+
+// Update replaces the description, rules and icon of the community, only its
+// owner is allowed to.
+func (s *CommunityService) Update(name string, userID int, description string, rules []string, icon string) (*entity.Community, error) {
+	if rules == nil {
+		rules = []string{}
+	}
+	if err := validateCommunity(description, rules, icon); err != nil {
+		return nil, err
+	}
+
+	return s.repo.Update(name, userID, description, rules, icon)
+}
+
+func (s *CommunityService) GetSubscriptions(userID int) ([]*entity.Community, error) {
+	return s.repo.GetSubscriptions(userID)
+}
+
+func (s *CommunityService) Subscribe(name string, userID int) (*entity.Community, error) {
+	return s.repo.Subscribe(name, userID)
+}
+
+func (s *CommunityService) Unsubscribe(name string, userID int) (*entity.Community, error) {
+	return s.repo.Unsubscribe(name, userID)
+}
+
+// AddModerator appoints the user a moderator of the community. Admins and the
+// owner of the community are allowed to.
+func (s *CommunityService) AddModerator(actor *entity.User, name, username string) (*entity.Community, error) {
+	community, err := s.repo.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if !canManage(actor, community) {
+		return nil, ErrUnauthorized
+	}
+
+	return s.repo.AddModerator(name, username)
+}
+
+func (s *CommunityService) RemoveModerator(actor *entity.User, name, username string) (*entity.Community, error) {
+	community, err := s.repo.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if !canManage(actor, community) {
+		return nil, ErrUnauthorized
+	}
+
+	return s.repo.RemoveModerator(name, username)
+}
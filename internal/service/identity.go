@@ -0,0 +1,245 @@
+package service
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/pkg/oidc"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("unknown provider")
+	ErrProviderFailed   = errors.New("identity provider failed")
+	ErrInvalidState     = errors.New("invalid state")
+	ErrIdentityLinked   = errors.New("identity linked to another account")
+	ErrProviderLinked   = errors.New("provider already linked")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrLastIdentity     = errors.New("the only way to log in, set a password first")
+)
+
+const (
+	// oidcStateTTL is the time to log in at the provider.
+	oidcStateTTL = 10 * time.Minute
+	// oidcNameAttempts limits the usernames tried for a new user.
+	oidcNameAttempts = 5
+)
+
+// IdentityProvider is an OpenID Connect provider, see oidc.Provider.
+type IdentityProvider interface {
+	AuthCodeURL(redirectURI, state, nonce, challenge string) (string, error)
+	Exchange(redirectURI, code, verifier, nonce string) (*oidc.Claims, error)
+}
+
+// OIDCOptions configure the logins with the Providers, keyed by name. The
+// providers send the users back to CallbackURL/{name}/callback.
+type OIDCOptions struct {
+	Providers   map[string]IdentityProvider
+	CallbackURL string
+}
+
+// OIDCState is a login in progress at a provider, UserID is set when the
+// identity is linked to an account. Binding is the hash of the token binding
+// the login to the browser that started it.
+type OIDCState struct {
+	Provider string
+	Verifier string
+	Nonce    string
+	UserID   int
+	Binding  string
+}
+
+// OIDCProviders returns the names of the providers.
+func (s *UserService) OIDCProviders() []string {
+	names := make([]string, 0, len(s.opts.OIDC.Providers))
+	for name := range s.opts.OIDC.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (s *UserService) callbackURL(provider string) string {
+	return strings.TrimSuffix(s.opts.OIDC.CallbackURL, "/") + "/" + provider + "/callback"
+}
+
+// StartOIDC returns the URL of the login at the provider and the token
+// binding the login to the browser, which has to be presented to FinishOIDC.
+// The identity is linked to the user of userID, zero logs the user in.
+func (s *UserService) StartOIDC(provider string, userID int) (string, string, error) {
+	p, ok := s.opts.OIDC.Providers[provider]
+	if !ok {
+		return "", "", ErrUnknownProvider
+	}
+
+	state, hash, err := newToken()
+	if err != nil {
+		return "", "", ErrInternal
+	}
+	binding, bindingHash, err := newToken()
+	if err != nil {
+		return "", "", ErrInternal
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", ErrInternal
+	}
+	nonce, err := oidc.NewVerifier()
+	if err != nil {
+		return "", "", ErrInternal
+	}
+
+	authURL, err := p.AuthCodeURL(s.callbackURL(provider), state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		return "", "", ErrProviderFailed
+	}
+
+	if err := s.repo.AddOIDCState(hash, &OIDCState{
+		Provider: provider,
+		Verifier: verifier,
+		Nonce:    nonce,
+		UserID:   userID,
+		Binding:  bindingHash,
+	}, time.Now().Add(oidcStateTTL)); err != nil {
+		return "", "", err
+	}
+
+	return authURL, binding, nil
+}
+
+// FinishOIDC completes the login at the provider with the code it sent back,
+// in the browser of the binding token given by StartOIDC. A linked identity
+// logs its user in, an unknown one registers a new user; users with
+// two-factor authentication get a challenge. The tokens are nil when the
+// identity was linked to an account instead.
+func (s *UserService) FinishOIDC(provider, state, binding, code string, client entity.Client) (*entity.Tokens, error) {
+	p, ok := s.opts.OIDC.Providers[provider]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	login, err := s.repo.UseOIDCState(hashToken(state))
+	if err != nil {
+		return nil, err
+	}
+	if login.Provider != provider {
+		return nil, ErrInvalidState
+	}
+	// the login was started in another browser, e.g. an attacker's one
+	if binding == "" || !hmac.Equal([]byte(hashToken(binding)), []byte(login.Binding)) {
+		return nil, ErrInvalidState
+	}
+
+	claims, err := p.Exchange(s.callbackURL(provider), code, login.Verifier, login.Nonce)
+	if err != nil {
+		return nil, ErrProviderFailed
+	}
+
+	if login.UserID != 0 {
+		return nil, s.repo.AddIdentity(login.UserID, provider, claims.Subject, claims.Email)
+	}
+
+	user, err := s.repo.GetByIdentity(provider, claims.Subject)
+	if errors.Is(err, ErrUserNotFound) {
+		user, err = s.addOIDCUser(provider, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return s.startChallenge(user.ID)
+	}
+
+	return s.startSession(user, client)
+}
+
+// addOIDCUser registers the user of an identity without a password. The
+// email is kept if the provider verified it and no account uses it, the
+// accounts are never linked by email.
+func (s *UserService) addOIDCUser(provider string, claims *oidc.Claims) (*entity.User, error) {
+	email := ""
+	if claims.EmailVerified && validateEmail(claims.Email) == nil {
+		email = claims.Email
+	}
+
+	base := oidcUsername(claims)
+	username := base
+	for i := 0; i < oidcNameAttempts; i++ {
+		user, err := s.repo.AddUserWithIdentity(&entity.User{
+			Username: username,
+			Email:    email,
+		}, provider, claims.Subject)
+		switch {
+		case errors.Is(err, ErrEmailExists):
+			email = ""
+		case errors.Is(err, ErrAlreadyExists):
+			id := uuid.New()
+			username = base + "-" + hex.EncodeToString(id[:2])
+		default:
+			return user, err
+		}
+	}
+
+	return nil, ErrAlreadyExists
+}
+
+// oidcUsername returns the username of a new user: the preferred username,
+// the local part of the email or the name, without the characters usernames
+// can not have and short enough for a suffix.
+func oidcUsername(claims *oidc.Claims) string {
+	local := claims.Email
+	if i := strings.LastIndexByte(local, '@'); i >= 0 {
+		local = local[:i]
+	}
+
+	for _, candidate := range []string{claims.Username, local, claims.Name} {
+		name := strings.Map(func(r rune) rune {
+			if r < ' ' || r > '~' {
+				return -1
+			}
+			return r
+		}, candidate)
+		name = strings.TrimSpace(name)
+		if len(name) > 27 {
+			name = strings.TrimSpace(name[:27])
+		}
+		if name != "" {
+			return name
+		}
+	}
+
+	return "user"
+}
+
+// GetIdentities lists the identities linked to the user.
+func (s *UserService) GetIdentities(userID int) ([]*entity.Identity, error) {
+	return s.repo.GetIdentities(userID)
+}
+
+// UnlinkIdentity unlinks the identity of the provider from the user. The
+// last identity of a user without a password stays.
+func (s *UserService) UnlinkIdentity(userID int, provider string) error {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if user.EncryptedPassword == "" {
+		identities, err := s.repo.GetIdentities(userID)
+		if err != nil {
+			return err
+		}
+		if len(identities) == 1 && identities[0].Provider == provider {
+			return ErrLastIdentity
+		}
+	}
+
+	return s.repo.DeleteIdentity(userID, provider)
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/s02190058/spa/internal/entity"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrLoginLocked        = errors.New("too many failed logins, try again later")
+)
+
+// LockoutPolicy locks the logins out after failed attempts: the logins of
+// a username after AccountFailures failures in a row, the logins from an IP
+// address after IPFailures. The first lockout lasts Lockout, each further
+// failure doubles it up to MaxLockout. Failures are forgotten after a
+// successful login of the username or after Window without failures. Zero
+// failures disable the lockout.
+type LockoutPolicy struct {
+	AccountFailures int
+	IPFailures      int
+	Lockout         time.Duration
+	MaxLockout      time.Duration
+	Window          time.Duration
+}
+
+// lockout returns how long the logins are locked out after the failures,
+// threshold failures lock them out.
+func (p LockoutPolicy) lockout(failures, threshold int) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+
+	max := p.MaxLockout
+	if max < p.Lockout {
+		max = p.Lockout
+	}
+
+	d := p.Lockout
+	for i := threshold; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+
+	return d
+}
+
+// The keys of the failed logins. Usernames are counted whether the user
+// exists or not, so that the lockout does not tell.
+func accountKey(username string) string {
+	return "user:" + username
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLockout tells whether the login of the username from the client is
+// locked out.
+func (s *UserService) checkLockout(username string, client entity.Client) error {
+	until, err := s.repo.GetLockout([]string{accountKey(username), ipKey(client.IP)})
+	if err != nil {
+		return err
+	}
+	if time.Now().Before(until) {
+		return ErrLoginLocked
+	}
+
+	return nil
+}
+
+// loginFailed counts the failed login and locks the username or the client
+// out once there are too many failures.
+func (s *UserService) loginFailed(username string, client entity.Client) error {
+	p := s.opts.Lockout
+	since := time.Now().Add(-p.Window)
+
+	thresholds := map[string]int{
+		accountKey(username): p.AccountFailures,
+		ipKey(client.IP):     p.IPFailures,
+	}
+	for key, threshold := range thresholds {
+		if threshold <= 0 {
+			continue
+		}
+
+		failures, err := s.repo.AddLoginFailure(key, since)
+		if err != nil {
+			return err
+		}
+
+		if d := p.lockout(failures, threshold); d > 0 {
+			if err := s.repo.LockLogin(key, time.Now().Add(d)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// loginSucceeded forgets the failed logins of the username. The failures
+// of the IP address are kept, a login to an account of one's own does not
+// clear the guesses of the others.
+func (s *UserService) loginSucceeded(username string) error {
+	return s.repo.ClearLoginFailures(accountKey(username), time.Now().Add(-s.opts.Lockout.Window))
+}
+
+var (
+	dummyOnce sync.Once
+	dummyHash string
+)
+
+// compareDummy spends the time of a password check when there is no user, so
+// that the response time does not tell whether the user exists.
+func (s *UserService) compareDummy(password string) {
+	dummyOnce.Do(func() {
+		dummyHash, _ = s.passwordHasher.Encrypt("dummy password")
+	})
+
+	s.passwordHasher.Compare(dummyHash, password)
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-ozzo/ozzo-validation"
+
+	"github.com/s02190058/spa/internal/entity"
+)
+
+const (
+	defaultQueueLimit = 25
+	maxQueueLimit     = 100
+)
+
+var (
+	ErrBanned         = errors.New("user is banned")
+	ErrInvalidReason  = errors.New("invalid reason")
+	ErrInvalidAction  = errors.New("invalid moderation action")
+	ErrReportNotFound = errors.New("report not found")
+	ErrBanNotFound    = errors.New("ban not found")
+	ErrInvalidExpiry  = errors.New("invalid ban expiry")
+)
+
+type moderationRepo interface {
+	GetTarget(postID, commentID int) (int, string, error)
+	AddReport(postID, commentID, userID int, reason string) error
+	GetQueue(communities []string, limit int) ([]*entity.ReportGroup, error)
+	Resolve(postID, commentID, moderatorID int, action, reason string) error
+	GetLog(community string, limit int) ([]*entity.LogEntry, error)
+	GetBan(id int) (*entity.Ban, error)
+	GetBans(community string) ([]*entity.Ban, error)
+	AddBan(ban *entity.Ban) (*entity.Ban, error)
+	DeleteBan(id, moderatorID int) error
+}
+
+type ModerationService struct {
+	repo moderationRepo
+}
+
+func NewModerationService(repo moderationRepo) *ModerationService {
+	return &ModerationService{
+		repo: repo,
+	}
+}
+
+func queueLimit(limit int) (int, error) {
+	if limit == 0 {
+		limit = defaultQueueLimit
+	}
+	if limit < 1 || limit > maxQueueLimit {
+		return 0, ErrInvalidLimit
+	}
+
+	return limit, nil
+}
+
+// Report reports the post, or its comment unless commentID is 0, to the
+// moderators. Reporting twice has no effect until the report is resolved.
+func (s *ModerationService) Report(postID, commentID, userID int, reason string) error {
+	if validation.Validate(reason, validation.Required, validation.Length(1, 500)) != nil {
+		return ErrInvalidReason
+	}
+
+	return s.repo.AddReport(postID, commentID, userID, reason)
+}
+
+// GetQueue returns the open reports of the communities moderated by the user
+// grouped by the reported content, the most reported first.
+func (s *ModerationService) GetQueue(user *entity.User, limit int) ([]*entity.ReportGroup, error) {
+	limit, err := queueLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// nil means all communities
+	var communities []string
+	if !isAdmin(user) {
+		if len(user.Moderates) == 0 {
+			return nil, ErrUnauthorized
+		}
+		communities = user.Moderates
+	}
+
+	return s.repo.GetQueue(communities, limit)
+}
+
+// Resolve closes the open reports of the post, or its comment unless
+// commentID is 0, with the action: entity.ActionDismiss leaves the content
+// in place, entity.ActionRemovePost and entity.ActionRemoveComment remove it,
+// entity.ActionBan bans the author from the community for good, replacing
+// an earlier ban there.
+func (s *ModerationService) Resolve(user *entity.User, postID, commentID int, action, reason string) error {
+	switch action {
+	case entity.ActionDismiss, entity.ActionBan:
+	case entity.ActionRemovePost:
+		if commentID != 0 {
+			return ErrInvalidAction
+		}
+	case entity.ActionRemoveComment:
+		if commentID == 0 {
+			return ErrInvalidAction
+		}
+	default:
+		return ErrInvalidAction
+	}
+	if validation.Validate(reason, validation.Length(0, 500)) != nil {
+		return ErrInvalidReason
+	}
+
+	_, community, err := s.repo.GetTarget(postID, commentID)
+	if err != nil {
+		return err
+	}
+	if !canModerate(user, community) {
+		return ErrUnauthorized
+	}
+
+	return s.repo.Resolve(postID, commentID, user.ID, action, reason)
+}
+
+// GetLog returns the latest moderation actions in the community, moderators
+// of the community are allowed to see them. The site-wide actions (empty
+// community) are seen by admins.
+func (s *ModerationService) GetLog(user *entity.User, community string, limit int) ([]*entity.LogEntry, error) {
+	limit, err := queueLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	if !canModerate(user, community) {
+		return nil, ErrUnauthorized
+	}
+
+	return s.repo.GetLog(community, limit)
+}
+
+// canBan reports whether the user may ban in the community, site-wide bans
+// (empty community) are given by admins.
+func canBan(user *entity.User, community string) bool {
+	if community == "" {
+		return isAdmin(user)
+	}
+	return canModerate(user, community)
+}
+
+// Ban bans the user in the community or site-wide if community is empty. A
+// zero expires means a permanent ban. Bans take effect immediately, they are
+// checked on every post, comment and vote.
+func (s *ModerationService) Ban(
+	actor *entity.User,
+	username, community, reason string,
+	expires time.Time,
+	shadow bool,
+) (*entity.Ban, error) {
+	if !canBan(actor, community) {
+		return nil, ErrUnauthorized
+	}
+	if validation.Validate(reason, validation.Length(0, 500)) != nil {
+		return nil, ErrInvalidReason
+	}
+
+	ban := &entity.Ban{
+		User:      &entity.User{Username: username},
+		Community: community,
+		Moderator: actor,
+		Reason:    reason,
+		Shadow:    shadow,
+	}
+	if !expires.IsZero() {
+		if !expires.After(time.Now()) {
+			return nil, ErrInvalidExpiry
+		}
+		ban.Expires = &expires
+	}
+
+	return s.repo.AddBan(ban)
+}
+
+// Unban lifts the ban, the users allowed to give the ban are allowed to.
+func (s *ModerationService) Unban(actor *entity.User, id int) error {
+	ban, err := s.repo.GetBan(id)
+	if err != nil {
+		return err
+	}
+	if !canBan(actor, ban.Community) {
+		return ErrUnauthorized
+	}
+
+	return s.repo.DeleteBan(id, actor.ID)
+}
+
+// GetBans returns the bans in effect in the community, site-wide bans if
+// community is empty.
+func (s *ModerationService) GetBans(actor *entity.User, community string) ([]*entity.Ban, error) {
+	if !canBan(actor, community) {
+		return nil, ErrUnauthorized
+	}
+
+	return s.repo.GetBans(community)
+}
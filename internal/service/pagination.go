@@ -0,0 +1,167 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/s02190058/spa/internal/entity"
+)
+
+const (
+	defaultLimit = 25
+	maxLimit     = 100
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidLimit  = errors.New("invalid limit")
+)
+
+// ListOptions are the client supplied parameters of a post listing. UserID
+// is the requesting user, 0 for anonymous users.
+type ListOptions struct {
+	Sort   string
+	Period string
+	Cursor string
+	Limit  int
+	UserID int
+}
+
+// Cursor is the position of the last post of a page. It is handed to the
+// client as an opaque string and must be sent back to get the next page.
+// Sort and Period name the listing the cursor belongs to, it is not valid
+// for another one.
+type Cursor struct {
+	Rank   float64 `json:"r"`
+	ID     int     `json:"i"`
+	Now    int64   `json:"n"`
+	Sort   string  `json:"s,omitempty"`
+	Period string  `json:"p,omitempty"`
+}
+
+// PostQuery describes a single page of a listing for the repository.
+// Posts are ordered by (Rank, ID) descending, Rank is an SQL expression
+// described in Ranker. Now is the reference time of the whole page walk,
+// so that time dependent ranks stay stable across pages. Posts created
+// before Since are not listed unless it is zero. UserID is the requesting
+// user whose votes are loaded with the posts. Sort and Period are kept in
+// the cursors of the listing.
+type PostQuery struct {
+	Sort   string
+	Period string
+	Rank   string
+	Now    time.Time
+	Since  time.Time
+	After  *Cursor
+	Limit  int
+	UserID int
+}
+
+func encodeCursor(c *Cursor) string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := new(Cursor)
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// page validates the page parameters given by the client. The returned limit
+// is one more than the page size: the extra row tells whether there is a
+// next page.
+func page(cursor string, limit int) (*Cursor, int, error) {
+	if limit == 0 {
+		limit = defaultLimit
+	}
+	if limit < 1 || limit > maxLimit {
+		return nil, 0, ErrInvalidLimit
+	}
+
+	if cursor == "" {
+		return nil, limit + 1, nil
+	}
+
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return after, limit + 1, nil
+}
+
+func (s *PostService) newPostQuery(defaultSort string, opts ListOptions) (PostQuery, error) {
+	after, limit, err := page(opts.Cursor, opts.Limit)
+	if err != nil {
+		return PostQuery{}, err
+	}
+
+	if opts.Sort == "" {
+		opts.Sort = defaultSort
+	}
+
+	q := PostQuery{
+		Sort:   opts.Sort,
+		Period: opts.Period,
+		// the cursor keeps whole seconds only
+		Now:    time.Unix(time.Now().Unix(), 0),
+		After:  after,
+		Limit:  limit,
+		UserID: opts.UserID,
+	}
+
+	if after != nil {
+		if after.Sort != q.Sort || after.Period != q.Period {
+			return PostQuery{}, ErrInvalidCursor
+		}
+		q.Now = time.Unix(after.Now, 0)
+	}
+
+	rank, since, err := s.ranking(defaultSort, opts, q.Now)
+	if err != nil {
+		return PostQuery{}, err
+	}
+	q.Rank = rank
+	q.Since = since
+
+	return q, nil
+}
+
+func newPostList(posts []*entity.Post, q PostQuery) *entity.PostList {
+	for _, post := range posts {
+		sortComments(post.Comments, commentSorts[defaultCommentSort])
+	}
+
+	list := &entity.PostList{
+		Posts: posts,
+	}
+
+	if len(posts) == q.Limit {
+		list.Posts = posts[:q.Limit-1]
+		last := list.Posts[len(list.Posts)-1]
+		list.NextCursor = encodeCursor(&Cursor{
+			Rank:   last.Rank,
+			ID:     last.ID,
+			Now:    q.Now.Unix(),
+			Sort:   q.Sort,
+			Period: q.Period,
+		})
+	}
+
+	return list
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	validation "github.com/go-ozzo/ozzo-validation"
+
+	"github.com/s02190058/spa/pkg/breach"
+	"github.com/s02190058/spa/pkg/strength"
+)
+
+var (
+	ErrBreachedPassword = errors.New("password found in a data breach, choose another one")
+	ErrWeakPassword     = errors.New("weak password")
+)
+
+// maxPasswordLength bounds the work of hashing a password.
+const maxPasswordLength = 1024
+
+// PasswordPolicy screens the new passwords: passwords of the Breached
+// corpus are rejected, as are passwords of a strength score below MinScore
+// (strength.ScoreVeryWeak to strength.ScoreVeryStrong). A nil corpus
+// accepts everything.
+type PasswordPolicy struct {
+	MinScore int
+	Breached breach.Corpus
+}
+
+func validatePassword(password string) error {
+	if validation.Validate(password, validation.Length(8, maxPasswordLength)) != nil {
+		return fmt.Errorf("%w: use 8 to %d characters", ErrInvalidPassword, maxPasswordLength)
+	}
+
+	return nil
+}
+
+// checkPassword screens a new password of the user. The errors explain why
+// the password is rejected.
+func (s *UserService) checkPassword(username, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+
+	if s.opts.Password.Breached != nil {
+		found, err := s.opts.Password.Breached.Contains(password)
+		if err != nil {
+			return ErrInternal
+		}
+		if found {
+			return ErrBreachedPassword
+		}
+	}
+
+	res := strength.Estimate(password, username)
+	if res.Score < s.opts.Password.MinScore {
+		return fmt.Errorf("%w: %s", ErrWeakPassword, strings.Join(res.Feedback, ", "))
+	}
+
+	return nil
+}
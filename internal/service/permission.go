@@ -0,0 +1,57 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/s02190058/spa/internal/entity"
+)
+
+var ErrInvalidRole = errors.New("invalid role")
+
+// The permissions below are checked against the roles carried in the access
+// token, a change of roles takes effect on the next sign in.
+
+// withRole sets the role of the user as seen by the permission checks:
+// users moderating communities are moderators.
+func withRole(user *entity.User) *entity.User {
+	if user.Role == "" {
+		user.Role = entity.RoleUser
+	}
+	if user.Role == entity.RoleUser && len(user.Moderates) > 0 {
+		user.Role = entity.RoleModerator
+	}
+
+	return user
+}
+
+func isAdmin(user *entity.User) bool {
+	return user.Role == entity.RoleAdmin
+}
+
+// canModerate reports whether the user may remove, lock or pin the content
+// of the community.
+func canModerate(user *entity.User, community string) bool {
+	if isAdmin(user) {
+		return true
+	}
+
+	for _, name := range user.Moderates {
+		if name == community {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canRemove reports whether the user may remove the content of the author in
+// the community.
+func canRemove(user *entity.User, authorID int, community string) bool {
+	return user.ID == authorID || canModerate(user, community)
+}
+
+// canManage reports whether the user may appoint the moderators of the
+// community.
+func canManage(user *entity.User, community *entity.Community) bool {
+	return isAdmin(user) || community.Owner != nil && community.Owner.ID == user.ID
+}
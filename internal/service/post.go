@@ -5,7 +5,6 @@ import (
 	"github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/s02190058/spa/internal/entity"
-	"sort"
 )
 
 const (
@@ -13,6 +12,19 @@ const (
 	downvote = -1
 )
 
+// post types, see the types table
+const (
+	postTypeLink = "link"
+	postTypeText = "text"
+)
+
+const (
+	// CommentDepth is the number of comment levels returned with a post,
+	// deeper replies are loaded by subtrees.
+	CommentDepth    = 8
+	maxCommentDepth = 32
+)
+
 var (
 	ErrUnauthorized    = errors.New("unauthorized")
 	ErrInvalidType     = errors.New("invalid post type")
@@ -23,84 +35,190 @@ var (
 	ErrPostNotFound    = errors.New("post not found")
 	ErrInvalidBody     = errors.New("invalid comment body")
 	ErrCommentNotFound = errors.New("comment not found")
+	ErrParentNotFound  = errors.New("parent comment not found")
+	ErrInvalidDepth    = errors.New("invalid depth")
+	ErrPostLocked      = errors.New("post is locked")
 )
 
+const defaultCommentSort = CommentSortBest
+
 type postRepo interface {
-	GetAll() ([]*entity.Post, error)
-	Get(id int) (*entity.Post, error)
-	GetByCategory(category string) ([]*entity.Post, error)
-	GetByUsername(username string) ([]*entity.Post, error)
+	GetAll(q PostQuery) ([]*entity.Post, error)
+	Get(id, userID int) (*entity.Post, error)
+	GetByCategory(category string, q PostQuery) ([]*entity.Post, error)
+	GetByUsername(username string, q PostQuery) ([]*entity.Post, error)
+	GetFeed(userID int, defaults []string, q PostQuery) ([]*entity.Post, error)
 	Add(post *entity.Post) (*entity.Post, error)
+	GetPostType(postID int) (string, error)
+	Update(postID, userID int, title, text, url string) (*entity.Post, error)
+	GetRevisions(postID, userID int) ([]*entity.PostRevision, error)
 	AddVote(postID, userID, vote int) (*entity.Post, error)
 	DeleteVote(postID, userID int) (*entity.Post, error)
-	Delete(postID, userID int) error
-	AddComment(postID, userID int, body string) (*entity.Post, error)
-	DeleteComment(postID, commentID, userID int) (*entity.Post, error)
+	Delete(postID, userID int, moderated bool) error
+	AddComment(postID, userID, parentID int, body string) (*entity.Post, error)
+	GetComment(postID, commentID, userID, depth int) (*entity.Comment, error)
+	UpdateComment(postID, commentID, userID int, body string) (*entity.Post, error)
+	GetCommentRevisions(postID, commentID, userID int) ([]*entity.CommentRevision, error)
+	DeleteComment(postID, commentID, userID int, moderated bool) (*entity.Post, error)
+	AddCommentVote(postID, commentID, userID, vote int) (*entity.Post, error)
+	DeleteCommentVote(postID, commentID, userID int) (*entity.Post, error)
+	GetPostOwner(postID int) (int, string, error)
+	GetCommentOwner(postID, commentID int) (int, string, error)
+	SetLocked(postID, userID int, locked bool) (*entity.Post, error)
+	SetPinned(postID, userID int, pinned bool) (*entity.Post, error)
+	GetPinned(category string, userID int) ([]*entity.Post, error)
+	Search(q SearchQuery) ([]*entity.SearchResult, error)
 }
 
 type PostService struct {
-	repo postRepo
+	repo        postRepo
+	rankers     map[string]Ranker
+	defaultFeed []string
 }
 
-func NewPostService(repo postRepo) *PostService {
+// NewPostService creates a post service, defaultFeed are the communities of
+// the feed of users without subscriptions.
+func NewPostService(repo postRepo, defaultFeed []string) *PostService {
 	return &PostService{
-		repo: repo,
+		repo:        repo,
+		rankers:     defaultRankers(),
+		defaultFeed: defaultFeed,
 	}
 }
 
-func (s *PostService) GetAll() ([]*entity.Post, error) {
-	posts, err := s.repo.GetAll()
+func (s *PostService) GetAll(opts ListOptions) (*entity.PostList, error) {
+	q, err := s.newPostQuery(SortTop, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].Score > posts[j].Score
-	})
+	posts, err := s.repo.GetAll(q)
+	if err != nil {
+		return nil, err
+	}
 
-	return posts, nil
+	return newPostList(posts, q), nil
 }
 
-func (s *PostService) Get(id int) (*entity.Post, error) {
-	return s.repo.Get(id)
+// withSortedComments sorts the comments of a post returned by the repository
+// in the default order.
+func withSortedComments(post *entity.Post, err error) (*entity.Post, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	sortComments(post.Comments, commentSorts[defaultCommentSort])
+	return post, nil
+}
+
+// Get returns the post requested by the user (0 for anonymous users) with
+// comments sorted by commentSort, empty means the default order.
+func (s *PostService) Get(id, userID int, commentSort string) (*entity.Post, error) {
+	if commentSort == "" {
+		commentSort = defaultCommentSort
+	}
+	less, ok := commentSorts[commentSort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	post, err := s.repo.Get(id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sortComments(post.Comments, less)
+	return post, nil
+}
+
+func (s *PostService) GetByCategory(category string, opts ListOptions) (*entity.PostList, error) {
+	q, err := s.newPostQuery(SortTop, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := s.repo.GetByCategory(category, q)
+	if err != nil {
+		return nil, err
+	}
+
+	list := newPostList(posts, q)
+	if q.After == nil {
+		pinned, err := s.repo.GetPinned(category, opts.UserID)
+		if err != nil {
+			return nil, err
+		}
+		for _, post := range pinned {
+			sortComments(post.Comments, commentSorts[defaultCommentSort])
+		}
+		list.Pinned = pinned
+	}
+
+	return list, nil
 }
 
-func (s *PostService) GetByCategory(category string) ([]*entity.Post, error) {
-	posts, err := s.repo.GetByCategory(category)
+// GetFeed lists the posts of the communities the user (opts.UserID) is
+// subscribed to, ranked like GetAll.
+func (s *PostService) GetFeed(opts ListOptions) (*entity.PostList, error) {
+	q, err := s.newPostQuery(SortTop, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].Score > posts[j].Score
-	})
+	posts, err := s.repo.GetFeed(opts.UserID, s.defaultFeed, q)
+	if err != nil {
+		return nil, err
+	}
 
-	return posts, nil
+	return newPostList(posts, q), nil
 }
-func (s *PostService) GetByUsername(username string) ([]*entity.Post, error) {
-	posts, err := s.repo.GetByUsername(username)
+
+func (s *PostService) GetByUsername(username string, opts ListOptions) (*entity.PostList, error) {
+	q, err := s.newPostQuery(SortNew, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	sort.Slice(posts, func(i, j int) bool {
-		return posts[i].Created.After(posts[j].Created)
-	})
+	posts, err := s.repo.GetByUsername(username, q)
+	if err != nil {
+		return nil, err
+	}
 
-	return posts, nil
+	return newPostList(posts, q), nil
 }
 
-func (s *PostService) Add(
-	typ, category, title, text, url string,
-	author *entity.User,
-) (*entity.Post, error) {
+func validatePost(title, text, url string) error {
 	if validation.Validate(title, validation.Length(1, 1<<10)) != nil {
-		return nil, ErrInvalidTitle
+		return ErrInvalidTitle
 	}
 	if url != "" && validation.Validate(url, is.URL) != nil {
-		return nil, ErrInvalidURL
+		return ErrInvalidURL
 	} else if validation.Validate(text, validation.Length(4, 1<<20)) != nil {
-		return nil, ErrInvalidText
+		return ErrInvalidText
+	}
+
+	return nil
+}
+
+// validatePostType checks the url against the type of the post: link posts
+// have one, text posts have none.
+func validatePostType(typ, url string) error {
+	switch {
+	case typ == postTypeLink && url == "":
+		return ErrInvalidURL
+	case typ == postTypeText && url != "":
+		return ErrInvalidURL
+	}
+
+	return nil
+}
+
+func (s *PostService) Add(
+	typ, category, title, text, url string,
+	author *entity.User,
+) (*entity.Post, error) {
+	if err := validatePost(title, text, url); err != nil {
+		return nil, err
 	}
 
 	post := &entity.Post{
@@ -117,6 +235,8 @@ func (s *PostService) Add(
 			},
 		},
 		Comments: []*entity.Comment{},
+		Upvotes:  1,
+		Score:    upvote,
 	}
 
 	post, err := s.repo.Add(post)
@@ -124,35 +244,171 @@ func (s *PostService) Add(
 		return nil, err
 	}
 
-	post.CalcAndSetScore()
 	post.CalcAndSetUpvotePercentage()
 
 	return post, nil
 }
 
+// Update replaces the title, text and url of the post, the previous version
+// is kept in the revision history. The url must fit the type of the post.
+func (s *PostService) Update(postID, userID int, title, text, url string) (*entity.Post, error) {
+	if err := validatePost(title, text, url); err != nil {
+		return nil, err
+	}
+
+	typ, err := s.repo.GetPostType(postID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validatePostType(typ, url); err != nil {
+		return nil, err
+	}
+
+	return withSortedComments(s.repo.Update(postID, userID, title, text, url))
+}
+
+// GetRevisions returns the revisions of the post requested by the user (0 for
+// anonymous users).
+func (s *PostService) GetRevisions(postID, userID int) ([]*entity.PostRevision, error) {
+	return s.repo.GetRevisions(postID, userID)
+}
+
 func (s *PostService) Upvote(postID, userID int) (*entity.Post, error) {
-	return s.repo.AddVote(postID, userID, upvote)
+	return withSortedComments(s.repo.AddVote(postID, userID, upvote))
 }
 
 func (s *PostService) Downvote(postID, userID int) (*entity.Post, error) {
-	return s.repo.AddVote(postID, userID, downvote)
+	return withSortedComments(s.repo.AddVote(postID, userID, downvote))
 }
 
 func (s *PostService) Unvote(postID, userID int) (*entity.Post, error) {
-	return s.repo.DeleteVote(postID, userID)
+	return withSortedComments(s.repo.DeleteVote(postID, userID))
 }
 
-func (s *PostService) AddComment(postID, userID int, body string) (*entity.Post, error) {
+// AddComment adds a comment to the post, parentID is the comment replied to
+// or 0 for a top level comment.
+func (s *PostService) AddComment(postID, userID, parentID int, body string) (*entity.Post, error) {
 	if validation.Validate(body, validation.Length(1, 1<<20)) != nil {
 		return nil, ErrInvalidBody
 	}
-	return s.repo.AddComment(postID, userID, body)
+	return withSortedComments(s.repo.AddComment(postID, userID, parentID, body))
+}
+
+// GetComment returns the comment with its replies down to depth levels
+// (0 means CommentDepth) sorted by commentSort.
+func (s *PostService) GetComment(postID, commentID, userID, depth int, commentSort string) (*entity.Comment, error) {
+	if depth == 0 {
+		depth = CommentDepth
+	}
+	if depth < 1 || depth > maxCommentDepth {
+		return nil, ErrInvalidDepth
+	}
+	if commentSort == "" {
+		commentSort = defaultCommentSort
+	}
+	less, ok := commentSorts[commentSort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	comment, err := s.repo.GetComment(postID, commentID, userID, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	sortComments(comment.Replies, less)
+	return comment, nil
+}
+
+// UpdateComment replaces the body of the comment, the previous version is
+// kept in the revision history.
+func (s *PostService) UpdateComment(postID, commentID, userID int, body string) (*entity.Post, error) {
+	if validation.Validate(body, validation.Length(1, 1<<20)) != nil {
+		return nil, ErrInvalidBody
+	}
+	return withSortedComments(s.repo.UpdateComment(postID, commentID, userID, body))
+}
+
+// GetCommentRevisions returns the revisions of the comment requested by the
+// user (0 for anonymous users).
+func (s *PostService) GetCommentRevisions(postID, commentID, userID int) ([]*entity.CommentRevision, error) {
+	return s.repo.GetCommentRevisions(postID, commentID, userID)
+}
+
+// DeleteComment marks the comment as deleted, its replies stay in the tree.
+// The author and the moderators of the community are allowed to, removals by
+// moderators are recorded in the moderation log.
+func (s *PostService) DeleteComment(postID, commentID int, user *entity.User) (*entity.Post, error) {
+	authorID, category, err := s.repo.GetCommentOwner(postID, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if !canRemove(user, authorID, category) {
+		return nil, ErrUnauthorized
+	}
+
+	return withSortedComments(s.repo.DeleteComment(postID, commentID, user.ID, user.ID != authorID))
+}
+
+func (s *PostService) UpvoteComment(postID, commentID, userID int) (*entity.Post, error) {
+	return withSortedComments(s.repo.AddCommentVote(postID, commentID, userID, upvote))
+}
+
+func (s *PostService) DownvoteComment(postID, commentID, userID int) (*entity.Post, error) {
+	return withSortedComments(s.repo.AddCommentVote(postID, commentID, userID, downvote))
+}
+
+func (s *PostService) UnvoteComment(postID, commentID, userID int) (*entity.Post, error) {
+	return withSortedComments(s.repo.DeleteCommentVote(postID, commentID, userID))
+}
+
+// Delete deletes the post, the author and the moderators of the community
+// are allowed to. Removals by moderators are recorded in the moderation log.
+func (s *PostService) Delete(postID int, user *entity.User) error {
+	authorID, category, err := s.repo.GetPostOwner(postID)
+	if err != nil {
+		return err
+	}
+	if !canRemove(user, authorID, category) {
+		return ErrUnauthorized
+	}
+
+	return s.repo.Delete(postID, user.ID, user.ID != authorID)
+}
+
+// moderatePost applies the change to the post if the user moderates its
+// community.
+func (s *PostService) moderatePost(
+	postID int,
+	user *entity.User,
+	change func(postID, userID int, value bool) (*entity.Post, error),
+	value bool,
+) (*entity.Post, error) {
+	_, category, err := s.repo.GetPostOwner(postID)
+	if err != nil {
+		return nil, err
+	}
+	if !canModerate(user, category) {
+		return nil, ErrUnauthorized
+	}
+
+	return withSortedComments(change(postID, user.ID, value))
+}
+
+// Lock closes the post for new comments.
+func (s *PostService) Lock(postID int, user *entity.User) (*entity.Post, error) {
+	return s.moderatePost(postID, user, s.repo.SetLocked, true)
+}
+
+func (s *PostService) Unlock(postID int, user *entity.User) (*entity.Post, error) {
+	return s.moderatePost(postID, user, s.repo.SetLocked, false)
 }
 
-func (s *PostService) DeleteComment(postId, commentID, userID int) (*entity.Post, error) {
-	return s.repo.DeleteComment(postId, commentID, userID)
+// Pin shows the post on top of the first page of its community listing.
+func (s *PostService) Pin(postID int, user *entity.User) (*entity.Post, error) {
+	return s.moderatePost(postID, user, s.repo.SetPinned, true)
 }
 
-func (s *PostService) Delete(postID, userID int) error {
-	return s.repo.Delete(postID, userID)
+func (s *PostService) Unpin(postID int, user *entity.User) (*entity.Post, error) {
+	return s.moderatePost(postID, user, s.repo.SetPinned, false)
 }
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/s02190058/spa/internal/entity"
+)
+
+const (
+	SortHot           = "hot"
+	SortNew           = "new"
+	SortTop           = "top"
+	SortRising        = "rising"
+	SortControversial = "controversial"
+)
+
+const (
+	CommentSortBest          = "best"
+	CommentSortTop           = "top"
+	CommentSortNew           = "new"
+	CommentSortControversial = "controversial"
+)
+
+var (
+	ErrInvalidSort        = errors.New("invalid sort")
+	ErrInvalidPeriod      = errors.New("invalid period")
+	ErrPeriodNotSupported = errors.New("period not supported by the sort")
+)
+
+// Ranker defines the order of a post listing. The ranking is done by the
+// storage, so a ranker is given by an SQL expression over the columns:
+//
+//	score     - upvotes minus downvotes
+//	upvotes   - number of upvotes
+//	downvotes - number of downvotes
+//	created   - creation time of the post, seconds since the epoch
+//	now       - reference time of the listing, seconds since the epoch
+//
+// Posts with a higher rank are listed first.
+type Ranker interface {
+	Expr() string
+}
+
+// RankExpr is a Ranker given by a constant expression.
+type RankExpr string
+
+func (e RankExpr) Expr() string {
+	return string(e)
+}
+
+type periodRanker struct {
+	Ranker
+}
+
+// WithPeriod limits the ranker to the posts created within the period chosen
+// by the client (ListOptions.Period).
+func WithPeriod(r Ranker) Ranker {
+	return periodRanker{
+		Ranker: r,
+	}
+}
+
+// periods are the values of ListOptions.Period, zero means no limit
+var periods = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+var (
+	// rankNew lists the most recent posts first.
+	rankNew = RankExpr("created")
+
+	// rankTop lists the posts with the highest score first.
+	rankTop = RankExpr("score")
+
+	// rankHot is the reddit formula: the order of magnitude of the score plus
+	// a bonus for the post age, 10 votes are worth 12.5 hours.
+	rankHot = RankExpr("sign(score::float8) * log(greatest(abs(score), 1)::float8) + (created - 1134028003) / 45000")
+
+	// rankRising decays the score with the post age in hours (gravity 1.8).
+	rankRising = RankExpr("(score - 1) / power(greatest(now - created, 0) / 3600 + 2, 1.8)")
+
+	// rankControversial favours posts with many votes split evenly.
+	rankControversial = RankExpr("CASE WHEN upvotes = 0 OR downvotes = 0 THEN 0 " +
+		"ELSE power(upvotes + downvotes, least(upvotes, downvotes)::float8 / greatest(upvotes, downvotes)) END")
+)
+
+func defaultRankers() map[string]Ranker {
+	return map[string]Ranker{
+		SortHot:           rankHot,
+		SortNew:           rankNew,
+		SortTop:           WithPeriod(rankTop),
+		SortRising:        rankRising,
+		SortControversial: rankControversial,
+	}
+}
+
+// RegisterRanker makes the ranker available for listings as sort=name,
+// replacing the previous ranker with the same name.
+func (s *PostService) RegisterRanker(name string, r Ranker) {
+	s.rankers[name] = r
+}
+
+// ranking resolves the sort options of a listing into the rank expression and
+// the lowest creation time of listed posts.
+func (s *PostService) ranking(defaultSort string, opts ListOptions, now time.Time) (string, time.Time, error) {
+	name := opts.Sort
+	if name == "" {
+		name = defaultSort
+	}
+
+	r, ok := s.rankers[name]
+	if !ok {
+		return "", time.Time{}, ErrInvalidSort
+	}
+
+	if opts.Period == "" {
+		return r.Expr(), time.Time{}, nil
+	}
+	// only the period rankers limit the listing by time
+	if _, ok := r.(periodRanker); !ok {
+		return "", time.Time{}, ErrPeriodNotSupported
+	}
+
+	period, ok := periods[opts.Period]
+	if !ok {
+		return "", time.Time{}, ErrInvalidPeriod
+	}
+
+	var since time.Time
+	if period > 0 {
+		since = now.Add(-period)
+	}
+
+	return r.Expr(), since, nil
+}
+
+// commentLess reports whether the comment a goes before b among replies to
+// the same parent. Comments are not paginated, so they are sorted in memory.
+type commentLess func(a, b *entity.Comment) bool
+
+var commentSorts = map[string]commentLess{
+	CommentSortBest: func(a, b *entity.Comment) bool {
+		return wilsonScore(a.Upvotes, a.Downvotes) > wilsonScore(b.Upvotes, b.Downvotes)
+	},
+	CommentSortTop: func(a, b *entity.Comment) bool {
+		return a.Score > b.Score
+	},
+	CommentSortNew: func(a, b *entity.Comment) bool {
+		return a.Created.After(b.Created)
+	},
+	CommentSortControversial: func(a, b *entity.Comment) bool {
+		return controversy(a.Upvotes, a.Downvotes) > controversy(b.Upvotes, b.Downvotes)
+	},
+}
+
+// wilsonScore is the lower bound of the Wilson score confidence interval
+// (80% confidence) for the share of upvotes.
+func wilsonScore(upvotes, downvotes int) float64 {
+	n := float64(upvotes + downvotes)
+	if n == 0 {
+		return 0
+	}
+
+	const z = 1.281551565545
+	p := float64(upvotes) / n
+	return (p + z*z/(2*n) - z*math.Sqrt((p*(1-p)+z*z/(4*n))/n)) / (1 + z*z/n)
+}
+
+// controversy is the Go counterpart of rankControversial.
+func controversy(upvotes, downvotes int) float64 {
+	if upvotes == 0 || downvotes == 0 {
+		return 0
+	}
+
+	balance := float64(upvotes) / float64(downvotes)
+	if upvotes > downvotes {
+		balance = float64(downvotes) / float64(upvotes)
+	}
+	return math.Pow(float64(upvotes+downvotes), balance)
+}
+
+// sortComments sorts every level of the comment trees, ties keep the order
+// of the repository (oldest first).
+func sortComments(comments []*entity.Comment, less commentLess) {
+	sort.SliceStable(comments, func(i, j int) bool {
+		return less(comments[i], comments[j])
+	})
+	for _, comment := range comments {
+		sortComments(comment.Replies, less)
+	}
+}
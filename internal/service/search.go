@@ -0,0 +1,153 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/s02190058/spa/internal/entity"
+)
+
+const (
+	maxSearchQuery = 256
+	maxSearchTerms = 16
+)
+
+var (
+	ErrInvalidQuery = errors.New("invalid search query")
+	ErrInvalidRange = errors.New("invalid date range")
+)
+
+const (
+	TermWord = iota
+	TermPhrase
+	TermPrefix
+)
+
+// SearchTerm is a part of a search query: a word, a "quoted phrase" whose
+// words must follow each other or a prefix* matching any word starting
+// with it.
+type SearchTerm struct {
+	Kind int
+	Text string
+}
+
+// SearchOptions are the client supplied parameters of a search. Category
+// and Author narrow the results down, From and To limit the creation time
+// of the results unless they are zero. UserID is the searching user, zero
+// for anonymous users.
+type SearchOptions struct {
+	Query    string
+	Category string
+	Author   string
+	From     time.Time
+	To       time.Time
+	Cursor   string
+	Limit    int
+	UserID   int
+}
+
+// SearchQuery describes a single page of search results for the repository.
+// Results are matching all the terms and are ordered by (Rank, Key)
+// descending, where Rank is the text search rank and Key tells posts and
+// comments apart. Cursor.ID holds the Key of the last result.
+type SearchQuery struct {
+	Terms    []SearchTerm
+	Category string
+	Author   string
+	From     time.Time
+	To       time.Time
+	After    *Cursor
+	Limit    int
+	UserID   int
+}
+
+// parseSearchQuery splits the query into terms. Prefixes are reduced to
+// letters and digits, so they can be safely passed to the storage.
+func parseSearchQuery(query string) []SearchTerm {
+	var terms []SearchTerm
+
+	for i, part := range strings.Split(query, `"`) {
+		if i%2 == 1 {
+			if strings.TrimSpace(part) != "" {
+				terms = append(terms, SearchTerm{Kind: TermPhrase, Text: part})
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(part) {
+			if !strings.HasSuffix(word, "*") {
+				terms = append(terms, SearchTerm{Kind: TermWord, Text: word})
+				continue
+			}
+
+			prefix := strings.Map(func(r rune) rune {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					return unicode.ToLower(r)
+				}
+				return -1
+			}, word)
+			if prefix != "" {
+				terms = append(terms, SearchTerm{Kind: TermPrefix, Text: prefix})
+			}
+		}
+	}
+
+	return terms
+}
+
+// Search returns the posts and comments matching the query, the best
+// matches first.
+func (s *PostService) Search(opts SearchOptions) (*entity.SearchResults, error) {
+	if len(opts.Query) > maxSearchQuery {
+		return nil, ErrInvalidQuery
+	}
+
+	terms := parseSearchQuery(opts.Query)
+	if len(terms) == 0 || len(terms) > maxSearchTerms {
+		return nil, ErrInvalidQuery
+	}
+
+	if !opts.From.IsZero() && !opts.To.IsZero() && !opts.From.Before(opts.To) {
+		return nil, ErrInvalidRange
+	}
+
+	after, limit, err := page(opts.Cursor, opts.Limit)
+	if err != nil {
+		return nil, err
+	}
+	// the cursors of the post listings name their sort, search ones do not
+	if after != nil && after.Sort != "" {
+		return nil, ErrInvalidCursor
+	}
+
+	results, err := s.repo.Search(SearchQuery{
+		Terms:    terms,
+		Category: opts.Category,
+		Author:   opts.Author,
+		From:     opts.From,
+		To:       opts.To,
+		After:    after,
+		Limit:    limit,
+		UserID:   opts.UserID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := &entity.SearchResults{
+		Results: results,
+	}
+
+	if len(results) == limit {
+		list.Results = results[:limit-1]
+		last := list.Results[len(list.Results)-1]
+		list.NextCursor = encodeCursor(&Cursor{
+			Rank: last.Rank,
+			ID:   last.Key,
+		})
+	}
+
+	return list, nil
+}
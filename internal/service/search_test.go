@@ -0,0 +1,89 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []SearchTerm
+	}{
+		{
+			name:  "empty",
+			query: "  ",
+			want:  nil,
+		},
+		{
+			name:  "words",
+			query: "single  page app",
+			want: []SearchTerm{
+				{Kind: TermWord, Text: "single"},
+				{Kind: TermWord, Text: "page"},
+				{Kind: TermWord, Text: "app"},
+			},
+		},
+		{
+			name:  "phrase and words",
+			query: `go "single page" app`,
+			want: []SearchTerm{
+				{Kind: TermWord, Text: "go"},
+				{Kind: TermPhrase, Text: "single page"},
+				{Kind: TermWord, Text: "app"},
+			},
+		},
+		{
+			name:  "empty phrase",
+			query: `"  " app`,
+			want: []SearchTerm{
+				{Kind: TermWord, Text: "app"},
+			},
+		},
+		{
+			name:  "unclosed phrase",
+			query: `app "single page`,
+			want: []SearchTerm{
+				{Kind: TermWord, Text: "app"},
+				{Kind: TermPhrase, Text: "single page"},
+			},
+		},
+		{
+			name:  "prefix",
+			query: "App*",
+			want: []SearchTerm{
+				{Kind: TermPrefix, Text: "app"},
+			},
+		},
+		{
+			name:  "prefix without operators",
+			query: "a:b&c|!d'*",
+			want: []SearchTerm{
+				{Kind: TermPrefix, Text: "abcd"},
+			},
+		},
+		{
+			name:  "prefix of nothing",
+			query: "&* app",
+			want: []SearchTerm{
+				{Kind: TermWord, Text: "app"},
+			},
+		},
+		{
+			name:  "unicode prefix",
+			query: "Привет*",
+			want: []SearchTerm{
+				{Kind: TermPrefix, Text: "привет"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseSearchQuery(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSearchQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/s02190058/spa/internal/entity"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// newToken returns a random opaque token and its hash, only the hash is
+// stored.
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hash of an opaque token. The tokens are random, so
+// a fast hash is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createTokens issues the tokens of the session: an access token bound to
+// the session and the refresh token.
+func (s *UserService) createTokens(session int, user *entity.User, refreshToken string) (*entity.Tokens, error) {
+	token, err := s.tokenManager.Create(strconv.Itoa(session), withRole(user))
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	return &entity.Tokens{
+		Token:        token,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// startSession logs the user in on the client.
+func (s *UserService) startSession(user *entity.User, client entity.Client) (*entity.Tokens, error) {
+	refreshToken, refreshHash, err := newToken()
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	session, err := s.repo.AddSession(user.ID, refreshHash, time.Now().Add(s.opts.RefreshTTL), client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createTokens(session.ID, user, refreshToken)
+}
+
+// Refresh exchanges the refresh token for new tokens, the refresh token can
+// not be used again. The access token carries the current role of the user.
+func (s *UserService) Refresh(refreshToken string, client entity.Client) (*entity.Tokens, error) {
+	newRefreshToken, newHash, err := newToken()
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	session, err := s.repo.RotateSession(hashToken(refreshToken), newHash, time.Now().Add(s.opts.RefreshTTL), client)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.createTokens(session.ID, user, newRefreshToken)
+}
+
+// CheckSession checks that the session of an access token is not revoked.
+func (s *UserService) CheckSession(id int) error {
+	return s.repo.CheckSession(id)
+}
+
+// GetSessions lists the active sessions of the user, current is the session
+// of the request.
+func (s *UserService) GetSessions(userID, current int) ([]*entity.Session, error) {
+	sessions, err := s.repo.GetSessions(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		session.Current = session.ID == current
+	}
+
+	return sessions, nil
+}
+
+// Logout revokes the session of the user, its tokens stop working at once.
+func (s *UserService) Logout(id, userID int) error {
+	return s.repo.RevokeSession(id, userID)
+}
+
+// LogoutAll revokes all the sessions of the user.
+func (s *UserService) LogoutAll(userID int) error {
+	return s.repo.RevokeSessions(userID, 0)
+}
+
+// SessionUse is the last use of a session by a client.
+type SessionUse struct {
+	ID int
+	entity.Client
+	Time time.Time
+}
+
+type sessionUseRepo interface {
+	UpdateSessionUses(uses []SessionUse) error
+}
+
+// SessionTracker records the uses of the sessions. The uses are collected
+// in memory and written in batches, only the last use of a session in a
+// batch is written.
+type SessionTracker struct {
+	repo   sessionUseRepo
+	period time.Duration
+
+	mu   sync.Mutex
+	uses map[int]SessionUse
+
+	done chan struct{}
+}
+
+func NewSessionTracker(repo sessionUseRepo, period time.Duration) *SessionTracker {
+	return &SessionTracker{
+		repo:   repo,
+		period: period,
+		uses:   make(map[int]SessionUse),
+		done:   make(chan struct{}),
+	}
+}
+
+// Touch records a use of the session by the client.
+func (t *SessionTracker) Touch(id int, client entity.Client) {
+	t.mu.Lock()
+	t.uses[id] = SessionUse{
+		ID:     id,
+		Client: client,
+		Time:   time.Now(),
+	}
+	t.mu.Unlock()
+}
+
+// Flush writes the collected uses.
+func (t *SessionTracker) Flush() error {
+	t.mu.Lock()
+	uses := make([]SessionUse, 0, len(t.uses))
+	for _, use := range t.uses {
+		uses = append(uses, use)
+	}
+	t.uses = make(map[int]SessionUse)
+	t.mu.Unlock()
+
+	if len(uses) == 0 {
+		return nil
+	}
+
+	return t.repo.UpdateSessionUses(uses)
+}
+
+// Start writes the uses every period until Stop.
+func (t *SessionTracker) Start(notify func(error)) {
+	go func() {
+		ticker := time.NewTicker(t.period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := t.Flush(); err != nil {
+					notify(err)
+				}
+			case <-t.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic writes and writes the uses left.
+func (t *SessionTracker) Stop() error {
+	close(t.done)
+	return t.Flush()
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/pkg/totp"
+)
+
+var (
+	ErrTwoFactorEnabled  = errors.New("two-factor authentication already enabled")
+	ErrTwoFactorDisabled = errors.New("two-factor authentication not enabled")
+	ErrInvalidCode       = errors.New("invalid code")
+	ErrInvalidChallenge  = errors.New("invalid challenge")
+)
+
+const (
+	// challengeTTL is the time to enter the code after the password.
+	challengeTTL = 5 * time.Minute
+	// maxChallengeAttempts limits the guesses of a code per challenge.
+	maxChallengeAttempts = 5
+	// totpSkew is the number of time steps a code may be late or early.
+	totpSkew = 1
+	// recoveryCodes is the number of recovery codes given on enrollment.
+	recoveryCodes = 10
+)
+
+// RecoveryCode is a stored recovery code, only its hash is kept. The codes
+// are random, so they are hashed like the tokens, see hashToken. The codes
+// given before were hashed like the passwords.
+type RecoveryCode struct {
+	ID   int
+	Hash string
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// isPasswordHash reports whether the recovery code was hashed like the
+// passwords, the PHC strings and the bcrypt hashes start with "$".
+func isPasswordHash(hash string) bool {
+	return strings.HasPrefix(hash, "$")
+}
+
+// newRecoveryCode returns a random code of 10 characters written as
+// xxxxx-xxxxx.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(recoveryEncoding.EncodeToString(b)[:10])
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode drops the separators and the case, so that the code
+// may be typed in either way.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// EnrollTOTP starts the enrollment of the user: a new secret is generated,
+// it is used after the user confirms it with a code.
+func (s *UserService) EnrollTOTP(user *entity.User) (*entity.TOTPEnrollment, error) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	if err := s.repo.SetTOTPSecret(user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &entity.TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.opts.TOTPIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables two-factor authentication once the code of the
+// enrolled secret is correct. The recovery codes are returned only here.
+func (s *UserService) ConfirmTOTP(userID int, code string) ([]string, error) {
+	secret, enabled, err := s.repo.GetTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if secret == "" {
+		return nil, ErrTwoFactorDisabled
+	}
+
+	step, ok := totp.Validate(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	codes := make([]string, 0, recoveryCodes)
+	hashes := make([]string, 0, recoveryCodes)
+	for i := 0; i < recoveryCodes; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, ErrInternal
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+
+	if err := s.repo.EnableTOTP(userID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns two-factor authentication off, a code is required.
+// Wrong codes count toward the lockout like wrong passwords.
+func (s *UserService) DisableTOTP(userID int, code string, client entity.Client) error {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.verifyCode(user, code, client); err != nil {
+		return err
+	}
+
+	return s.repo.DisableTOTP(userID)
+}
+
+// verifyCode checks the code of the user from the client. The wrong codes
+// are counted as failed logins of the username, the failures are forgotten
+// once a code passes.
+func (s *UserService) verifyCode(user *entity.User, code string, client entity.Client) error {
+	if err := s.checkLockout(user.Username, client); err != nil {
+		return err
+	}
+
+	if err := s.checkCode(user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			if err := s.loginFailed(user.Username, client); err != nil {
+				return err
+			}
+		}
+		return err
+	}
+
+	return s.loginSucceeded(user.Username)
+}
+
+// checkCode checks a TOTP code or a recovery code of the user. Each code
+// passes once.
+func (s *UserService) checkCode(userID int, code string) error {
+	secret, enabled, err := s.repo.GetTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTwoFactorDisabled
+	}
+
+	if step, ok := totp.Validate(secret, code, time.Now(), totpSkew); ok {
+		return s.repo.UseTOTPStep(userID, step)
+	}
+
+	codes, err := s.repo.GetRecoveryCodes(userID)
+	if err != nil {
+		return err
+	}
+
+	code = normalizeRecoveryCode(code)
+	hash := hashToken(code)
+	for _, c := range codes {
+		if subtle.ConstantTimeCompare([]byte(c.Hash), []byte(hash)) == 1 ||
+			isPasswordHash(c.Hash) && s.passwordHasher.Compare(c.Hash, code) {
+			return s.repo.UseRecoveryCode(c.ID)
+		}
+	}
+
+	return ErrInvalidCode
+}
+
+// startChallenge is the first step of the login of a user with two-factor
+// authentication.
+func (s *UserService) startChallenge(userID int) (*entity.Tokens, error) {
+	challenge, hash, err := newToken()
+	if err != nil {
+		return nil, ErrInternal
+	}
+
+	if err := s.repo.AddChallenge(userID, hash, time.Now().Add(challengeTTL)); err != nil {
+		return nil, err
+	}
+
+	return &entity.Tokens{
+		Challenge: challenge,
+	}, nil
+}
+
+// SignInWithCode is the second step of the login: the challenge of the
+// first step is exchanged for the tokens with a TOTP code or a recovery
+// code. Wrong codes count toward the lockout like wrong passwords.
+func (s *UserService) SignInWithCode(challenge, code string, client entity.Client) (*entity.Tokens, error) {
+	hash := hashToken(challenge)
+	userID, err := s.repo.UseChallenge(hash, maxChallengeAttempts)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyCode(user, code, client); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.DeleteChallenge(hash); err != nil {
+		return nil, err
+	}
+
+	return s.startSession(user, client)
+}
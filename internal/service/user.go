@@ -2,11 +2,14 @@ package service
 
 import (
 	"errors"
+	"time"
+
 	validation "github.com/go-ozzo/ozzo-validation"
 	"github.com/go-ozzo/ozzo-validation/is"
 	"github.com/s02190058/spa/internal/entity"
 	"github.com/s02190058/spa/pkg/hasher"
 	"github.com/s02190058/spa/pkg/jwt"
+	"github.com/s02190058/spa/pkg/mailer"
 )
 
 var (
@@ -20,65 +23,192 @@ var (
 type userRepo interface {
 	Add(user *entity.User) (*entity.User, error)
 	GetByUsername(username string) (*entity.User, error)
+	GetByID(id int) (*entity.User, error)
+	SetRole(username, role string) error
+	AddSession(userID int, refreshHash string, expires time.Time, client entity.Client) (*entity.Session, error)
+	RotateSession(refreshHash, newHash string, expires time.Time, client entity.Client) (*entity.Session, error)
+	GetSessions(userID int) ([]*entity.Session, error)
+	CheckSession(id int) error
+	RevokeSession(id, userID int) error
+	RevokeSessions(userID, keepID int) error
+	SetTOTPSecret(userID int, secret string) error
+	GetTOTP(userID int) (string, bool, error)
+	EnableTOTP(userID int, step int64, codeHashes []string) error
+	UseTOTPStep(userID int, step int64) error
+	GetRecoveryCodes(userID int) ([]RecoveryCode, error)
+	UseRecoveryCode(id int) error
+	DisableTOTP(userID int) error
+	AddChallenge(userID int, hash string, expires time.Time) error
+	UseChallenge(hash string, maxAttempts int) (int, error)
+	DeleteChallenge(hash string) error
+	SetPassword(userID int, encryptedPassword string, keepSession int) error
+	RehashPassword(userID int, encryptedPassword, newEncryptedPassword string) error
+	SetEmail(userID int, email string) error
+	VerifyEmail(userID int, email string) error
+	AddPasswordReset(userID int, hash string, expires, since time.Time) (bool, error)
+	GetPasswordReset(hash string) (int, error)
+	ResetPassword(hash, encryptedPassword string) error
+	DeleteUser(userID int, name string, cascade bool) error
+	GetLockout(keys []string) (time.Time, error)
+	AddLoginFailure(key string, since time.Time) (int, error)
+	LockLogin(key string, until time.Time) error
+	ClearLoginFailures(key string, since time.Time) error
+	AddOIDCState(hash string, state *OIDCState, expires time.Time) error
+	UseOIDCState(hash string) (*OIDCState, error)
+	GetByIdentity(provider, subject string) (*entity.User, error)
+	AddIdentity(userID int, provider, subject, email string) error
+	AddUserWithIdentity(user *entity.User, provider, subject string) (*entity.User, error)
+	GetIdentities(userID int) ([]*entity.Identity, error)
+	DeleteIdentity(userID int, provider string) error
+	AddAPIKey(key *entity.APIKey, hash string, max int) (*entity.APIKey, error)
+	GetAPIKeys(userID int) ([]*entity.APIKey, error)
+	DeleteAPIKey(id, userID int) error
+	GetAPIKey(hash string) (*entity.APIKey, error)
+}
+
+// UserOptions configure the UserService. Sessions last for RefreshTTL since
+// the last refresh, TOTPIssuer names the service in the authenticator apps,
+// the password reset token is appended to ResetURL, the email verification
+// token, signed with VerificationKey, to VerifyURL, Deletion is
+// DeletionAnonymize or DeletionCascade, Lockout protects the logins,
+// Password screens the new passwords and OIDC configures the logins with
+// OpenID Connect providers.
+type UserOptions struct {
+	RefreshTTL      time.Duration
+	TOTPIssuer      string
+	ResetURL        string
+	VerifyURL       string
+	VerificationKey string
+	Deletion        string
+	Lockout         LockoutPolicy
+	Password        PasswordPolicy
+	OIDC            OIDCOptions
 }
 
 type UserService struct {
 	repo           userRepo
 	tokenManager   *jwt.TokenManager
-	passwordHasher *hasher.Hasher
+	passwordHasher hasher.Hasher
+	mailer         mailer.Mailer
+	opts           UserOptions
 }
 
-func NewUserService(repo userRepo, tokenManager *jwt.TokenManager, hasher *hasher.Hasher) *UserService {
+func NewUserService(
+	repo userRepo,
+	tokenManager *jwt.TokenManager,
+	hasher hasher.Hasher,
+	mailer mailer.Mailer,
+	opts UserOptions,
+) *UserService {
 	return &UserService{
 		repo:           repo,
 		tokenManager:   tokenManager,
 		passwordHasher: hasher,
+		mailer:         mailer,
+		opts:           opts,
 	}
 }
 
-func (s *UserService) SignUp(username, password string) (string, error) {
+// SignUp registers the user, the email is optional. A link confirming the
+// email is sent to it.
+func (s *UserService) SignUp(username, password, email string, client entity.Client) (*entity.Tokens, error) {
 	if validation.Validate(username, validation.Length(1, 32), is.PrintableASCII) != nil {
-		return "", ErrInvalidUsername
+		return nil, ErrInvalidUsername
 	}
-	if validation.Validate(password, validation.Length(8, 72)) != nil {
-		return "", ErrInvalidPassword
+	if err := s.checkPassword(username, password); err != nil {
+		return nil, err
+	}
+	if email != "" {
+		if err := validateEmail(email); err != nil {
+			return nil, err
+		}
 	}
 
 	encryptedPassword, err := s.passwordHasher.Encrypt(password)
 	if err != nil {
-		return "", ErrInternal
+		return nil, ErrInternal
 	}
 
 	user, err := s.repo.Add(&entity.User{
 		Username:          username,
 		EncryptedPassword: encryptedPassword,
+		Email:             email,
 	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	tokenString, err := s.tokenManager.Create(user)
-	if err != nil {
-		return "", ErrInternal
+	if email != "" {
+		// the account is created anyway, the link can be sent again
+		_ = s.sendVerification(user)
 	}
 
-	return tokenString, nil
+	return s.startSession(user, client)
 }
 
-func (s *UserService) SignIn(username, password string) (string, error) {
+// SignIn logs the user in. Unknown users and wrong passwords are not told
+// apart, too many failures lock the logins of the username or the client
+// out for a while.
+func (s *UserService) SignIn(username, password string, client entity.Client) (*entity.Tokens, error) {
+	if err := s.checkLockout(username, client); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repo.GetByUsername(username)
-	if err != nil {
-		return "", err
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, err
+	}
+
+	if user == nil {
+		s.compareDummy(password)
+	}
+	if user == nil || !s.passwordHasher.Compare(user.EncryptedPassword, password) {
+		if err := s.loginFailed(username, client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	s.rehash(user, password)
+
+	// the failures of the username are forgotten once the second factor
+	// passes, see verifyCode
+	if user.TOTPEnabled {
+		return s.startChallenge(user.ID)
+	}
+
+	if err := s.loginSucceeded(username); err != nil {
+		return nil, err
 	}
 
-	if !s.passwordHasher.Compare(user.EncryptedPassword, password) {
-		return "", ErrWrongPassword
+	return s.startSession(user, client)
+}
+
+// rehash replaces the hash of the password made with an outdated algorithm
+// or parameters. The login goes on if it fails, the hash is replaced on the
+// next one.
+func (s *UserService) rehash(user *entity.User, password string) {
+	if !s.passwordHasher.NeedsRehash(user.EncryptedPassword) {
+		return
 	}
 
-	tokenString, err := s.tokenManager.Create(user)
+	encryptedPassword, err := s.passwordHasher.Encrypt(password)
 	if err != nil {
-		return "", ErrInternal
+		return
+	}
+
+	_ = s.repo.RehashPassword(user.ID, user.EncryptedPassword, encryptedPassword)
+}
+
+// SetRole makes the user an admin (entity.RoleAdmin) or takes the admin role
+// away (entity.RoleUser), only admins are allowed to.
+func (s *UserService) SetRole(actor *entity.User, username, role string) error {
+	if !isAdmin(actor) {
+		return ErrUnauthorized
+	}
+	if role != entity.RoleUser && role != entity.RoleAdmin {
+		return ErrInvalidRole
 	}
 
-	return tokenString, nil
+	return s.repo.SetRole(username, role)
 }
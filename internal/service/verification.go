@@ -0,0 +1,128 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"embed"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/pkg/mailer"
+)
+
+var (
+	ErrNoEmail                  = errors.New("no email")
+	ErrEmailVerified            = errors.New("email already verified")
+	ErrInvalidVerificationToken = errors.New("invalid verification token")
+)
+
+// verifyTTL is the lifetime of the email verification links.
+const verifyTTL = 48 * time.Hour
+
+//go:embed mail
+var mailFiles embed.FS
+
+// mailTemplates are the messages sent to the users, name.txt and name.html
+// of the mail directory.
+var mailTemplates = mailer.MustTemplates(mailFiles, "mail")
+
+// mailData fills the mail templates.
+type mailData struct {
+	Username string
+	Link     string
+}
+
+// sendMail sends the named message with the link to the user.
+func (s *UserService) sendMail(name string, user *entity.User, link string) error {
+	msg, err := mailTemplates.Render(name, user.Email, mailData{
+		Username: user.Username,
+		Link:     link,
+	})
+	if err != nil {
+		return ErrInternal
+	}
+
+	if err := s.mailer.Send(msg); err != nil {
+		return ErrInternal
+	}
+
+	return nil
+}
+
+// signVerification returns the signature of the verification link of the
+// email. The email is signed but not carried in the link, so that the link
+// stops working once the email is replaced.
+func (s *UserService) signVerification(userID int, expires int64, email string) string {
+	mac := hmac.New(sha256.New, []byte(s.opts.VerificationKey))
+	fmt.Fprintf(mac, "%d\n%d\n%s", userID, expires, strings.ToLower(email))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// sendVerification mails the link confirming the email of the user. The
+// token of the link is signed, nothing is stored.
+func (s *UserService) sendVerification(user *entity.User) error {
+	expires := time.Now().Add(verifyTTL).Unix()
+	token := strconv.Itoa(user.ID) + "." +
+		strconv.FormatInt(expires, 10) + "." +
+		s.signVerification(user.ID, expires, user.Email)
+
+	link := s.opts.VerifyURL + "?" + url.Values{"token": {token}}.Encode()
+	return s.sendMail("verify_email", user, link)
+}
+
+// ResendVerification mails the link confirming the email of the user again.
+func (s *UserService) ResendVerification(userID int) error {
+	user, err := s.repo.GetByID(userID)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return ErrNoEmail
+	}
+	if user.Verified {
+		return ErrEmailVerified
+	}
+
+	return s.sendVerification(user)
+}
+
+// VerifyEmail confirms the email of the token of a verification link.
+func (s *UserService) VerifyEmail(token string) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalidVerificationToken
+	}
+	userID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := s.repo.GetByID(userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return ErrInvalidVerificationToken
+	}
+
+	signature := s.signVerification(userID, expires, user.Email)
+	if !hmac.Equal([]byte(parts[2]), []byte(signature)) {
+		return ErrInvalidVerificationToken
+	}
+
+	return s.repo.VerifyEmail(userID, user.Email)
+}
@@ -0,0 +1,304 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/s02190058/spa/internal/service"
+)
+
+// handleChangePassword replaces the password of the user, the other
+// sessions of the user end.
+func (h *userHandlers) handleChangePassword() http.HandlerFunc {
+	type inputData struct {
+		Password    string `json:"password"`
+		NewPassword string `json:"new_password"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.ChangePassword: %v", err)
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		session, err := sessionFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.ChangePassword(user.ID, session, data.Password, data.NewPassword, clientFromRequest(r)); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrWrongPassword):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrLoginLocked):
+				code = http.StatusTooManyRequests
+			case
+				errors.Is(err, service.ErrInvalidPassword),
+				errors.Is(err, service.ErrBreachedPassword),
+				errors.Is(err, service.ErrWeakPassword):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+func (h *userHandlers) handleSetEmail() http.HandlerFunc {
+	type inputData struct {
+		Email string `json:"email"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.SetEmail: %v", err)
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.SetEmail(user.ID, data.Email); err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidEmail),
+				errors.Is(err, service.ErrEmailExists):
+				code = http.StatusUnprocessableEntity
+			case errors.Is(err, service.ErrUserNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+// handleRequestPasswordReset mails a password reset link. The response is
+// the same whether the link is sent or not.
+func (h *userHandlers) handleRequestPasswordReset() http.HandlerFunc {
+	type inputData struct {
+		Username string `json:"username"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.RequestPasswordReset: %v", err)
+		}
+
+		if err := h.service.RequestPasswordReset(data.Username); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+func (h *userHandlers) handleResetPassword() http.HandlerFunc {
+	type inputData struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.ResetPassword: %v", err)
+		}
+
+		if err := h.service.ResetPassword(data.Token, data.Password); err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidResetToken),
+				errors.Is(err, service.ErrUserNotFound):
+				code = http.StatusUnauthorized
+			case
+				errors.Is(err, service.ErrInvalidPassword),
+				errors.Is(err, service.ErrBreachedPassword),
+				errors.Is(err, service.ErrWeakPassword):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+func (h *userHandlers) handleDeleteAccount() http.HandlerFunc {
+	type inputData struct {
+		Password string `json:"password"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.DeleteAccount: %v", err)
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.DeleteAccount(user.ID, data.Password, clientFromRequest(r)); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrWrongPassword):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrLoginLocked):
+				code = http.StatusTooManyRequests
+			case errors.Is(err, service.ErrUserNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+// handleResendVerification mails the link confirming the email of the user
+// again.
+func (h *userHandlers) handleResendVerification() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.ResendVerification(user.ID); err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrNoEmail),
+				errors.Is(err, service.ErrEmailVerified):
+				code = http.StatusUnprocessableEntity
+			case errors.Is(err, service.ErrUserNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+func (h *userHandlers) handleVerifyEmail() http.HandlerFunc {
+	type inputData struct {
+		Token string `json:"token"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.VerifyEmail: %v", err)
+		}
+
+		if err := h.service.VerifyEmail(data.Token); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrInvalidVerificationToken):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrEmailExists):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
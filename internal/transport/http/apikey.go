@@ -0,0 +1,120 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/s02190058/spa/internal/service"
+)
+
+var ErrInvalidKeyID = errors.New("invalid key id")
+
+func (h *userHandlers) handleGetAPIKeys() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		keys, err := h.service.GetAPIKeys(user.ID)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response(w, http.StatusOK, keys)
+	}
+}
+
+// handleCreateAPIKey creates a key of the user, the key is in the response
+// and nowhere else. Expires is optional, the key never expires without it.
+func (h *userHandlers) handleCreateAPIKey() http.HandlerFunc {
+	type inputData struct {
+		Name    string     `json:"name"`
+		Scopes  []string   `json:"scopes"`
+		Expires *time.Time `json:"expires"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.CreateAPIKey: %v", err)
+		}
+
+		var expires time.Time
+		if data.Expires != nil {
+			expires = *data.Expires
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		key, err := h.service.CreateAPIKey(user.ID, data.Name, data.Scopes, expires)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidKeyName),
+				errors.Is(err, service.ErrInvalidScope),
+				errors.Is(err, service.ErrInvalidKeyExpiry),
+				errors.Is(err, service.ErrTooManyKeys):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusCreated, key)
+	}
+}
+
+func (h *userHandlers) handleRevokeAPIKey() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		keyIDInt, err := strconv.Atoi(vars["key_id"])
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidKeyID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.RevokeAPIKey(user.ID, keyIDInt); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrKeyNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
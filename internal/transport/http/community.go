@@ -0,0 +1,277 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+type communityService interface {
+	GetAll() ([]*entity.Community, error)
+	Get(name string) (*entity.Community, error)
+	Add(name, description string, rules []string, icon string, owner *entity.User) (*entity.Community, error)
+	Update(name string, userID int, description string, rules []string, icon string) (*entity.Community, error)
+	GetSubscriptions(userID int) ([]*entity.Community, error)
+	Subscribe(name string, userID int) (*entity.Community, error)
+	Unsubscribe(name string, userID int) (*entity.Community, error)
+	AddModerator(actor *entity.User, name, username string) (*entity.Community, error)
+	RemoveModerator(actor *entity.User, name, username string) (*entity.Community, error)
+}
+
+type communityHandlers struct {
+	service communityService
+}
+
+func registerCommunityHandlers(r *mux.Router, service communityService, m *middleware) {
+	h := &communityHandlers{
+		service: service,
+	}
+
+	r.HandleFunc("/communities", h.handleGetAll()).Methods(http.MethodGet)
+	r.HandleFunc("/community/{name}", h.handleGet()).Methods(http.MethodGet)
+
+	s := r.PathPrefix("/").Subrouter()
+	s.Use(m.checkAuthorization)
+	s.Handle("/communities", m.scope(entity.ScopePost, m.checkVerified(h.handleCreate()))).Methods(http.MethodPost)
+	s.Handle("/community/{name}", m.scope(entity.ScopePost, m.checkVerified(h.handleUpdate()))).Methods(http.MethodPut)
+	s.Handle("/subscriptions", m.scope(entity.ScopeRead, h.handleGetSubscriptions())).Methods(http.MethodGet)
+	s.Handle("/community/{name}/subscribe", m.scope(entity.ScopePost, h.handleSubscribe())).Methods(http.MethodPost)
+	s.Handle("/community/{name}/unsubscribe", m.scope(entity.ScopePost, h.handleUnsubscribe())).Methods(http.MethodPost)
+	s.Handle("/community/{name}/moderators/{username}", m.scope(entity.ScopeModerate, h.handleModerators(h.service.AddModerator))).Methods(http.MethodPut)
+	s.Handle("/community/{name}/moderators/{username}", m.scope(entity.ScopeModerate, h.handleModerators(h.service.RemoveModerator))).Methods(http.MethodDelete)
+}
+
+func (h *communityHandlers) handleGetAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		communities, err := h.service.GetAll()
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response(w, http.StatusOK, communities)
+	}
+}
+
+func (h *communityHandlers) handleGet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		name := vars["name"]
+
+		community, err := h.service.Get(name)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrCommunityNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, community)
+	}
+}
+
+func (h *communityHandlers) handleCreate() http.HandlerFunc {
+	type inputData struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Rules       []string `json:"rules"`
+		Icon        string   `json:"icon"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("communityHandlers.Create: %v", err)
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		community, err := h.service.Add(data.Name, data.Description, data.Rules, data.Icon, user)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidCommunityName),
+				errors.Is(err, service.ErrInvalidDescription),
+				errors.Is(err, service.ErrInvalidRules),
+				errors.Is(err, service.ErrInvalidIcon),
+				errors.Is(err, service.ErrCommunityExists):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusCreated, community)
+	}
+}
+
+func (h *communityHandlers) handleUpdate() http.HandlerFunc {
+	type inputData struct {
+		Description string   `json:"description"`
+		Rules       []string `json:"rules"`
+		Icon        string   `json:"icon"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("communityHandlers.Update: %v", err)
+		}
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		community, err := h.service.Update(name, user.ID, data.Description, data.Rules, data.Icon)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrCommunityNotFound):
+				code = http.StatusNotFound
+			case
+				errors.Is(err, service.ErrInvalidDescription),
+				errors.Is(err, service.ErrInvalidRules),
+				errors.Is(err, service.ErrInvalidIcon):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, community)
+	}
+}
+
+func (h *communityHandlers) handleGetSubscriptions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		communities, err := h.service.GetSubscriptions(user.ID)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response(w, http.StatusOK, communities)
+	}
+}
+
+func (h *communityHandlers) handleSubscription(
+	subscribe func(name string, userID int) (*entity.Community, error),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		name := vars["name"]
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		community, err := subscribe(name, user.ID)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrCommunityNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, community)
+	}
+}
+
+func (h *communityHandlers) handleSubscribe() http.HandlerFunc {
+	return h.handleSubscription(h.service.Subscribe)
+}
+
+func (h *communityHandlers) handleUnsubscribe() http.HandlerFunc {
+	return h.handleSubscription(h.service.Unsubscribe)
+}
+
+// handleModerators handles appointing and removing the moderators of a
+// community.
+func (h *communityHandlers) handleModerators(
+	change func(actor *entity.User, name, username string) (*entity.Community, error),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		name := vars["name"]
+		username := vars["username"]
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		community, err := change(user, name, username)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case
+				errors.Is(err, service.ErrCommunityNotFound),
+				errors.Is(err, service.ErrUserNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, community)
+	}
+}
@@ -27,3 +27,32 @@ func userFromContext(ctx context.Context) (*entity.User, error) {
 
 	return user, nil
 }
+
+type ctxSessionKey int
+
+var sessionKey ctxSessionKey
+
+func contextWithSession(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, sessionKey, id)
+}
+
+// sessionFromContext returns the id of the session of the access token.
+func sessionFromContext(ctx context.Context) (int, error) {
+	id, ok := ctx.Value(sessionKey).(int)
+	if !ok {
+		return 0, ErrBadContext
+	}
+
+	return id, nil
+}
+
+// userIDFromContext returns the id of the user put into the context by the
+// identify middleware, 0 for anonymous users.
+func userIDFromContext(ctx context.Context) int {
+	user, err := userFromContext(ctx)
+	if err != nil {
+		return 0
+	}
+
+	return user.ID
+}
@@ -0,0 +1,182 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/mux"
+	"github.com/s02190058/spa/internal/service"
+)
+
+// bindingCookie binds a login at a provider to the browser that started it,
+// so that nobody can finish a login of theirs in the browser of another
+// user.
+const bindingCookie = "oidc_binding"
+
+// setBinding sets the binding cookie, an empty binding removes it.
+func (h *userHandlers) setBinding(w http.ResponseWriter, binding string) {
+	cookie := &http.Cookie{
+		Name:     bindingCookie,
+		Value:    binding,
+		Path:     h.callbackPath,
+		Secure:   h.secureCookie,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if binding == "" {
+		cookie.MaxAge = -1
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+func (h *userHandlers) handleGetProviders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response(w, http.StatusOK, map[string]interface{}{
+			"providers": h.service.OIDCProviders(),
+		})
+	}
+}
+
+// handleStartOIDC redirects the user to the login at the provider.
+func (h *userHandlers) handleStartOIDC() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := mux.Vars(r)["provider"]
+
+		authURL, binding, err := h.service.StartOIDC(provider, 0)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnknownProvider):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrProviderFailed):
+				code = http.StatusBadGateway
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		h.setBinding(w, binding)
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// handleFinishOIDC is where the provider sends the user back. The user is
+// redirected to the application with the tokens, the challenge, the linked
+// provider or the error in the fragment, which never reaches the server.
+func (h *userHandlers) handleFinishOIDC() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		provider := mux.Vars(r)["provider"]
+		query := r.URL.Query()
+
+		var binding string
+		if cookie, err := r.Cookie(bindingCookie); err == nil {
+			binding = cookie.Value
+		}
+		h.setBinding(w, "")
+
+		fragment := url.Values{}
+		if providerErr := query.Get("error"); providerErr != "" {
+			fragment.Set("error", providerErr)
+			http.Redirect(w, r, h.redirectURL+"#"+fragment.Encode(), http.StatusFound)
+			return
+		}
+
+		tokens, err := h.service.FinishOIDC(provider, query.Get("state"), binding, query.Get("code"), clientFromRequest(r))
+		switch {
+		case err != nil:
+			fragment.Set("error", err.Error())
+		case tokens == nil:
+			fragment.Set("linked", provider)
+		case tokens.Challenge != "":
+			fragment.Set("challenge", tokens.Challenge)
+		default:
+			fragment.Set("token", tokens.Token)
+			fragment.Set("refresh_token", tokens.RefreshToken)
+		}
+
+		http.Redirect(w, r, h.redirectURL+"#"+fragment.Encode(), http.StatusFound)
+	}
+}
+
+func (h *userHandlers) handleGetIdentities() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		identities, err := h.service.GetIdentities(user.ID)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response(w, http.StatusOK, identities)
+	}
+}
+
+// handleLinkIdentity returns the URL of the login at the provider along with
+// the binding cookie, the identity is linked to the user once the login
+// completes in the same browser.
+func (h *userHandlers) handleLinkIdentity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		authURL, binding, err := h.service.StartOIDC(mux.Vars(r)["provider"], user.ID)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnknownProvider):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrProviderFailed):
+				code = http.StatusBadGateway
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		h.setBinding(w, binding)
+		response(w, http.StatusOK, map[string]string{
+			"url": authURL,
+		})
+	}
+}
+
+func (h *userHandlers) handleUnlinkIdentity() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.UnlinkIdentity(user.ID, mux.Vars(r)["provider"]); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrIdentityNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrLastIdentity):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
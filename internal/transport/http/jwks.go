@@ -0,0 +1,22 @@
+package http
+
+import (
+	"github.com/gorilla/mux"
+	"net/http"
+
+	"github.com/s02190058/spa/pkg/jwt"
+)
+
+func registerKeyHandlers(r *mux.Router, tokenManager *jwt.TokenManager) {
+	r.HandleFunc("/.well-known/jwks.json", handleJWKS(tokenManager)).Methods(http.MethodGet)
+}
+
+// handleJWKS publishes the public keys verifying the access tokens, so that
+// other services can check the tokens by themselves.
+func handleJWKS(tokenManager *jwt.TokenManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// rotated keys are picked up within minutes
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		response(w, http.StatusOK, tokenManager.JWKS())
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"context"
 	"errors"
 	"github.com/google/uuid"
+	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/mitchellh/mapstructure"
 
 	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
 	"github.com/s02190058/spa/pkg/jwt"
+	"github.com/s02190058/spa/pkg/ratelimit"
 )
 
 type ctxRequestIDKey int
@@ -20,12 +26,61 @@ type ctxRequestIDKey int
 var requestIDKey ctxRequestIDKey
 
 var (
-	ErrUnauthorized = errors.New("unauthorized")
+	ErrUnauthorized      = errors.New("unauthorized")
+	ErrUnverified        = errors.New("email not verified")
+	ErrRateLimited       = errors.New("too many requests")
+	ErrKeyNotAllowed     = errors.New("api keys not allowed")
+	ErrInsufficientScope = errors.New("insufficient scope")
 )
 
+// sessionChecker tells whether the session of an access token is still
+// active.
+type sessionChecker interface {
+	CheckSession(id int) error
+}
+
+// keyChecker returns the user of an API key and the key with the scopes it
+// grants.
+type keyChecker interface {
+	CheckAPIKey(key string) (*entity.User, *entity.APIKey, error)
+}
+
+// sessionTracker records the uses of the sessions.
+type sessionTracker interface {
+	Touch(id int, client entity.Client)
+}
+
+// keyTracker records the uses of the API keys.
+type keyTracker interface {
+	Touch(id int)
+}
+
 type middleware struct {
 	logger       *logrus.Logger
 	tokenManager *jwt.TokenManager
+	sessions     sessionChecker
+	keys         keyChecker
+	tracker      sessionTracker
+	keyTracker   keyTracker
+	// requireVerified keeps the users without a verified email from
+	// contributing
+	requireVerified bool
+	// the rate limits of the clients, nil limiters allow everything
+	loginLimiter    *ratelimit.Limiter
+	registerLimiter *ratelimit.Limiter
+}
+
+// clientFromRequest describes the device the request comes from.
+func clientFromRequest(r *http.Request) entity.Client {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return entity.Client{
+		IP:        ip,
+		UserAgent: r.UserAgent(),
+	}
 }
 
 func (m *middleware) setRequestID(next http.Handler) http.Handler {
@@ -71,29 +126,170 @@ func (m *middleware) logRequest(next http.Handler) http.Handler {
 	})
 }
 
+// authorize returns the user and the session of the bearer token sent with
+// the request. Tokens of revoked sessions are rejected, the use of the
+// session is recorded. API keys are sent as bearer tokens too, they have no
+// session.
+func (m *middleware) authorize(r *http.Request) (*entity.User, int, error) {
+	header := r.Header.Get("authorization")
+	headerParts := strings.Split(header, " ")
+	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
+		return nil, 0, ErrUnauthorized
+	}
+
+	token := headerParts[1]
+	if service.IsAPIKey(token) {
+		user, err := m.authorizeKey(r, token)
+		return user, 0, err
+	}
+
+	id, res, err := m.tokenManager.Check(token)
+	if err != nil {
+		return nil, 0, ErrUnauthorized
+	}
+
+	session, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, 0, ErrUnauthorized
+	}
+	if err := m.sessions.CheckSession(session); err != nil {
+		if errors.Is(err, service.ErrSessionNotFound) {
+			return nil, 0, ErrUnauthorized
+		}
+		return nil, 0, ErrInternal
+	}
+	m.tracker.Touch(session, clientFromRequest(r))
+
+	user := &entity.User{}
+	if err := mapstructure.Decode(res, user); err != nil {
+		return nil, 0, ErrInternal
+	}
+
+	return user, session, nil
+}
+
+// scopedHandler is the handler of a route open to the API keys granting
+// the scope.
+type scopedHandler struct {
+	scope string
+	next  http.Handler
+}
+
+func (h scopedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.next.ServeHTTP(w, r)
+}
+
+// scope opens the route to the API keys granting the scope, it wraps the
+// other middleware of the handler. The routes without a scope reject the
+// keys.
+func (m *middleware) scope(scope string, next http.Handler) http.Handler {
+	return scopedHandler{
+		scope: scope,
+		next:  next,
+	}
+}
+
+// authorizeKey returns the user of the API key if the key grants the scope
+// of the route.
+func (m *middleware) authorizeKey(r *http.Request, key string) (*entity.User, error) {
+	user, apiKey, err := m.keys.CheckAPIKey(key)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidKey) || errors.Is(err, service.ErrUserNotFound) {
+			return nil, ErrUnauthorized
+		}
+		return nil, ErrInternal
+	}
+	m.keyTracker.Touch(apiKey.ID)
+
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return nil, ErrKeyNotAllowed
+	}
+	scoped, ok := route.GetHandler().(scopedHandler)
+	if !ok {
+		return nil, ErrKeyNotAllowed
+	}
+	for _, scope := range apiKey.Scopes {
+		if scope == scoped.scope {
+			return user, nil
+		}
+	}
+
+	return nil, ErrInsufficientScope
+}
+
 func (m *middleware) checkAuthorization(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		header := r.Header.Get("authorization")
-		headerParts := strings.Split(header, " ")
-		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			errorResponse(w, http.StatusUnauthorized, ErrUnauthorized)
+		user, session, err := m.authorize(r)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, ErrInternal):
+				code = http.StatusInternalServerError
+			case errors.Is(err, ErrKeyNotAllowed), errors.Is(err, ErrInsufficientScope):
+				code = http.StatusForbidden
+			default:
+				code = http.StatusUnauthorized
+			}
+			errorResponse(w, code, err)
 			return
 		}
 
-		token := headerParts[1]
-		res, err := m.tokenManager.Check(token)
-		if err != nil {
-			errorResponse(w, http.StatusUnauthorized, ErrUnauthorized)
+		ctx := contextWithUser(r.Context(), user)
+		ctx = contextWithSession(ctx, session)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// limit rejects the requests of the clients over the rate of the limiter.
+func (m *middleware) limit(limiter *ratelimit.Limiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, wait := limiter.Allow(clientFromRequest(r).IP)
+		if !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			errorResponse(w, http.StatusTooManyRequests, ErrRateLimited)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkVerified rejects the users without a verified email if configured
+// so, it follows checkAuthorization.
+func (m *middleware) checkVerified(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.requireVerified {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		user := &entity.User{}
-		if err := mapstructure.Decode(res, user); err != nil {
+		user, err := userFromContext(r.Context())
+		if err != nil {
 			errorResponse(w, http.StatusInternalServerError, ErrInternal)
 			return
 		}
+		if !user.Verified {
+			errorResponse(w, http.StatusForbidden, ErrUnverified)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// identify is checkAuthorization for endpoints open to anonymous users: the
+// user is put into the context only if the request is authorized.
+func (m *middleware) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, session, err := m.authorize(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
 
 		ctx := contextWithUser(r.Context(), user)
+		ctx = contextWithSession(ctx, session)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
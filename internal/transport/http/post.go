@@ -16,20 +16,36 @@ import (
 var (
 	ErrInvalidCommentID = errors.New("invalid comment id")
 	ErrInvalidPostID    = errors.New("invalid post id")
+	ErrInvalidLimit     = errors.New("invalid limit")
+	ErrInvalidDepth     = errors.New("invalid depth")
 )
 
 type postService interface {
-	GetAll() ([]*entity.Post, error)
-	Get(id int) (*entity.Post, error)
-	GetByCategory(category string) ([]*entity.Post, error)
-	GetByUsername(username string) ([]*entity.Post, error)
+	GetAll(opts service.ListOptions) (*entity.PostList, error)
+	Get(id, userID int, commentSort string) (*entity.Post, error)
+	GetByCategory(category string, opts service.ListOptions) (*entity.PostList, error)
+	GetByUsername(username string, opts service.ListOptions) (*entity.PostList, error)
+	GetFeed(opts service.ListOptions) (*entity.PostList, error)
 	Add(typ, category, title, text, url string, author *entity.User) (*entity.Post, error)
+	Update(postID, userID int, title, text, url string) (*entity.Post, error)
+	GetRevisions(postID, userID int) ([]*entity.PostRevision, error)
 	Upvote(postID, userID int) (*entity.Post, error)
 	Downvote(postID, userID int) (*entity.Post, error)
 	Unvote(postID, userID int) (*entity.Post, error)
-	Delete(postID, userID int) error
-	AddComment(postID, userID int, body string) (*entity.Post, error)
-	DeleteComment(postID, commentID, userID int) (*entity.Post, error)
+	Delete(postID int, user *entity.User) error
+	AddComment(postID, userID, parentID int, body string) (*entity.Post, error)
+	GetComment(postID, commentID, userID, depth int, commentSort string) (*entity.Comment, error)
+	UpdateComment(postID, commentID, userID int, body string) (*entity.Post, error)
+	GetCommentRevisions(postID, commentID, userID int) ([]*entity.CommentRevision, error)
+	DeleteComment(postID, commentID int, user *entity.User) (*entity.Post, error)
+	UpvoteComment(postID, commentID, userID int) (*entity.Post, error)
+	DownvoteComment(postID, commentID, userID int) (*entity.Post, error)
+	UnvoteComment(postID, commentID, userID int) (*entity.Post, error)
+	Search(opts service.SearchOptions) (*entity.SearchResults, error)
+	Lock(postID int, user *entity.User) (*entity.Post, error)
+	Unlock(postID int, user *entity.User) (*entity.Post, error)
+	Pin(postID int, user *entity.User) (*entity.Post, error)
+	Unpin(postID int, user *entity.User) (*entity.Post, error)
 }
 
 type postHandlers struct {
@@ -41,27 +57,112 @@ func registerPostHandlers(r *mux.Router, service postService, m *middleware) {
 		service: service,
 	}
 
-	r.HandleFunc("/posts/", h.handleGetAll()).Methods(http.MethodGet)
-	r.HandleFunc("/post/{post_id}", h.handleGet()).Methods(http.MethodGet)
-	r.HandleFunc("/posts/{category}", h.handleGetByCategory()).Methods(http.MethodGet)
-	r.HandleFunc("/user/{username}", h.handleGetByUsername()).Methods(http.MethodGet)
+	r.Handle("/posts/", m.scope(entity.ScopeRead, m.identify(h.handleGetAll()))).Methods(http.MethodGet)
+	r.Handle("/post/{post_id}", m.scope(entity.ScopeRead, m.identify(h.handleGet()))).Methods(http.MethodGet)
+	r.Handle("/posts/{category}", m.scope(entity.ScopeRead, m.identify(h.handleGetByCategory()))).Methods(http.MethodGet)
+	r.Handle("/user/{username}", m.scope(entity.ScopeRead, m.identify(h.handleGetByUsername()))).Methods(http.MethodGet)
+	r.Handle("/feed", m.scope(entity.ScopeRead, m.identify(h.handleGetFeed()))).Methods(http.MethodGet)
+	r.Handle("/post/{post_id}/revisions", m.scope(entity.ScopeRead, m.identify(h.handleGetRevisions()))).Methods(http.MethodGet)
+	r.Handle("/post/{post_id}/{comment_id:[0-9]+}", m.scope(entity.ScopeRead, m.identify(h.handleGetComment()))).Methods(http.MethodGet)
+	r.Handle("/post/{post_id}/{comment_id}/revisions", m.scope(entity.ScopeRead, m.identify(h.handleGetCommentRevisions()))).Methods(http.MethodGet)
+	r.Handle("/search", m.scope(entity.ScopeRead, m.identify(h.handleSearch()))).Methods(http.MethodGet)
 
 	s := r.PathPrefix("/").Subrouter()
 	s.Use(m.checkAuthorization)
-	s.HandleFunc("/posts", h.handleCreate()).Methods(http.MethodPost)
-	s.HandleFunc("/post/{post_id}/upvote", h.handleUpvote()).Methods(http.MethodGet)
-	s.HandleFunc("/post/{post_id}/downvote", h.handleDownvote()).Methods(http.MethodGet)
-	s.HandleFunc("/post/{post_id}/unvote", h.handleUnvote()).Methods(http.MethodGet)
-	s.HandleFunc("/post/{post_id}", h.handleCreateComment()).Methods(http.MethodPost)
-	s.HandleFunc("/post/{post_id}/{comment_id}", h.handleDeleteComment()).Methods(http.MethodDelete)
-	s.HandleFunc("/post/{post_id}", h.handleDelete()).Methods(http.MethodDelete)
+	s.Handle("/posts", m.scope(entity.ScopePost, m.checkVerified(h.handleCreate()))).Methods(http.MethodPost)
+	s.Handle("/post/{post_id}", m.scope(entity.ScopePost, m.checkVerified(h.handleUpdate()))).Methods(http.MethodPut)
+	s.Handle("/post/{post_id}/upvote", m.scope(entity.ScopeVote, m.checkVerified(h.handleUpvote()))).Methods(http.MethodGet)
+	s.Handle("/post/{post_id}/downvote", m.scope(entity.ScopeVote, m.checkVerified(h.handleDownvote()))).Methods(http.MethodGet)
+	s.Handle("/post/{post_id}/unvote", m.scope(entity.ScopeVote, m.checkVerified(h.handleUnvote()))).Methods(http.MethodGet)
+	s.Handle("/post/{post_id}", m.scope(entity.ScopePost, m.checkVerified(h.handleCreateComment()))).Methods(http.MethodPost)
+	s.Handle("/post/{post_id}/{comment_id}", m.scope(entity.ScopePost, m.checkVerified(h.handleUpdateComment()))).Methods(http.MethodPut)
+	s.Handle("/post/{post_id}/{comment_id}", m.scope(entity.ScopePost, h.handleDeleteComment())).Methods(http.MethodDelete)
+	s.Handle("/post/{post_id}/{comment_id}/upvote", m.scope(entity.ScopeVote, m.checkVerified(h.handleUpvoteComment()))).Methods(http.MethodGet)
+	s.Handle("/post/{post_id}/{comment_id}/downvote", m.scope(entity.ScopeVote, m.checkVerified(h.handleDownvoteComment()))).Methods(http.MethodGet)
+	s.Handle("/post/{post_id}/{comment_id}/unvote", m.scope(entity.ScopeVote, m.checkVerified(h.handleUnvoteComment()))).Methods(http.MethodGet)
+	s.Handle("/post/{post_id}", m.scope(entity.ScopePost, h.handleDelete())).Methods(http.MethodDelete)
+	s.Handle("/post/{post_id}/lock", m.scope(entity.ScopeModerate, h.handleModerate(h.service.Lock))).Methods(http.MethodPost)
+	s.Handle("/post/{post_id}/unlock", m.scope(entity.ScopeModerate, h.handleModerate(h.service.Unlock))).Methods(http.MethodPost)
+	s.Handle("/post/{post_id}/pin", m.scope(entity.ScopeModerate, h.handleModerate(h.service.Pin))).Methods(http.MethodPost)
+	s.Handle("/post/{post_id}/unpin", m.scope(entity.ScopeModerate, h.handleModerate(h.service.Unpin))).Methods(http.MethodPost)
+}
+
+// listOptions reads the sorting and pagination parameters of a listing from the query string.
+func listOptions(r *http.Request) (service.ListOptions, error) {
+	query := r.URL.Query()
+	opts := service.ListOptions{
+		Sort:   query.Get("sort"),
+		Period: query.Get("t"),
+		Cursor: query.Get("cursor"),
+		UserID: userIDFromContext(r.Context()),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return service.ListOptions{}, ErrInvalidLimit
+		}
+		opts.Limit = limitInt
+	}
+
+	return opts, nil
 }
 
 func (h *postHandlers) handleGetAll() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		posts, err := h.service.GetAll()
+		opts, err := listOptions(r)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		posts, err := h.service.GetAll(opts)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidSort),
+				errors.Is(err, service.ErrInvalidPeriod),
+				errors.Is(err, service.ErrInvalidCursor),
+				errors.Is(err, service.ErrInvalidLimit):
+				code = http.StatusBadRequest
+			case errors.Is(err, service.ErrPeriodNotSupported):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, posts)
+	}
+}
+
+func (h *postHandlers) handleGetFeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := listOptions(r)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		posts, err := h.service.GetFeed(opts)
 		if err != nil {
-			errorResponse(w, http.StatusInternalServerError, err)
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidSort),
+				errors.Is(err, service.ErrInvalidPeriod),
+				errors.Is(err, service.ErrInvalidCursor),
+				errors.Is(err, service.ErrInvalidLimit):
+				code = http.StatusBadRequest
+			case errors.Is(err, service.ErrPeriodNotSupported):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
 			return
 		}
 
@@ -79,10 +180,12 @@ func (h *postHandlers) handleGet() http.HandlerFunc {
 			return
 		}
 
-		post, err := h.service.Get(idInt)
+		post, err := h.service.Get(idInt, userIDFromContext(r.Context()), r.URL.Query().Get("sort"))
 		if err != nil {
 			var code int
 			switch {
+			case errors.Is(err, service.ErrInvalidSort):
+				code = http.StatusBadRequest
 			case errors.Is(err, service.ErrPostNotFound):
 				code = http.StatusNotFound
 			default:
@@ -101,10 +204,24 @@ func (h *postHandlers) handleGetByCategory() http.HandlerFunc {
 		vars := mux.Vars(r)
 		category := vars["category"]
 
-		posts, err := h.service.GetByCategory(category)
+		opts, err := listOptions(r)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		posts, err := h.service.GetByCategory(category, opts)
 		if err != nil {
 			var code int
 			switch {
+			case
+				errors.Is(err, service.ErrInvalidSort),
+				errors.Is(err, service.ErrInvalidPeriod),
+				errors.Is(err, service.ErrInvalidCursor),
+				errors.Is(err, service.ErrInvalidLimit):
+				code = http.StatusBadRequest
+			case errors.Is(err, service.ErrPeriodNotSupported):
+				code = http.StatusUnprocessableEntity
 			case errors.Is(err, service.ErrInvalidCategory):
 				code = http.StatusUnprocessableEntity
 			default:
@@ -123,10 +240,24 @@ func (h *postHandlers) handleGetByUsername() http.HandlerFunc {
 		vars := mux.Vars(r)
 		username := vars["username"]
 
-		posts, err := h.service.GetByUsername(username)
+		opts, err := listOptions(r)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		posts, err := h.service.GetByUsername(username, opts)
 		if err != nil {
 			var code int
 			switch {
+			case
+				errors.Is(err, service.ErrInvalidSort),
+				errors.Is(err, service.ErrInvalidPeriod),
+				errors.Is(err, service.ErrInvalidCursor),
+				errors.Is(err, service.ErrInvalidLimit):
+				code = http.StatusBadRequest
+			case errors.Is(err, service.ErrPeriodNotSupported):
+				code = http.StatusUnprocessableEntity
 			case errors.Is(err, service.ErrUserNotFound):
 				code = http.StatusNotFound
 			default:
@@ -179,6 +310,8 @@ func (h *postHandlers) handleCreate() http.HandlerFunc {
 		if err != nil {
 			var code int
 			switch {
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
 			case
 				errors.Is(err, service.ErrInvalidType),
 				errors.Is(err, service.ErrInvalidCategory),
@@ -196,6 +329,93 @@ func (h *postHandlers) handleCreate() http.HandlerFunc {
 	}
 }
 
+func (h *postHandlers) handleUpdate() http.HandlerFunc {
+	type inputData struct {
+		Title string `json:"title"`
+		Text  string `json:"text"`
+		URL   string `json:"url"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("postHandlers.Update: %v", err)
+		}
+
+		vars := mux.Vars(r)
+		id := vars["post_id"]
+		idInt, err := strconv.Atoi(id)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		post, err := h.service.Update(idInt, user.ID, data.Title, data.Text, data.URL)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrPostNotFound):
+				code = http.StatusNotFound
+			case
+				errors.Is(err, service.ErrInvalidTitle),
+				errors.Is(err, service.ErrInvalidText),
+				errors.Is(err, service.ErrInvalidURL):
+				code = http.StatusUnprocessableEntity
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, post)
+	}
+}
+
+func (h *postHandlers) handleGetRevisions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := vars["post_id"]
+		idInt, err := strconv.Atoi(id)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+
+		revisions, err := h.service.GetRevisions(idInt, userIDFromContext(r.Context()))
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrPostNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, revisions)
+	}
+}
+
 func (h *postHandlers) handleUpvote() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -218,6 +438,8 @@ func (h *postHandlers) handleUpvote() http.HandlerFunc {
 			switch {
 			case errors.Is(err, service.ErrPostNotFound):
 				code = http.StatusNotFound
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
 			default:
 				code = http.StatusInternalServerError
 			}
@@ -251,6 +473,8 @@ func (h *postHandlers) handleDownvote() http.HandlerFunc {
 			switch {
 			case errors.Is(err, service.ErrPostNotFound):
 				code = http.StatusNotFound
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
 			default:
 				code = http.StatusInternalServerError
 			}
@@ -284,6 +508,8 @@ func (h *postHandlers) handleUnvote() http.HandlerFunc {
 			switch {
 			case errors.Is(err, service.ErrPostNotFound):
 				code = http.StatusNotFound
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
 			default:
 				code = http.StatusInternalServerError
 			}
@@ -297,7 +523,8 @@ func (h *postHandlers) handleUnvote() http.HandlerFunc {
 
 func (h *postHandlers) handleCreateComment() http.HandlerFunc {
 	type inputData struct {
-		Comment string `json:"comment"`
+		Comment  string `json:"comment"`
+		ParentID int    `json:"parent_id"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -327,12 +554,18 @@ func (h *postHandlers) handleCreateComment() http.HandlerFunc {
 			return
 		}
 
-		post, err := h.service.AddComment(idInt, user.ID, data.Comment)
+		post, err := h.service.AddComment(idInt, user.ID, data.ParentID, data.Comment)
 		if err != nil {
 			var code int
 			switch {
-			case errors.Is(err, service.ErrPostNotFound):
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrParentNotFound):
 				code = http.StatusNotFound
+			case
+				errors.Is(err, service.ErrPostLocked),
+				errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
 			case errors.Is(err, service.ErrInvalidBody):
 				code = http.StatusUnprocessableEntity
 			default:
@@ -346,6 +579,158 @@ func (h *postHandlers) handleCreateComment() http.HandlerFunc {
 	}
 }
 
+func (h *postHandlers) handleGetComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		postID := vars["post_id"]
+		postIDInt, err := strconv.Atoi(postID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+		commentID := vars["comment_id"]
+		commentIDInt, err := strconv.Atoi(commentID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidCommentID)
+			return
+		}
+
+		depthInt := 0
+		if depth := r.URL.Query().Get("depth"); depth != "" {
+			depthInt, err = strconv.Atoi(depth)
+			if err != nil {
+				errorResponse(w, http.StatusBadRequest, ErrInvalidDepth)
+				return
+			}
+		}
+
+		comment, err := h.service.GetComment(
+			postIDInt,
+			commentIDInt,
+			userIDFromContext(r.Context()),
+			depthInt,
+			r.URL.Query().Get("sort"),
+		)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidDepth),
+				errors.Is(err, service.ErrInvalidSort):
+				code = http.StatusBadRequest
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrCommentNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, comment)
+	}
+}
+
+func (h *postHandlers) handleUpdateComment() http.HandlerFunc {
+	type inputData struct {
+		Comment string `json:"comment"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("postHandlers.UpdateComment: %v", err)
+		}
+
+		vars := mux.Vars(r)
+		postID := vars["post_id"]
+		postIDInt, err := strconv.Atoi(postID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+		commentID := vars["comment_id"]
+		commentIDInt, err := strconv.Atoi(commentID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidCommentID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		post, err := h.service.UpdateComment(postIDInt, commentIDInt, user.ID, data.Comment)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrCommentNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrInvalidBody):
+				code = http.StatusUnprocessableEntity
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, post)
+	}
+}
+
+func (h *postHandlers) handleGetCommentRevisions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		postID := vars["post_id"]
+		postIDInt, err := strconv.Atoi(postID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+		commentID := vars["comment_id"]
+		commentIDInt, err := strconv.Atoi(commentID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidCommentID)
+			return
+		}
+
+		revisions, err := h.service.GetCommentRevisions(postIDInt, commentIDInt, userIDFromContext(r.Context()))
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrCommentNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, revisions)
+	}
+}
+
 func (h *postHandlers) handleDeleteComment() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -368,7 +753,7 @@ func (h *postHandlers) handleDeleteComment() http.HandlerFunc {
 			return
 		}
 
-		post, err := h.service.DeleteComment(postIDInt, commentIDInt, user.ID)
+		post, err := h.service.DeleteComment(postIDInt, commentIDInt, user)
 		if err != nil {
 			var code int
 			switch {
@@ -389,6 +774,135 @@ func (h *postHandlers) handleDeleteComment() http.HandlerFunc {
 	}
 }
 
+func (h *postHandlers) handleUpvoteComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		postID := vars["post_id"]
+		postIDInt, err := strconv.Atoi(postID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+		commentID := vars["comment_id"]
+		commentIDInt, err := strconv.Atoi(commentID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidCommentID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		post, err := h.service.UpvoteComment(postIDInt, commentIDInt, user.ID)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrCommentNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, post)
+	}
+}
+
+func (h *postHandlers) handleDownvoteComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		postID := vars["post_id"]
+		postIDInt, err := strconv.Atoi(postID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+		commentID := vars["comment_id"]
+		commentIDInt, err := strconv.Atoi(commentID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidCommentID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		post, err := h.service.DownvoteComment(postIDInt, commentIDInt, user.ID)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrCommentNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, post)
+	}
+}
+
+func (h *postHandlers) handleUnvoteComment() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		postID := vars["post_id"]
+		postIDInt, err := strconv.Atoi(postID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+		commentID := vars["comment_id"]
+		commentIDInt, err := strconv.Atoi(commentID)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidCommentID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		post, err := h.service.UnvoteComment(postIDInt, commentIDInt, user.ID)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrCommentNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrBanned):
+				code = http.StatusForbidden
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, post)
+	}
+}
+
 func (h *postHandlers) handleDelete() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
@@ -405,7 +919,7 @@ func (h *postHandlers) handleDelete() http.HandlerFunc {
 			return
 		}
 
-		if err := h.service.Delete(idInt, user.ID); err != nil {
+		if err := h.service.Delete(idInt, user); err != nil {
 			var code int
 			switch {
 			case errors.Is(err, service.ErrUnauthorized):
@@ -424,3 +938,42 @@ func (h *postHandlers) handleDelete() http.HandlerFunc {
 		})
 	}
 }
+
+// handleModerate handles the moderation actions on a post: lock, unlock, pin
+// and unpin.
+func (h *postHandlers) handleModerate(
+	action func(postID int, user *entity.User) (*entity.Post, error),
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := vars["post_id"]
+		idInt, err := strconv.Atoi(id)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		post, err := action(idInt, user)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrPostNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, post)
+	}
+}
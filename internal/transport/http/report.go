@@ -0,0 +1,376 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/s02190058/spa/internal/entity"
+	"github.com/s02190058/spa/internal/service"
+)
+
+var ErrInvalidBanID = errors.New("invalid ban id")
+
+type moderationService interface {
+	Report(postID, commentID, userID int, reason string) error
+	GetQueue(user *entity.User, limit int) ([]*entity.ReportGroup, error)
+	Resolve(user *entity.User, postID, commentID int, action, reason string) error
+	GetLog(user *entity.User, community string, limit int) ([]*entity.LogEntry, error)
+	Ban(actor *entity.User, username, community, reason string, expires time.Time, shadow bool) (*entity.Ban, error)
+	Unban(actor *entity.User, id int) error
+	GetBans(actor *entity.User, community string) ([]*entity.Ban, error)
+}
+
+type moderationHandlers struct {
+	service moderationService
+}
+
+func registerModerationHandlers(r *mux.Router, service moderationService, m *middleware) {
+	h := &moderationHandlers{
+		service: service,
+	}
+
+	s := r.PathPrefix("/").Subrouter()
+	s.Use(m.checkAuthorization)
+	s.Handle("/post/{post_id}/report", m.scope(entity.ScopePost, m.checkVerified(h.handleReport()))).Methods(http.MethodPost)
+	s.Handle("/post/{post_id}/{comment_id}/report", m.scope(entity.ScopePost, m.checkVerified(h.handleReport()))).Methods(http.MethodPost)
+	s.Handle("/reports", m.scope(entity.ScopeModerate, h.handleGetQueue())).Methods(http.MethodGet)
+	s.Handle("/reports/resolve", m.scope(entity.ScopeModerate, h.handleResolve())).Methods(http.MethodPost)
+	s.Handle("/community/{name}/log", m.scope(entity.ScopeModerate, h.handleGetLog())).Methods(http.MethodGet)
+	s.Handle("/log", m.scope(entity.ScopeModerate, h.handleGetLog())).Methods(http.MethodGet)
+	s.Handle("/bans", m.scope(entity.ScopeModerate, h.handleGetBans())).Methods(http.MethodGet)
+	s.Handle("/bans", m.scope(entity.ScopeModerate, h.handleBan())).Methods(http.MethodPost)
+	s.Handle("/bans/{ban_id}", m.scope(entity.ScopeModerate, h.handleUnban())).Methods(http.MethodDelete)
+}
+
+// limit reads the limit query parameter, 0 if it is not given.
+func limit(r *http.Request) (int, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		return 0, nil
+	}
+
+	limitInt, err := strconv.Atoi(limit)
+	if err != nil {
+		return 0, ErrInvalidLimit
+	}
+
+	return limitInt, nil
+}
+
+// handleReport reports a post or, if the comment_id variable is set, a
+// comment.
+func (h *moderationHandlers) handleReport() http.HandlerFunc {
+	type inputData struct {
+		Reason string `json:"reason"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("moderationHandlers.Report: %v", err)
+		}
+
+		vars := mux.Vars(r)
+		postIDInt, err := strconv.Atoi(vars["post_id"])
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidPostID)
+			return
+		}
+		commentIDInt := 0
+		if commentID, ok := vars["comment_id"]; ok {
+			commentIDInt, err = strconv.Atoi(commentID)
+			if err != nil {
+				errorResponse(w, http.StatusBadRequest, ErrInvalidCommentID)
+				return
+			}
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.Report(postIDInt, commentIDInt, user.ID, data.Reason); err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrCommentNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrInvalidReason):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusCreated, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+func (h *moderationHandlers) handleGetQueue() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limitInt, err := limit(r)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		groups, err := h.service.GetQueue(user, limitInt)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrInvalidLimit):
+				code = http.StatusBadRequest
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, groups)
+	}
+}
+
+func (h *moderationHandlers) handleResolve() http.HandlerFunc {
+	type inputData struct {
+		PostID    int    `json:"post_id"`
+		CommentID int    `json:"comment_id"`
+		Action    string `json:"action"`
+		Reason    string `json:"reason"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("moderationHandlers.Resolve: %v", err)
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.Resolve(user, data.PostID, data.CommentID, data.Action, data.Reason); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case
+				errors.Is(err, service.ErrPostNotFound),
+				errors.Is(err, service.ErrCommentNotFound),
+				errors.Is(err, service.ErrReportNotFound):
+				code = http.StatusNotFound
+			case
+				errors.Is(err, service.ErrInvalidAction),
+				errors.Is(err, service.ErrInvalidReason):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+// handleGetLog lists the moderation log of the community, the site-wide log
+// on the route without a community.
+func (h *moderationHandlers) handleGetLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limitInt, err := limit(r)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		vars := mux.Vars(r)
+		name := vars["name"]
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		entries, err := h.service.GetLog(user, name, limitInt)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrInvalidLimit):
+				code = http.StatusBadRequest
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, entries)
+	}
+}
+
+// handleGetBans lists the bans of the community query parameter, site-wide
+// bans if it is not given.
+func (h *moderationHandlers) handleGetBans() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		community := r.URL.Query().Get("community")
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		bans, err := h.service.GetBans(user, community)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, bans)
+	}
+}
+
+// handleBan bans the user in the community, site-wide if the community is
+// empty. Expires is optional, the ban is permanent without it.
+func (h *moderationHandlers) handleBan() http.HandlerFunc {
+	type inputData struct {
+		Username  string     `json:"username"`
+		Community string     `json:"community"`
+		Reason    string     `json:"reason"`
+		Expires   *time.Time `json:"expires"`
+		Shadow    bool       `json:"shadow"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("moderationHandlers.Ban: %v", err)
+		}
+
+		var expires time.Time
+		if data.Expires != nil {
+			expires = *data.Expires
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		ban, err := h.service.Ban(user, data.Username, data.Community, data.Reason, expires, data.Shadow)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case
+				errors.Is(err, service.ErrUserNotFound),
+				errors.Is(err, service.ErrCommunityNotFound):
+				code = http.StatusNotFound
+			case
+				errors.Is(err, service.ErrInvalidReason),
+				errors.Is(err, service.ErrInvalidExpiry):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusCreated, ban)
+	}
+}
+
+func (h *moderationHandlers) handleUnban() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		banIDInt, err := strconv.Atoi(vars["ban_id"])
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidBanID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.Unban(user, banIDInt); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrBanNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
@@ -4,31 +4,50 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"time"
 
 	"github.com/s02190058/spa/internal/config"
 	"github.com/s02190058/spa/pkg/jwt"
+	"github.com/s02190058/spa/pkg/ratelimit"
 )
 
 func NewRouter(
 	logger *logrus.Logger,
 	tokenManager *jwt.TokenManager,
+	sessionTracker sessionTracker,
+	keyTracker keyTracker,
 	userService userService,
 	postService postService,
+	communityService communityService,
+	moderationService moderationService,
+	account config.Account,
+	login config.Login,
+	oidc config.OIDC,
 	static config.Static,
 ) *mux.Router {
 	r := mux.NewRouter()
 	m := &middleware{
-		logger:       logger,
-		tokenManager: tokenManager,
+		logger:          logger,
+		tokenManager:    tokenManager,
+		sessions:        userService,
+		keys:            userService,
+		tracker:         sessionTracker,
+		keyTracker:      keyTracker,
+		requireVerified: account.RequireVerified,
+		loginLimiter:    ratelimit.New(login.LoginRate, time.Minute),
+		registerLimiter: ratelimit.New(login.RegisterRate, time.Minute),
 	}
 	r.Use(m.setRequestID)
 	r.Use(m.logRequest)
 
 	s := r.PathPrefix("/api").Subrouter()
-	registerUserHandlers(s, userService)
+	registerUserHandlers(s, userService, m, oidc)
 	registerPostHandlers(s, postService, m)
+	registerCommunityHandlers(s, communityService, m)
+	registerModerationHandlers(s, moderationService, m)
 	s.PathPrefix("/").Handler(http.NotFoundHandler())
 
+	registerKeyHandlers(r, tokenManager)
 	registerStaticHandlers(r, static.Path, static.Index)
 
 	return r
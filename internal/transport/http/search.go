@@ -0,0 +1,99 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/s02190058/spa/internal/service"
+)
+
+var ErrInvalidDate = errors.New("invalid date")
+
+const dateLayout = "2006-01-02"
+
+// parseDate accepts RFC 3339 times and dates. A date given as the upper
+// bound of a range (end set) includes the whole day.
+func parseDate(s string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return time.Time{}, ErrInvalidDate
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+// searchOptions reads the search parameters from the query string.
+func searchOptions(r *http.Request) (service.SearchOptions, error) {
+	query := r.URL.Query()
+	opts := service.SearchOptions{
+		Query:    query.Get("q"),
+		Category: query.Get("category"),
+		Author:   query.Get("author"),
+		Cursor:   query.Get("cursor"),
+		UserID:   userIDFromContext(r.Context()),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		limitInt, err := strconv.Atoi(limit)
+		if err != nil {
+			return service.SearchOptions{}, ErrInvalidLimit
+		}
+		opts.Limit = limitInt
+	}
+
+	if from := query.Get("from"); from != "" {
+		t, err := parseDate(from, false)
+		if err != nil {
+			return service.SearchOptions{}, err
+		}
+		opts.From = t
+	}
+
+	if to := query.Get("to"); to != "" {
+		t, err := parseDate(to, true)
+		if err != nil {
+			return service.SearchOptions{}, err
+		}
+		opts.To = t
+	}
+
+	return opts, nil
+}
+
+func (h *postHandlers) handleSearch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts, err := searchOptions(r)
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, err)
+			return
+		}
+
+		results, err := h.service.Search(opts)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidQuery),
+				errors.Is(err, service.ErrInvalidRange),
+				errors.Is(err, service.ErrInvalidCursor),
+				errors.Is(err, service.ErrInvalidLimit):
+				code = http.StatusBadRequest
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, results)
+	}
+}
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/s02190058/spa/internal/service"
+)
+
+// handleSignInWithCode is the second step of the login of the users with
+// two-factor authentication.
+func (h *userHandlers) handleSignInWithCode() http.HandlerFunc {
+	type inputData struct {
+		Challenge string `json:"challenge"`
+		Code      string `json:"code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.SignInWithCode: %v", err)
+		}
+
+		tokens, err := h.service.SignInWithCode(data.Challenge, data.Code, clientFromRequest(r))
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidChallenge),
+				errors.Is(err, service.ErrInvalidCode),
+				errors.Is(err, service.ErrTwoFactorDisabled),
+				errors.Is(err, service.ErrUserNotFound):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrLoginLocked):
+				code = http.StatusTooManyRequests
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, tokens)
+	}
+}
+
+func (h *userHandlers) handleEnrollTOTP() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		enrollment, err := h.service.EnrollTOTP(user)
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrTwoFactorEnabled):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, enrollment)
+	}
+}
+
+// handleConfirmTOTP enables two-factor authentication and returns the
+// recovery codes.
+func (h *userHandlers) handleConfirmTOTP() http.HandlerFunc {
+	type inputData struct {
+		Code string `json:"code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.ConfirmTOTP: %v", err)
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		codes, err := h.service.ConfirmTOTP(user.ID, data.Code)
+		if err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidCode),
+				errors.Is(err, service.ErrTwoFactorEnabled),
+				errors.Is(err, service.ErrTwoFactorDisabled):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string][]string{
+			"recovery_codes": codes,
+		})
+	}
+}
+
+func (h *userHandlers) handleDisableTOTP() http.HandlerFunc {
+	type inputData struct {
+		Code string `json:"code"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.DisableTOTP: %v", err)
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.DisableTOTP(user.ID, data.Code, clientFromRequest(r)); err != nil {
+			var code int
+			switch {
+			case
+				errors.Is(err, service.ErrInvalidCode),
+				errors.Is(err, service.ErrTwoFactorDisabled):
+				code = http.StatusUnprocessableEntity
+			case errors.Is(err, service.ErrLoginLocked):
+				code = http.StatusTooManyRequests
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
@@ -4,33 +4,110 @@ import (
 	"encoding/json"
 	"errors"
 	"github.com/gorilla/mux"
+	"github.com/s02190058/spa/internal/config"
+	"github.com/s02190058/spa/internal/entity"
 	"github.com/s02190058/spa/internal/service"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 )
 
+var ErrInvalidSessionID = errors.New("invalid session id")
+
 type userService interface {
-	SignUp(username, password string) (string, error)
-	SignIn(username, password string) (string, error)
+	SignUp(username, password, email string, client entity.Client) (*entity.Tokens, error)
+	SignIn(username, password string, client entity.Client) (*entity.Tokens, error)
+	Refresh(refreshToken string, client entity.Client) (*entity.Tokens, error)
+	CheckSession(id int) error
+	GetSessions(userID, current int) ([]*entity.Session, error)
+	SignInWithCode(challenge, code string, client entity.Client) (*entity.Tokens, error)
+	EnrollTOTP(user *entity.User) (*entity.TOTPEnrollment, error)
+	ConfirmTOTP(userID int, code string) ([]string, error)
+	DisableTOTP(userID int, code string, client entity.Client) error
+	ChangePassword(userID, session int, password, newPassword string, client entity.Client) error
+	SetEmail(userID int, email string) error
+	ResendVerification(userID int) error
+	VerifyEmail(token string) error
+	RequestPasswordReset(username string) error
+	ResetPassword(token, newPassword string) error
+	DeleteAccount(userID int, password string, client entity.Client) error
+	OIDCProviders() []string
+	StartOIDC(provider string, userID int) (string, string, error)
+	FinishOIDC(provider, state, binding, code string, client entity.Client) (*entity.Tokens, error)
+	GetIdentities(userID int) ([]*entity.Identity, error)
+	UnlinkIdentity(userID int, provider string) error
+	CreateAPIKey(userID int, name string, scopes []string, expires time.Time) (*entity.APIKey, error)
+	GetAPIKeys(userID int) ([]*entity.APIKey, error)
+	RevokeAPIKey(userID, id int) error
+	CheckAPIKey(key string) (*entity.User, *entity.APIKey, error)
+	Logout(id, userID int) error
+	LogoutAll(userID int) error
+	SetRole(actor *entity.User, username, role string) error
 }
 
+// userHandlers send the users back from the OpenID Connect providers to
+// redirectURL. The logins at the providers are bound to the browsers with a
+// cookie sent to callbackPath only, over https only if secureCookie is set.
 type userHandlers struct {
-	service userService
+	service      userService
+	redirectURL  string
+	callbackPath string
+	secureCookie bool
 }
 
-func registerUserHandlers(r *mux.Router, service userService) {
+func registerUserHandlers(r *mux.Router, service userService, m *middleware, oidc config.OIDC) {
 	h := &userHandlers{
-		service: service,
+		service:      service,
+		redirectURL:  oidc.RedirectURL,
+		callbackPath: "/",
+	}
+	if callbackURL, err := url.Parse(oidc.CallbackURL); err == nil {
+		if callbackURL.Path != "" {
+			h.callbackPath = callbackURL.Path
+		}
+		h.secureCookie = callbackURL.Scheme == "https"
 	}
 
-	r.HandleFunc("/register", h.handleSignUp()).Methods(http.MethodPost)
-	r.HandleFunc("/login", h.handleSignIn()).Methods(http.MethodPost)
+	r.Handle("/register", m.limit(m.registerLimiter, h.handleSignUp())).Methods(http.MethodPost)
+	r.Handle("/login", m.limit(m.loginLimiter, h.handleSignIn())).Methods(http.MethodPost)
+	r.Handle("/login/2fa", m.limit(m.loginLimiter, h.handleSignInWithCode())).Methods(http.MethodPost)
+	r.Handle("/refresh", m.limit(m.loginLimiter, h.handleRefresh())).Methods(http.MethodPost)
+	r.Handle("/password/reset", m.limit(m.loginLimiter, h.handleRequestPasswordReset())).Methods(http.MethodPost)
+	r.Handle("/password/reset/confirm", m.limit(m.loginLimiter, h.handleResetPassword())).Methods(http.MethodPost)
+	r.Handle("/email/verify", m.limit(m.loginLimiter, h.handleVerifyEmail())).Methods(http.MethodPost)
+	r.HandleFunc("/oidc/providers", h.handleGetProviders()).Methods(http.MethodGet)
+	r.HandleFunc("/oidc/{provider}/login", h.handleStartOIDC()).Methods(http.MethodGet)
+	r.Handle("/oidc/{provider}/callback", m.limit(m.loginLimiter, h.handleFinishOIDC())).Methods(http.MethodGet)
+
+	s := r.PathPrefix("/").Subrouter()
+	s.Use(m.checkAuthorization)
+	s.HandleFunc("/logout", h.handleLogout()).Methods(http.MethodPost)
+	s.HandleFunc("/logout/all", h.handleLogoutAll()).Methods(http.MethodPost)
+	s.HandleFunc("/me/sessions", h.handleGetSessions()).Methods(http.MethodGet)
+	s.HandleFunc("/me/sessions/{session_id}", h.handleRevokeSession()).Methods(http.MethodDelete)
+	s.HandleFunc("/me/2fa/enroll", h.handleEnrollTOTP()).Methods(http.MethodPost)
+	s.HandleFunc("/me/2fa/confirm", h.handleConfirmTOTP()).Methods(http.MethodPost)
+	s.Handle("/me/2fa/disable", m.limit(m.loginLimiter, h.handleDisableTOTP())).Methods(http.MethodPost)
+	s.HandleFunc("/me/password", h.handleChangePassword()).Methods(http.MethodPut)
+	s.HandleFunc("/me/email", h.handleSetEmail()).Methods(http.MethodPut)
+	s.HandleFunc("/me/email/verify", h.handleResendVerification()).Methods(http.MethodPost)
+	s.HandleFunc("/me/identities", h.handleGetIdentities()).Methods(http.MethodGet)
+	s.HandleFunc("/me/identities/{provider}", h.handleLinkIdentity()).Methods(http.MethodPost)
+	s.HandleFunc("/me/identities/{provider}", h.handleUnlinkIdentity()).Methods(http.MethodDelete)
+	s.HandleFunc("/me/keys", h.handleGetAPIKeys()).Methods(http.MethodGet)
+	s.HandleFunc("/me/keys", h.handleCreateAPIKey()).Methods(http.MethodPost)
+	s.HandleFunc("/me/keys/{key_id}", h.handleRevokeAPIKey()).Methods(http.MethodDelete)
+	s.HandleFunc("/me", h.handleDeleteAccount()).Methods(http.MethodDelete)
+	s.HandleFunc("/user/{username}/role", h.handleSetRole()).Methods(http.MethodPut)
 }
 
 func (h *userHandlers) handleSignUp() http.HandlerFunc {
 	type inputData struct {
 		Username string `json:"username"`
 		Password string `json:"password"`
+		Email    string `json:"email"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -46,13 +123,17 @@ func (h *userHandlers) handleSignUp() http.HandlerFunc {
 			log.Printf("userHandlers.SignUp: %v", err)
 		}
 
-		token, err := h.service.SignUp(data.Username, data.Password)
+		tokens, err := h.service.SignUp(data.Username, data.Password, data.Email, clientFromRequest(r))
 		if err != nil {
 			var code int
 			switch {
 			case
 				errors.Is(err, service.ErrInvalidUsername),
 				errors.Is(err, service.ErrInvalidPassword),
+				errors.Is(err, service.ErrBreachedPassword),
+				errors.Is(err, service.ErrWeakPassword),
+				errors.Is(err, service.ErrInvalidEmail),
+				errors.Is(err, service.ErrEmailExists),
 				errors.Is(err, service.ErrAlreadyExists):
 				code = http.StatusUnprocessableEntity
 			default:
@@ -62,9 +143,7 @@ func (h *userHandlers) handleSignUp() http.HandlerFunc {
 			return
 		}
 
-		response(w, http.StatusCreated, map[string]string{
-			"token": token,
-		})
+		response(w, http.StatusCreated, tokens)
 	}
 }
 
@@ -87,12 +166,50 @@ func (h *userHandlers) handleSignIn() http.HandlerFunc {
 			log.Printf("userHandlers.SignIn: %v", err)
 		}
 
-		token, err := h.service.SignIn(data.Username, data.Password)
+		tokens, err := h.service.SignIn(data.Username, data.Password, clientFromRequest(r))
+		if err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrInvalidCredentials):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrLoginLocked):
+				code = http.StatusTooManyRequests
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, tokens)
+	}
+}
+
+// handleRefresh exchanges the refresh token for new tokens.
+func (h *userHandlers) handleRefresh() http.HandlerFunc {
+	type inputData struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.Refresh: %v", err)
+		}
+
+		tokens, err := h.service.Refresh(data.RefreshToken, clientFromRequest(r))
 		if err != nil {
 			var code int
 			switch {
 			case
-				errors.Is(err, service.ErrWrongPassword),
+				errors.Is(err, service.ErrInvalidRefreshToken),
 				errors.Is(err, service.ErrUserNotFound):
 				code = http.StatusUnauthorized
 			default:
@@ -102,8 +219,166 @@ func (h *userHandlers) handleSignIn() http.HandlerFunc {
 			return
 		}
 
+		response(w, http.StatusOK, tokens)
+	}
+}
+
+// handleLogout revokes the session of the access token.
+func (h *userHandlers) handleLogout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		session, err := sessionFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.Logout(session, user.ID); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrSessionNotFound):
+				code = http.StatusUnauthorized
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+// handleLogoutAll revokes all the sessions of the user, on every device.
+func (h *userHandlers) handleLogoutAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.LogoutAll(user.ID); err != nil {
+			errorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+// handleGetSessions lists the active sessions of the user, the session of
+// the request is marked current.
+func (h *userHandlers) handleGetSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+		session, err := sessionFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		sessions, err := h.service.GetSessions(user.ID, session)
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		response(w, http.StatusOK, sessions)
+	}
+}
+
+// handleRevokeSession ends a session of the user, e.g. on a lost device.
+func (h *userHandlers) handleRevokeSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		sessionIDInt, err := strconv.Atoi(vars["session_id"])
+		if err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrInvalidSessionID)
+			return
+		}
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.Logout(sessionIDInt, user.ID); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrSessionNotFound):
+				code = http.StatusNotFound
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
+		response(w, http.StatusOK, map[string]string{
+			"message": "success",
+		})
+	}
+}
+
+func (h *userHandlers) handleSetRole() http.HandlerFunc {
+	type inputData struct {
+		Role string `json:"role"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := new(inputData)
+		if err := json.NewDecoder(r.Body).Decode(data); err != nil {
+			errorResponse(w, http.StatusBadRequest, ErrBadRequest)
+			return
+		}
+		// the server closes the body anyway, but an explicit closure allows to release
+		// occupied resources earlier
+		if err := r.Body.Close(); err != nil {
+			// TODO: change default logger
+			log.Printf("userHandlers.SetRole: %v", err)
+		}
+
+		vars := mux.Vars(r)
+		username := vars["username"]
+
+		user, err := userFromContext(r.Context())
+		if err != nil {
+			errorResponse(w, http.StatusInternalServerError, ErrInternal)
+			return
+		}
+
+		if err := h.service.SetRole(user, username, data.Role); err != nil {
+			var code int
+			switch {
+			case errors.Is(err, service.ErrUnauthorized):
+				code = http.StatusUnauthorized
+			case errors.Is(err, service.ErrUserNotFound):
+				code = http.StatusNotFound
+			case errors.Is(err, service.ErrInvalidRole):
+				code = http.StatusUnprocessableEntity
+			default:
+				code = http.StatusInternalServerError
+			}
+			errorResponse(w, code, err)
+			return
+		}
+
 		response(w, http.StatusOK, map[string]string{
-			"token": token,
+			"message": "success",
 		})
 	}
 }
@@ -0,0 +1,15 @@
+ALTER TABLE posts
+    ADD COLUMN upvotes   INT NOT NULL DEFAULT 0,
+    ADD COLUMN downvotes INT NOT NULL DEFAULT 0,
+    ADD COLUMN score     INT NOT NULL DEFAULT 0;
+
+UPDATE posts p
+SET upvotes   = v.upvotes,
+    downvotes = v.downvotes,
+    score     = v.upvotes - v.downvotes
+FROM (SELECT post_id,
+             COUNT(*) FILTER (WHERE vote > 0) AS upvotes,
+             COUNT(*) FILTER (WHERE vote < 0) AS downvotes
+      FROM votes
+      GROUP BY post_id) v
+WHERE p.id = v.post_id;
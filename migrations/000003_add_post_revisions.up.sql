@@ -0,0 +1,17 @@
+ALTER TABLE posts
+    ADD COLUMN edited TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS post_revisions
+(
+    id      BIGSERIAL PRIMARY KEY,
+    post_id BIGINT      NOT NULL,
+    title   TEXT        NOT NULL,
+    text    TEXT        NOT NULL DEFAULT '',
+    url     TEXT        NOT NULL DEFAULT '',
+    created TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE post_revisions
+    ADD FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE;
+
+CREATE INDEX ON post_revisions (post_id);
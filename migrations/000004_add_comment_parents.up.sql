@@ -0,0 +1,7 @@
+ALTER TABLE comments
+    ADD COLUMN parent_id BIGINT;
+
+ALTER TABLE comments
+    ADD FOREIGN KEY (parent_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+CREATE INDEX ON comments (parent_id);
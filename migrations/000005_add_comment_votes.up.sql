@@ -0,0 +1,20 @@
+ALTER TABLE comments
+    ADD COLUMN upvotes   INT NOT NULL DEFAULT 0,
+    ADD COLUMN downvotes INT NOT NULL DEFAULT 0,
+    ADD COLUMN score     INT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS comment_votes
+(
+    comment_id BIGINT NOT NULL,
+    user_id    BIGINT NOT NULL,
+    vote       INT    NOT NULL
+);
+
+ALTER TABLE comment_votes
+    ADD FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+ALTER TABLE comment_votes
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE comment_votes
+    ADD PRIMARY KEY (comment_id, user_id);
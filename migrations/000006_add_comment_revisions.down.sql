@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS comment_revisions;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS deleted,
+    DROP COLUMN IF EXISTS edited;
@@ -0,0 +1,16 @@
+ALTER TABLE comments
+    ADD COLUMN edited  TIMESTAMPTZ,
+    ADD COLUMN deleted TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS comment_revisions
+(
+    id         BIGSERIAL PRIMARY KEY,
+    comment_id BIGINT      NOT NULL,
+    body       TEXT        NOT NULL,
+    created    TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE comment_revisions
+    ADD FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+CREATE INDEX ON comment_revisions (comment_id);
@@ -0,0 +1,5 @@
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS search;
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS search;
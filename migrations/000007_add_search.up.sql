@@ -0,0 +1,12 @@
+ALTER TABLE posts
+    ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', title), 'A') ||
+        setweight(to_tsvector('english', text), 'B')
+        ) STORED;
+
+ALTER TABLE comments
+    ADD COLUMN search TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', body)) STORED;
+
+CREATE INDEX ON posts USING GIN (search);
+
+CREATE INDEX ON comments USING GIN (search);
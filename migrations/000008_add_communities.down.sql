@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS categories_lower_idx;
+
+ALTER TABLE categories
+    DROP COLUMN IF EXISTS created,
+    DROP COLUMN IF EXISTS user_id,
+    DROP COLUMN IF EXISTS icon,
+    DROP COLUMN IF EXISTS rules,
+    DROP COLUMN IF EXISTS description;
@@ -0,0 +1,11 @@
+ALTER TABLE categories
+    ADD COLUMN description TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN rules       TEXT[]      NOT NULL DEFAULT '{}',
+    ADD COLUMN icon        TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN user_id     BIGINT,
+    ADD COLUMN created     TIMESTAMPTZ NOT NULL DEFAULT now();
+
+ALTER TABLE categories
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX ON categories (lower(name));
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS subscriptions
+(
+    user_id     BIGINT      NOT NULL,
+    category_id INT         NOT NULL,
+    created     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE subscriptions
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE subscriptions
+    ADD FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE CASCADE;
+
+ALTER TABLE subscriptions
+    ADD PRIMARY KEY (user_id, category_id);
+
+CREATE INDEX ON subscriptions (category_id);
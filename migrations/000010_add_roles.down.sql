@@ -0,0 +1,8 @@
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS pinned,
+    DROP COLUMN IF EXISTS locked;
+
+DROP TABLE IF EXISTS moderators;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS role;
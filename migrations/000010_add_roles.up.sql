@@ -0,0 +1,28 @@
+ALTER TABLE users
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'admin'));
+
+CREATE TABLE IF NOT EXISTS moderators
+(
+    user_id     BIGINT NOT NULL,
+    category_id INT    NOT NULL
+);
+
+ALTER TABLE moderators
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE moderators
+    ADD FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE CASCADE;
+
+ALTER TABLE moderators
+    ADD PRIMARY KEY (user_id, category_id);
+
+CREATE INDEX ON moderators (category_id);
+
+INSERT INTO moderators (user_id, category_id)
+SELECT user_id, id
+FROM categories
+WHERE user_id IS NOT NULL;
+
+ALTER TABLE posts
+    ADD COLUMN locked BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN pinned BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS moderation_log;
+
+DROP TABLE IF EXISTS bans;
+
+DROP TABLE IF EXISTS reports;
@@ -0,0 +1,71 @@
+CREATE TABLE IF NOT EXISTS reports
+(
+    id         BIGSERIAL PRIMARY KEY,
+    post_id    BIGINT      NOT NULL,
+    comment_id BIGINT,
+    user_id    BIGINT      NOT NULL,
+    reason     TEXT        NOT NULL,
+    created    TIMESTAMPTZ NOT NULL DEFAULT now(),
+    resolved   TIMESTAMPTZ,
+    resolution TEXT
+);
+
+ALTER TABLE reports
+    ADD FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE;
+
+ALTER TABLE reports
+    ADD FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE;
+
+ALTER TABLE reports
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+-- a user has at most one open report of a post or a comment
+CREATE UNIQUE INDEX ON reports (user_id, post_id, COALESCE(comment_id, 0)) WHERE resolved IS NULL;
+
+CREATE INDEX ON reports (post_id) WHERE resolved IS NULL;
+
+CREATE TABLE IF NOT EXISTS bans
+(
+    id           BIGSERIAL PRIMARY KEY,
+    user_id      BIGINT      NOT NULL,
+    category_id  INT         NOT NULL,
+    moderator_id BIGINT,
+    reason       TEXT        NOT NULL DEFAULT '',
+    created      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE bans
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE bans
+    ADD FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE CASCADE;
+
+ALTER TABLE bans
+    ADD FOREIGN KEY (moderator_id) REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE UNIQUE INDEX ON bans (user_id, category_id);
+
+-- entries outlive the content and the users they refer to
+CREATE TABLE IF NOT EXISTS moderation_log
+(
+    id           BIGSERIAL PRIMARY KEY,
+    action       TEXT        NOT NULL,
+    moderator_id BIGINT,
+    category_id  INT         NOT NULL,
+    user_id      BIGINT,
+    post_id      BIGINT,
+    comment_id   BIGINT,
+    details      TEXT        NOT NULL DEFAULT '',
+    created      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE moderation_log
+    ADD FOREIGN KEY (moderator_id) REFERENCES users (id) ON DELETE SET NULL;
+
+ALTER TABLE moderation_log
+    ADD FOREIGN KEY (category_id) REFERENCES categories (id) ON DELETE CASCADE;
+
+ALTER TABLE moderation_log
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE SET NULL;
+
+CREATE INDEX ON moderation_log (category_id, id);
@@ -0,0 +1,17 @@
+DELETE FROM moderation_log
+WHERE category_id IS NULL;
+
+ALTER TABLE moderation_log
+    ALTER COLUMN category_id SET NOT NULL;
+
+DROP INDEX IF EXISTS bans_user_id_coalesce_idx;
+
+DELETE FROM bans
+WHERE category_id IS NULL;
+
+CREATE UNIQUE INDEX ON bans (user_id, category_id);
+
+ALTER TABLE bans
+    DROP COLUMN IF EXISTS shadow,
+    DROP COLUMN IF EXISTS expires,
+    ALTER COLUMN category_id SET NOT NULL;
@@ -0,0 +1,12 @@
+-- bans without a community are site-wide
+ALTER TABLE bans
+    ALTER COLUMN category_id DROP NOT NULL,
+    ADD COLUMN expires TIMESTAMPTZ,
+    ADD COLUMN shadow  BOOLEAN NOT NULL DEFAULT FALSE;
+
+DROP INDEX IF EXISTS bans_user_id_category_id_idx;
+
+CREATE UNIQUE INDEX ON bans (user_id, COALESCE(category_id, 0));
+
+ALTER TABLE moderation_log
+    ALTER COLUMN category_id DROP NOT NULL;
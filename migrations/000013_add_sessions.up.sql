@@ -0,0 +1,21 @@
+-- refresh tokens are rotated on every use, the previous one is kept to
+-- detect the reuse of a stolen token
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id            BIGSERIAL PRIMARY KEY,
+    user_id       BIGINT      NOT NULL,
+    refresh_hash  TEXT        NOT NULL,
+    previous_hash TEXT,
+    created       TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires       TIMESTAMPTZ NOT NULL,
+    revoked       TIMESTAMPTZ
+);
+
+ALTER TABLE sessions
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX ON sessions (refresh_hash);
+
+CREATE INDEX ON sessions (previous_hash);
+
+CREATE INDEX ON sessions (user_id);
@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+    DROP COLUMN user_agent,
+    DROP COLUMN ip,
+    DROP COLUMN last_used;
@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+    ADD COLUMN last_used  TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ADD COLUMN ip         TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN user_agent TEXT        NOT NULL DEFAULT '';
@@ -0,0 +1,34 @@
+-- the secret is set on enrollment and used once the user confirms it,
+-- totp_last_step keeps the codes from being replayed
+ALTER TABLE users
+    ADD COLUMN totp_secret    TEXT,
+    ADD COLUMN totp_enabled   BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN totp_last_step BIGINT  NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes
+(
+    id      BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    hash    TEXT   NOT NULL,
+    used    TIMESTAMPTZ
+);
+
+ALTER TABLE recovery_codes
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE INDEX ON recovery_codes (user_id);
+
+-- passed the password, waiting for the second factor
+CREATE TABLE IF NOT EXISTS login_challenges
+(
+    id       BIGSERIAL PRIMARY KEY,
+    user_id  BIGINT      NOT NULL,
+    hash     TEXT        NOT NULL,
+    expires  TIMESTAMPTZ NOT NULL,
+    attempts INT         NOT NULL DEFAULT 0
+);
+
+ALTER TABLE login_challenges
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX ON login_challenges (hash);
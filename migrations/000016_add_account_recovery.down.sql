@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS password_resets;
+
+DROP INDEX IF EXISTS users_lower_idx;
+
+ALTER TABLE users
+    DROP COLUMN deleted,
+    DROP COLUMN email;
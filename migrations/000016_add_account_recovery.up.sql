@@ -0,0 +1,21 @@
+-- deleted users keep their rows under a random name, so that the content
+-- left behind has an author
+ALTER TABLE users
+    ADD COLUMN email   TEXT,
+    ADD COLUMN deleted TIMESTAMPTZ;
+
+CREATE UNIQUE INDEX ON users (lower(email));
+
+CREATE TABLE IF NOT EXISTS password_resets
+(
+    id      BIGSERIAL PRIMARY KEY,
+    user_id BIGINT      NOT NULL,
+    hash    TEXT        NOT NULL,
+    expires TIMESTAMPTZ NOT NULL,
+    used    TIMESTAMPTZ
+);
+
+ALTER TABLE password_resets
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX ON password_resets (hash);
@@ -0,0 +1,9 @@
+-- failed logins are counted per username and per IP address, the key is
+-- prefixed with the kind
+CREATE TABLE IF NOT EXISTS login_failures
+(
+    key          TEXT PRIMARY KEY,
+    failures     INT         NOT NULL DEFAULT 1,
+    last_failure TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ
+);
@@ -0,0 +1,36 @@
+-- the accounts of the users at the OpenID Connect providers, a user links
+-- at most one account of each provider
+CREATE TABLE IF NOT EXISTS identities
+(
+    id       BIGSERIAL PRIMARY KEY,
+    user_id  BIGINT      NOT NULL,
+    provider TEXT        NOT NULL,
+    subject  TEXT        NOT NULL,
+    email    TEXT,
+    created  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE identities
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX ON identities (provider, subject);
+
+CREATE UNIQUE INDEX ON identities (user_id, provider);
+
+-- the logins in progress at the providers, user_id is set when an identity
+-- is being linked to the account
+CREATE TABLE IF NOT EXISTS oidc_states
+(
+    id       BIGSERIAL PRIMARY KEY,
+    hash     TEXT        NOT NULL,
+    provider TEXT        NOT NULL,
+    verifier TEXT        NOT NULL,
+    nonce    TEXT        NOT NULL,
+    user_id  BIGINT,
+    expires  TIMESTAMPTZ NOT NULL
+);
+
+ALTER TABLE oidc_states
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX ON oidc_states (hash);
@@ -0,0 +1,21 @@
+-- personal API keys, only the hash of a key is kept along with its first
+-- characters to tell the keys apart
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id        BIGSERIAL PRIMARY KEY,
+    user_id   BIGINT      NOT NULL,
+    name      TEXT        NOT NULL,
+    prefix    TEXT        NOT NULL,
+    hash      TEXT        NOT NULL,
+    scopes    TEXT[]      NOT NULL,
+    created   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used TIMESTAMPTZ,
+    expires   TIMESTAMPTZ
+);
+
+ALTER TABLE api_keys
+    ADD FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+CREATE UNIQUE INDEX ON api_keys (hash);
+
+CREATE INDEX ON api_keys (user_id);
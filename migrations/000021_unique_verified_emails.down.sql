@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS users_verified_email_idx;
+
+-- the claims competing with a verified or an earlier one are dropped
+UPDATE users u
+SET email = NULL
+WHERE NOT u.email_verified
+  AND EXISTS(SELECT
+             FROM users o
+             WHERE lower(o.email) = lower(u.email)
+               AND o.id <> u.id
+               AND (o.email_verified OR o.id < u.id));
+
+CREATE UNIQUE INDEX ON users (lower(email));
@@ -0,0 +1,5 @@
+-- an email belongs to the user who verified it, unverified claims do not
+-- keep others from using it
+DROP INDEX IF EXISTS users_lower_idx;
+
+CREATE UNIQUE INDEX users_verified_email_idx ON users (lower(email)) WHERE email_verified;
@@ -0,0 +1,6 @@
+-- a login at a provider is bound to the browser that started it by the hash
+-- of a cookie, the logins started before are dropped
+DELETE FROM oidc_states;
+
+ALTER TABLE oidc_states
+    ADD COLUMN binding TEXT NOT NULL;
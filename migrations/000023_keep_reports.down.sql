@@ -0,0 +1,10 @@
+DELETE
+FROM reports r
+WHERE NOT EXISTS(SELECT FROM posts p WHERE p.id = r.post_id)
+   OR r.comment_id IS NOT NULL AND NOT EXISTS(SELECT FROM comments c WHERE c.id = r.comment_id);
+
+ALTER TABLE reports
+    ADD FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE;
+
+ALTER TABLE reports
+    ADD FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE;
@@ -0,0 +1,5 @@
+-- reports outlive the content they refer to, like the moderation log, so
+-- that removing a post keeps the reports that led to it
+ALTER TABLE reports
+    DROP CONSTRAINT IF EXISTS reports_post_id_fkey,
+    DROP CONSTRAINT IF EXISTS reports_comment_id_fkey;
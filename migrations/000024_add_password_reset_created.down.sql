@@ -0,0 +1,2 @@
+ALTER TABLE password_resets
+    DROP COLUMN IF EXISTS created;
@@ -0,0 +1,5 @@
+-- the time of the request, a user gets a link at most once per cooldown
+ALTER TABLE password_resets
+    ADD COLUMN created TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE INDEX ON password_resets (user_id, created);
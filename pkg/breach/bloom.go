@@ -0,0 +1,138 @@
+package breach
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+var ErrBadFilter = errors.New("bad filter")
+
+// bloomMagic starts the files of the filters.
+var bloomMagic = [8]byte{'S', 'P', 'A', 'B', 'L', 'O', 'O', 'M'}
+
+// Bloom is a bloom filter of the hashes of breached passwords, a compact
+// corpus of a large dump. A password is reported breached at the false
+// positive rate of the filter, a breached password is always reported.
+type Bloom struct {
+	// k is the number of bits set per hash
+	k    uint32
+	bits []uint64
+}
+
+// NewBloom returns an empty filter for n hashes at the false positive rate.
+func NewBloom(n int, rate float64) *Bloom {
+	if n < 1 {
+		n = 1
+	}
+
+	m := math.Ceil(-float64(n) * math.Log(rate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+
+	return &Bloom{
+		k:    uint32(k),
+		bits: make([]uint64, (uint64(m)+63)/64),
+	}
+}
+
+// positions calls f with the bits of the hash, derived from the hash by
+// double hashing.
+func (b *Bloom) positions(sum [sha1.Size]byte, f func(i uint64) bool) {
+	m := uint64(len(b.bits)) * 64
+	h1 := binary.BigEndian.Uint64(sum[0:8])
+	h2 := binary.BigEndian.Uint64(sum[8:16]) | 1
+
+	for i := uint64(0); i < uint64(b.k); i++ {
+		if !f((h1 + i*h2) % m) {
+			return
+		}
+	}
+}
+
+// AddHash adds the SHA-1 hash of a password.
+func (b *Bloom) AddHash(sum [sha1.Size]byte) {
+	b.positions(sum, func(i uint64) bool {
+		b.bits[i/64] |= 1 << (i % 64)
+		return true
+	})
+}
+
+func (b *Bloom) Add(password string) {
+	b.AddHash(Hash(password))
+}
+
+func (b *Bloom) Contains(password string) (bool, error) {
+	found := true
+	b.positions(Hash(password), func(i uint64) bool {
+		found = b.bits[i/64]&(1<<(i%64)) != 0
+		return found
+	})
+
+	return found, nil
+}
+
+// WriteTo writes the filter: the magic, k and the number of words as
+// big-endian integers, then the words.
+func (b *Bloom) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	header := struct {
+		Magic [8]byte
+		K     uint32
+		Words uint64
+	}{bloomMagic, b.k, uint64(len(b.bits))}
+	if err := binary.Write(bw, binary.BigEndian, header); err != nil {
+		return 0, err
+	}
+	if err := binary.Write(bw, binary.BigEndian, b.bits); err != nil {
+		return 0, err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+
+	return int64(binary.Size(header) + 8*len(b.bits)), nil
+}
+
+// ReadBloom reads a filter written by WriteTo.
+func ReadBloom(r io.Reader) (*Bloom, error) {
+	br := bufio.NewReader(r)
+	var header struct {
+		Magic [8]byte
+		K     uint32
+		Words uint64
+	}
+	if err := binary.Read(br, binary.BigEndian, &header); err != nil {
+		return nil, ErrBadFilter
+	}
+	if header.Magic != bloomMagic || header.K == 0 || header.Words == 0 {
+		return nil, ErrBadFilter
+	}
+
+	b := &Bloom{
+		k:    header.K,
+		bits: make([]uint64, header.Words),
+	}
+	if err := binary.Read(br, binary.BigEndian, b.bits); err != nil {
+		return nil, ErrBadFilter
+	}
+
+	return b, nil
+}
+
+// LoadBloom reads the filter of the file.
+func LoadBloom(path string) (*Bloom, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadBloom(f)
+}
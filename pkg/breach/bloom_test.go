@@ -0,0 +1,73 @@
+package breach
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestBloomRoundTrip(t *testing.T) {
+	b := NewBloom(1000, 0.001)
+	passwords := make([]string, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		password := fmt.Sprintf("password%d", i)
+		passwords = append(passwords, password)
+		b.Add(password)
+	}
+
+	var buf bytes.Buffer
+	n, err := b.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo = %d, wrote %d bytes", n, buf.Len())
+	}
+
+	got, err := ReadBloom(&buf)
+	if err != nil {
+		t.Fatalf("ReadBloom: %v", err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Fatalf("ReadBloom = k %d, %d words, want k %d, %d words", got.k, len(got.bits), b.k, len(b.bits))
+	}
+
+	for _, password := range passwords {
+		if ok, _ := got.Contains(password); !ok {
+			t.Errorf("Contains(%q) = false after the round trip", password)
+		}
+	}
+}
+
+func TestReadBloomBadFilter(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewBloom(10, 0.01).WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	filter := buf.Bytes()
+
+	badMagic := append([]byte(nil), filter...)
+	badMagic[0] = 'X'
+	zeroK := append([]byte(nil), filter...)
+	copy(zeroK[8:12], []byte{0, 0, 0, 0})
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: nil},
+		{name: "bad magic", data: badMagic},
+		{name: "zero k", data: zeroK},
+		{name: "truncated header", data: filter[:10]},
+		{name: "truncated words", data: filter[:len(filter)-1]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadBloom(bytes.NewReader(tt.data)); err != ErrBadFilter {
+				t.Errorf("ReadBloom() error = %v, want %v", err, ErrBadFilter)
+			}
+		})
+	}
+}
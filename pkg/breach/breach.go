@@ -0,0 +1,39 @@
+// Package breach tells whether a password appears in a corpus of breached
+// passwords. The passwords are looked up by their SHA-1 hashes, the format
+// of the Have I Been Pwned dumps, so the corpus never holds plain text.
+package breach
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+)
+
+// Corpus is a set of breached passwords.
+type Corpus interface {
+	Contains(password string) (bool, error)
+}
+
+// Hash returns the SHA-1 hash of the password.
+func Hash(password string) [sha1.Size]byte {
+	return sha1.Sum([]byte(password))
+}
+
+// ParseHash parses a line of a dump of hashes, the hex encoded hash
+// optionally followed by a colon and the number of occurrences.
+func ParseHash(line string) ([sha1.Size]byte, bool) {
+	var sum [sha1.Size]byte
+
+	if i := strings.IndexByte(line, ':'); i >= 0 {
+		line = line[:i]
+	}
+	line = strings.TrimSpace(line)
+	if len(line) != hex.EncodedLen(sha1.Size) {
+		return sum, false
+	}
+	if _, err := hex.Decode(sum[:], []byte(line)); err != nil {
+		return sum, false
+	}
+
+	return sum, true
+}
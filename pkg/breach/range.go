@@ -0,0 +1,63 @@
+package breach
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// prefixSize is the number of hex characters of the hash naming a range.
+const prefixSize = 5
+
+// RangeDir is a directory of ranges, the k-anonymity format of the Have I
+// Been Pwned API: the hashes starting with the same five hex characters are
+// kept in the file named after them (ABCDE.txt), one SUFFIX:COUNT line each.
+// A lookup reads a single range.
+type RangeDir struct {
+	dir string
+}
+
+func NewRangeDir(dir string) (*RangeDir, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New(dir + " is not a directory")
+	}
+
+	return &RangeDir{
+		dir: dir,
+	}, nil
+}
+
+func (d *RangeDir) Contains(password string) (bool, error) {
+	sum := Hash(password)
+	h := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := h[:prefixSize], h[prefixSize:]
+
+	f, err := os.Open(filepath.Join(d.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(strings.TrimSpace(line), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
@@ -0,0 +1,130 @@
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+)
+
+// Argon2Params are the costs of an argon2id hash: Time passes over Memory
+// KiB with Threads threads.
+type Argon2Params struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+}
+
+// DefaultArgon2Params follow the recommendation of RFC 9106 for memory
+// constrained environments.
+var DefaultArgon2Params = Argon2Params{
+	Memory:  64 * 1024,
+	Time:    3,
+	Threads: 4,
+}
+
+type Argon2id struct {
+	params Argon2Params
+}
+
+// NewArgon2id returns the hasher of the parameters, zero parameters are
+// taken from DefaultArgon2Params.
+func NewArgon2id(params Argon2Params) *Argon2id {
+	if params.Memory == 0 {
+		params.Memory = DefaultArgon2Params.Memory
+	}
+	if params.Time == 0 {
+		params.Time = DefaultArgon2Params.Time
+	}
+	if params.Threads == 0 {
+		params.Threads = DefaultArgon2Params.Threads
+	}
+
+	return &Argon2id{
+		params: params,
+	}
+}
+
+var argon2Encoding = base64.RawStdEncoding
+
+func (h *Argon2id) Encrypt(password string) (string, error) {
+	salt := make([]byte, argon2SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	p := h.params
+	key := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, argon2KeySize)
+
+	return fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		p.Memory,
+		p.Time,
+		p.Threads,
+		argon2Encoding.EncodeToString(salt),
+		argon2Encoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2id) Compare(encryptedPassword, password string) bool {
+	return Compare(encryptedPassword, password)
+}
+
+// NeedsRehash reports the hashes of the other algorithms and of other
+// parameters.
+func (h *Argon2id) NeedsRehash(encryptedPassword string) bool {
+	p, _, key, err := parseArgon2id(encryptedPassword)
+	return err != nil || p != h.params || len(key) != argon2KeySize
+}
+
+// parseArgon2id returns the parameters, the salt and the key of the hash
+// $argon2id$v=19$m=65536,t=3,p=4$salt$key.
+func parseArgon2id(encryptedPassword string) (Argon2Params, []byte, []byte, error) {
+	var p Argon2Params
+
+	parts := strings.Split(encryptedPassword, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != AlgArgon2id {
+		return p, nil, nil, ErrUnknownAlgorithm
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return p, nil, nil, err
+	}
+	if version != argon2.Version {
+		return p, nil, nil, ErrUnknownAlgorithm
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Time, &p.Threads); err != nil {
+		return p, nil, nil, err
+	}
+
+	salt, err := argon2Encoding.DecodeString(parts[4])
+	if err != nil {
+		return p, nil, nil, err
+	}
+	key, err := argon2Encoding.DecodeString(parts[5])
+	if err != nil {
+		return p, nil, nil, err
+	}
+
+	return p, salt, key, nil
+}
+
+func compareArgon2id(encryptedPassword, password string) bool {
+	p, salt, key, err := parseArgon2id(encryptedPassword)
+	if err != nil || len(key) == 0 || p.Time == 0 || p.Threads == 0 {
+		return false
+	}
+
+	other := argon2.IDKey([]byte(password), salt, p.Time, p.Memory, p.Threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, other) == 1
+}
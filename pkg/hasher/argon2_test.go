@@ -0,0 +1,169 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+)
+
+// testArgon2Params keep the tests fast, the format does not depend on them.
+var testArgon2Params = Argon2Params{
+	Memory:  64,
+	Time:    1,
+	Threads: 1,
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := NewArgon2id(testArgon2Params)
+
+	tests := []struct {
+		name     string
+		password string
+	}{
+		{name: "empty", password: ""},
+		{name: "ascii", password: "correct horse battery staple"},
+		{name: "unicode", password: "пароль パスワード"},
+		{name: "long", password: strings.Repeat("long password ", 20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := h.Encrypt(tt.password)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if prefix := "$argon2id$v=19$m=64,t=1,p=1$"; !strings.HasPrefix(hash, prefix) {
+				t.Errorf("Encrypt = %q, want the prefix %q", hash, prefix)
+			}
+
+			p, salt, key, err := parseArgon2id(hash)
+			if err != nil {
+				t.Fatalf("parseArgon2id(%q): %v", hash, err)
+			}
+			if p != testArgon2Params || len(salt) != argon2SaltSize || len(key) != argon2KeySize {
+				t.Errorf("parseArgon2id(%q) = %+v, %d bytes of salt, %d bytes of key", hash, p, len(salt), len(key))
+			}
+
+			if !h.Compare(hash, tt.password) {
+				t.Errorf("Compare(%q) = false for the password", hash)
+			}
+			if h.Compare(hash, tt.password+"x") {
+				t.Errorf("Compare(%q) = true for a wrong password", hash)
+			}
+		})
+	}
+}
+
+func TestArgon2idSalted(t *testing.T) {
+	h := NewArgon2id(testArgon2Params)
+
+	first, err := h.Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	second, err := h.Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if first == second {
+		t.Errorf("Encrypt returned %q twice, want different salts", first)
+	}
+}
+
+func TestParseArgon2idMalformed(t *testing.T) {
+	const salt = "c2FsdHNhbHRzYWx0c2FsdA"
+	const key = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "empty", hash: ""},
+		{name: "plain text", hash: "password"},
+		{name: "bcrypt", hash: "$2a$04$abcdefghijklmnopqrstuu5BxlZGRTyhWHHHsDIBzEvPxTBM.mq6"},
+		{name: "argon2i", hash: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "missing key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "extra field", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key + "$"},
+		{name: "other version", hash: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "bad version", hash: "$argon2id$version$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "bad params", hash: "$argon2id$v=19$m=64;t=1;p=1$" + salt + "$" + key},
+		{name: "bad salt", hash: "$argon2id$v=19$m=64,t=1,p=1$!salt!$" + key},
+		{name: "bad key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$!key!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := parseArgon2id(tt.hash); err == nil {
+				t.Errorf("parseArgon2id(%q) succeeded", tt.hash)
+			}
+			if compareArgon2id(tt.hash, "password") {
+				t.Errorf("compareArgon2id(%q) = true", tt.hash)
+			}
+		})
+	}
+}
+
+func TestCompareArgon2idZeroParams(t *testing.T) {
+	// the costs come from the hash, zero costs must not reach argon2
+	tests := []string{
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsdA$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$",
+	}
+
+	for _, hash := range tests {
+		if compareArgon2id(hash, "password") {
+			t.Errorf("compareArgon2id(%q) = true", hash)
+		}
+	}
+}
+
+func TestArgon2idNeedsRehash(t *testing.T) {
+	h := NewArgon2id(testArgon2Params)
+
+	current, err := h.Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	moreMemory, err := NewArgon2id(Argon2Params{Memory: 128, Time: 1, Threads: 1}).Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	bcryptHash, err := NewBcrypt(testBcryptCost).Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{name: "same params", hash: current, want: false},
+		{name: "other params", hash: moreMemory, want: true},
+		{name: "short key", hash: "$argon2id$v=19$m=64,t=1,p=1$c2FsdA$a2V5", want: true},
+		{name: "bcrypt", hash: bcryptHash, want: true},
+		{name: "malformed", hash: "$argon2id$", want: true},
+		{name: "empty", hash: "", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.hash, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewArgon2idDefaults(t *testing.T) {
+	h := NewArgon2id(Argon2Params{Memory: 1024})
+
+	want := Argon2Params{
+		Memory:  1024,
+		Time:    DefaultArgon2Params.Time,
+		Threads: DefaultArgon2Params.Threads,
+	}
+	if h.params != want {
+		t.Errorf("NewArgon2id params = %+v, want %+v", h.params, want)
+	}
+}
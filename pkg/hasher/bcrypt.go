@@ -0,0 +1,64 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcryptMaxLength is the number of bytes of a password used by bcrypt.
+const bcryptMaxLength = 72
+
+type Bcrypt struct {
+	cost int
+}
+
+func NewBcrypt(cost int) *Bcrypt {
+	if cost < bcrypt.MinCost {
+		cost = bcrypt.DefaultCost
+	}
+
+	return &Bcrypt{
+		cost: cost,
+	}
+}
+
+// bcryptKey returns the bytes hashed by bcrypt. Longer passwords are
+// prehashed, bcrypt ignores all the bytes past the limit.
+func bcryptKey(password string) []byte {
+	if len(password) <= bcryptMaxLength {
+		return []byte(password)
+	}
+
+	sum := sha256.Sum256([]byte(password))
+	return []byte(base64.StdEncoding.EncodeToString(sum[:]))
+}
+
+func (h *Bcrypt) Encrypt(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword(bcryptKey(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func (h *Bcrypt) Compare(encryptedPassword, password string) bool {
+	return Compare(encryptedPassword, password)
+}
+
+// NeedsRehash reports the hashes of the other algorithms and of another
+// cost.
+func (h *Bcrypt) NeedsRehash(encryptedPassword string) bool {
+	if algorithm(encryptedPassword) != AlgBcrypt {
+		return true
+	}
+
+	cost, err := bcrypt.Cost([]byte(encryptedPassword))
+	return err != nil || cost != h.cost
+}
+
+func compareBcrypt(encryptedPassword, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(encryptedPassword), bcryptKey(password)) == nil
+}
@@ -0,0 +1,131 @@
+package hasher
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testBcryptCost keeps the tests fast.
+const testBcryptCost = bcrypt.MinCost
+
+func TestBcryptKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		password  string
+		prehashed bool
+	}{
+		{name: "empty", password: "", prehashed: false},
+		{name: "short", password: "password", prehashed: false},
+		{name: "at the limit", password: strings.Repeat("a", bcryptMaxLength), prehashed: false},
+		{name: "over the limit", password: strings.Repeat("a", bcryptMaxLength+1), prehashed: true},
+		{name: "multibyte over the limit", password: strings.Repeat("я", bcryptMaxLength/2+1), prehashed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := bcryptKey(tt.password)
+			if prehashed := !bytes.Equal(key, []byte(tt.password)); prehashed != tt.prehashed {
+				t.Errorf("bcryptKey(%q) = %q, prehashed %v, want %v", tt.password, key, prehashed, tt.prehashed)
+			}
+			if len(key) > bcryptMaxLength {
+				t.Errorf("bcryptKey(%q) is %d bytes long, over the limit of bcrypt", tt.password, len(key))
+			}
+		})
+	}
+}
+
+func TestBcryptLongPasswords(t *testing.T) {
+	// bcrypt alone would take the passwords for the same one
+	prefix := strings.Repeat("x", bcryptMaxLength)
+	password := prefix + "first"
+	other := prefix + "second"
+
+	h := NewBcrypt(testBcryptCost)
+	hash, err := h.Encrypt(password)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	if !h.Compare(hash, password) {
+		t.Errorf("Compare = false for the password")
+	}
+	if h.Compare(hash, other) {
+		t.Errorf("Compare = true for a password sharing the first %d bytes", bcryptMaxLength)
+	}
+	if h.Compare(hash, prefix) {
+		t.Errorf("Compare = true for the first %d bytes of the password", bcryptMaxLength)
+	}
+}
+
+func TestBcryptRoundTrip(t *testing.T) {
+	h := NewBcrypt(testBcryptCost)
+
+	tests := []struct {
+		name     string
+		password string
+	}{
+		{name: "empty", password: ""},
+		{name: "ascii", password: "correct horse battery staple"},
+		{name: "unicode", password: "пароль パスワード"},
+		{name: "long", password: strings.Repeat("long password ", 20)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := h.Encrypt(tt.password)
+			if err != nil {
+				t.Fatalf("Encrypt: %v", err)
+			}
+			if algorithm(hash) != AlgBcrypt {
+				t.Errorf("Encrypt = %q, not a bcrypt hash", hash)
+			}
+
+			if !h.Compare(hash, tt.password) {
+				t.Errorf("Compare(%q) = false for the password", hash)
+			}
+			if h.Compare(hash, tt.password+"x") {
+				t.Errorf("Compare(%q) = true for a wrong password", hash)
+			}
+		})
+	}
+}
+
+func TestBcryptNeedsRehash(t *testing.T) {
+	h := NewBcrypt(testBcryptCost)
+
+	current, err := h.Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	otherCost, err := NewBcrypt(testBcryptCost + 1).Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	argon2Hash, err := NewArgon2id(testArgon2Params).Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		hash string
+		want bool
+	}{
+		{name: "same cost", hash: current, want: false},
+		{name: "other cost", hash: otherCost, want: true},
+		{name: "argon2id", hash: argon2Hash, want: true},
+		{name: "malformed", hash: "$2a$", want: true},
+		{name: "empty", hash: "", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.NeedsRehash(tt.hash); got != tt.want {
+				t.Errorf("NeedsRehash(%q) = %v, want %v", tt.hash, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,26 +1,53 @@
+// Package hasher hashes the passwords. The hashes are strings of the PHC
+// format ($id$params$salt$hash, the modular crypt format for bcrypt), so
+// that the hashes of all the algorithms are told apart and verified.
 package hasher
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"errors"
+	"strings"
+)
 
-type Hasher struct {
-	cost int
-}
+var ErrUnknownAlgorithm = errors.New("unknown algorithm")
 
-func New(cost int) *Hasher {
-	return &Hasher{
-		cost: cost,
-	}
+// The supported algorithms.
+const (
+	AlgArgon2id = "argon2id"
+	AlgBcrypt   = "bcrypt"
+)
+
+// Hasher hashes the passwords with its algorithm and parameters. Hashes of
+// any supported algorithm are verified, NeedsRehash tells the hashes to be
+// replaced once the password is known.
+type Hasher interface {
+	Encrypt(password string) (string, error)
+	Compare(encryptedPassword, password string) bool
+	NeedsRehash(encryptedPassword string) bool
 }
 
-func (h *Hasher) Encrypt(password string) (string, error) {
-	b, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
-	if err != nil {
-		return "", err
+// Compare verifies the password against a hash of any supported algorithm.
+func Compare(encryptedPassword, password string) bool {
+	switch algorithm(encryptedPassword) {
+	case AlgArgon2id:
+		return compareArgon2id(encryptedPassword, password)
+	case AlgBcrypt:
+		return compareBcrypt(encryptedPassword, password)
+	default:
+		return false
 	}
-
-	return string(b), nil
 }
 
-func (h *Hasher) Compare(encryptedPassword, password string) bool {
-	return bcrypt.CompareHashAndPassword([]byte(encryptedPassword), []byte(password)) == nil
+// algorithm returns the algorithm of the hash, empty if it is unknown.
+func algorithm(encryptedPassword string) string {
+	switch {
+	case strings.HasPrefix(encryptedPassword, "$argon2id$"):
+		return AlgArgon2id
+	case
+		strings.HasPrefix(encryptedPassword, "$2a$"),
+		strings.HasPrefix(encryptedPassword, "$2b$"),
+		strings.HasPrefix(encryptedPassword, "$2y$"):
+		return AlgBcrypt
+	default:
+		return ""
+	}
 }
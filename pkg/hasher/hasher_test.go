@@ -0,0 +1,78 @@
+package hasher
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	argon2Hash, err := NewArgon2id(testArgon2Params).Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	bcryptHash, err := NewBcrypt(testBcryptCost).Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		hash      string
+		password  string
+		algorithm string
+		want      bool
+	}{
+		{name: "argon2id", hash: argon2Hash, password: "password", algorithm: AlgArgon2id, want: true},
+		{name: "argon2id wrong password", hash: argon2Hash, password: "passwort", algorithm: AlgArgon2id, want: false},
+		{name: "bcrypt", hash: bcryptHash, password: "password", algorithm: AlgBcrypt, want: true},
+		{name: "bcrypt wrong password", hash: bcryptHash, password: "passwort", algorithm: AlgBcrypt, want: false},
+		{name: "bcrypt 2b", hash: "$2b$" + strings.TrimPrefix(bcryptHash, "$2a$"), password: "password", algorithm: AlgBcrypt, want: true},
+		{name: "bcrypt 2y", hash: "$2y$" + strings.TrimPrefix(bcryptHash, "$2a$"), password: "password", algorithm: AlgBcrypt, want: true},
+		{name: "unknown bcrypt version", hash: "$2x$" + strings.TrimPrefix(bcryptHash, "$2a$"), password: "password", algorithm: "", want: false},
+		{name: "plain text", hash: "password", password: "password", algorithm: "", want: false},
+		{name: "empty", hash: "", password: "", algorithm: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := algorithm(tt.hash); got != tt.algorithm {
+				t.Errorf("algorithm(%q) = %q, want %q", tt.hash, got, tt.algorithm)
+			}
+			if got := Compare(tt.hash, tt.password); got != tt.want {
+				t.Errorf("Compare(%q, %q) = %v, want %v", tt.hash, tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRehash follows a login after the algorithm changed from bcrypt to
+// argon2id: the old hash is verified, reported and replaced.
+func TestRehash(t *testing.T) {
+	var h Hasher = NewArgon2id(testArgon2Params)
+
+	old, err := NewBcrypt(testBcryptCost).Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	if !h.Compare(old, "password") {
+		t.Fatalf("Compare = false for the bcrypt hash")
+	}
+	if !h.NeedsRehash(old) {
+		t.Fatalf("NeedsRehash = false for the bcrypt hash")
+	}
+
+	hash, err := h.Encrypt("password")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if algorithm(hash) != AlgArgon2id {
+		t.Errorf("Encrypt = %q, not an argon2id hash", hash)
+	}
+	if !h.Compare(hash, "password") {
+		t.Errorf("Compare = false for the new hash")
+	}
+	if h.NeedsRehash(hash) {
+		t.Errorf("NeedsRehash = true for the new hash")
+	}
+}
@@ -0,0 +1,266 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// rsaBits is the size of the generated RSA keys.
+const rsaBits = 2048
+
+var (
+	ErrBadKey     = errors.New("bad key")
+	ErrBadAlg     = errors.New("unsupported algorithm")
+	ErrUnknownKey = errors.New("unknown key")
+)
+
+// Key is a signing key identified by ID, the kid header of the tokens it
+// signs. Created tells the keys of a rotation apart.
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Created time.Time
+
+	private interface{}
+	public  interface{}
+}
+
+// NewHMACKey returns the HS256 key of the secret. HMAC keys have no id and
+// are never published.
+func NewHMACKey(secret string) (*Key, error) {
+	if secret == "" {
+		return nil, ErrEmptySigningKey
+	}
+
+	return &Key{
+		Method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}, nil
+}
+
+// ParseKey parses a PEM encoded RSA (PKCS #1 or PKCS #8) or Ed25519
+// (PKCS #8) private key. The algorithm follows from the type of the key.
+func ParseKey(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrBadKey
+	}
+
+	var private interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		rsaKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, ErrBadKey
+		}
+		private = rsaKey
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, ErrBadKey
+		}
+		private = key
+	default:
+		return nil, ErrBadKey
+	}
+
+	return newKey(id, private)
+}
+
+// GenerateKey generates a key of the algorithm, AlgRS256 or AlgEdDSA.
+func GenerateKey(id, alg string) (*Key, error) {
+	var private interface{}
+	switch alg {
+	case AlgRS256:
+		rsaKey, err := rsa.GenerateKey(rand.Reader, rsaBits)
+		if err != nil {
+			return nil, err
+		}
+		private = rsaKey
+	case AlgEdDSA:
+		_, edKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = edKey
+	default:
+		return nil, ErrBadAlg
+	}
+
+	key, err := newKey(id, private)
+	if err != nil {
+		return nil, err
+	}
+	key.Created = time.Now()
+
+	return key, nil
+}
+
+func newKey(id string, private interface{}) (*Key, error) {
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		return &Key{
+			ID:      id,
+			Method:  jwt.SigningMethodRS256,
+			private: k,
+			public:  &k.PublicKey,
+		}, nil
+	case ed25519.PrivateKey:
+		return &Key{
+			ID:      id,
+			Method:  jwt.SigningMethodEdDSA,
+			private: k,
+			public:  k.Public(),
+		}, nil
+	default:
+		return nil, ErrBadAlg
+	}
+}
+
+// Encode returns the private key in the PEM encoded PKCS #8 form.
+func (k *Key) Encode() ([]byte, error) {
+	b, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  "PRIVATE KEY",
+		Bytes: b,
+	}), nil
+}
+
+// Sign returns the token of the claims signed with the key, the key id is
+// set as the kid header.
+func (k *Key) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.Method, claims)
+	if k.ID != "" {
+		token.Header["kid"] = k.ID
+	}
+
+	return token.SignedString(k.private)
+}
+
+// JWK is the public part of a key in the JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicKey returns the public key of the JWK: *rsa.PublicKey,
+// *ecdsa.PublicKey or ed25519.PublicKey.
+func (k JWK) PublicKey() (interface{}, error) {
+	enc := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err := enc.DecodeString(k.N)
+		if err != nil {
+			return nil, ErrBadKey
+		}
+		e, err := enc.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, ErrBadKey
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, ErrBadKey
+		}
+		x, err := enc.DecodeString(k.X)
+		if err != nil {
+			return nil, ErrBadKey
+		}
+		y, err := enc.DecodeString(k.Y)
+		if err != nil {
+			return nil, ErrBadKey
+		}
+
+		public := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(public.X, public.Y) {
+			return nil, ErrBadKey
+		}
+		return public, nil
+	case "OKP":
+		x, err := enc.DecodeString(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, ErrBadKey
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, ErrBadKey
+	}
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public key, false for the secret HMAC keys.
+func (k *Key) JWK() (JWK, bool) {
+	enc := base64.RawURLEncoding
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Use: "sig",
+			Alg: AlgRS256,
+			Kid: k.ID,
+			N:   enc.EncodeToString(public.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Use: "sig",
+			Alg: AlgEdDSA,
+			Kid: k.ID,
+			Crv: "Ed25519",
+			X:   enc.EncodeToString(public),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
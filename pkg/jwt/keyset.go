@@ -0,0 +1,311 @@
+package jwt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoKeys = errors.New("no keys")
+
+// KeySet holds the keys of a TokenManager: the current key signs the tokens,
+// every key of the set verifies them.
+type KeySet interface {
+	Current() (*Key, error)
+	Get(id string) (*Key, error)
+	Keys() []*Key
+}
+
+// StaticKeys is a fixed set of keys, the first one signs.
+type StaticKeys struct {
+	keys []*Key
+}
+
+func NewStaticKeys(keys ...*Key) (*StaticKeys, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	return &StaticKeys{
+		keys: keys,
+	}, nil
+}
+
+func (s *StaticKeys) Current() (*Key, error) {
+	return s.keys[0], nil
+}
+
+func (s *StaticKeys) Get(id string) (*Key, error) {
+	for _, key := range s.keys {
+		if key.ID == id {
+			return key, nil
+		}
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (s *StaticKeys) Keys() []*Key {
+	return s.keys
+}
+
+// keyExt is the extension of the key files.
+const keyExt = ".pem"
+
+// reloadInterval limits the reloads of the directory caused by tokens of
+// unknown keys.
+const reloadInterval = 10 * time.Second
+
+// DirKeys are the private keys stored in a directory, one PEM file per key
+// named after the key id. The newest key signs. The directory may be shared
+// by several instances: a key generated by one instance is loaded by the
+// others when they meet its first token.
+//
+// Keys are rotated: every rotation interval a new key of the algorithm is
+// generated, the previous keys stay until the tokens they signed expire.
+type DirKeys struct {
+	dir      string
+	alg      string
+	rotation time.Duration
+	tokenTTL time.Duration
+
+	mu     sync.RWMutex
+	keys   []*Key
+	loaded time.Time
+
+	done chan struct{}
+}
+
+// NewDirKeys loads the keys of the directory, a key is generated if there is
+// none. Zero rotation disables the rotation.
+func NewDirKeys(dir, alg string, rotation, tokenTTL time.Duration) (*DirKeys, error) {
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, ErrBadAlg
+	}
+
+	d := &DirKeys{
+		dir:      dir,
+		alg:      alg,
+		rotation: rotation,
+		tokenTTL: tokenTTL,
+		done:     make(chan struct{}),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	if len(d.keys) == 0 {
+		if err := d.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// load reads the keys of the directory, the oldest first.
+func (d *DirKeys) load() error {
+	paths, err := filepath.Glob(filepath.Join(d.dir, "*"+keyExt))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*Key, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		key, err := ParseKey(strings.TrimSuffix(filepath.Base(path), keyExt), data)
+		if err != nil {
+			return err
+		}
+		key.Created = info.ModTime()
+
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Created.Equal(keys[j].Created) {
+			return keys[i].ID < keys[j].ID
+		}
+		return keys[i].Created.Before(keys[j].Created)
+	})
+
+	d.mu.Lock()
+	d.keys = keys
+	d.loaded = time.Now()
+	d.mu.Unlock()
+
+	return nil
+}
+
+func (d *DirKeys) Current() (*Key, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if len(d.keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	return d.keys[len(d.keys)-1], nil
+}
+
+// Get returns the key, the directory is reloaded for unknown keys.
+func (d *DirKeys) Get(id string) (*Key, error) {
+	if key := d.get(id); key != nil {
+		return key, nil
+	}
+
+	d.mu.RLock()
+	loaded := d.loaded
+	d.mu.RUnlock()
+	if time.Since(loaded) < reloadInterval {
+		return nil, ErrUnknownKey
+	}
+
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	if key := d.get(id); key != nil {
+		return key, nil
+	}
+
+	return nil, ErrUnknownKey
+}
+
+func (d *DirKeys) get(id string) *Key {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, key := range d.keys {
+		if key.ID == id {
+			return key
+		}
+	}
+
+	return nil
+}
+
+func (d *DirKeys) Keys() []*Key {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.keys
+}
+
+// Rotate generates a new signing key and removes the keys no longer needed
+// to verify tokens.
+func (d *DirKeys) Rotate() error {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	id := time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(b)
+
+	key, err := GenerateKey(id, d.alg)
+	if err != nil {
+		return err
+	}
+	data, err := key.Encode()
+	if err != nil {
+		return err
+	}
+
+	// the key is renamed into place, so that the other instances never read
+	// a partially written file
+	path := filepath.Join(d.dir, id+keyExt)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	if err := d.load(); err != nil {
+		return err
+	}
+
+	return d.removeRetired()
+}
+
+// removeRetired removes the keys replaced longer than the token lifetime
+// ago, all the tokens they signed have expired.
+func (d *DirKeys) removeRetired() error {
+	d.mu.RLock()
+	keys := d.keys
+	d.mu.RUnlock()
+
+	removed := false
+	for i := 0; i < len(keys)-1; i++ {
+		if time.Since(keys[i+1].Created) <= d.tokenTTL {
+			continue
+		}
+
+		err := os.Remove(filepath.Join(d.dir, keys[i].ID+keyExt))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		removed = true
+	}
+
+	if !removed {
+		return nil
+	}
+
+	return d.load()
+}
+
+// rotateIfDue rotates the keys once the current key is older than the
+// rotation interval, otherwise the keys generated by the other instances are
+// loaded.
+func (d *DirKeys) rotateIfDue() error {
+	if err := d.load(); err != nil {
+		return err
+	}
+
+	current, err := d.Current()
+	if err != nil || time.Since(current.Created) >= d.rotation {
+		return d.Rotate()
+	}
+
+	return d.removeRetired()
+}
+
+// Start checks the keys periodically and rotates them when the time comes.
+// Errors are sent to notify, the checks go on.
+func (d *DirKeys) Start(period time.Duration, notify func(error)) {
+	if d.rotation <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := d.rotateIfDue(); err != nil {
+					notify(err)
+				}
+			case <-d.done:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the periodic checks.
+func (d *DirKeys) Stop() {
+	close(d.done)
+}
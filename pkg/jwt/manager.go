@@ -14,8 +14,8 @@ var (
 )
 
 type TokenManager struct {
-	signingKey []byte
-	tokenTTL   time.Duration
+	keys     KeySet
+	tokenTTL time.Duration
 }
 
 type customClaims struct {
@@ -23,28 +23,29 @@ type customClaims struct {
 	User interface{} `json:"user"`
 }
 
-func NewTokenManager(signingKey string, tokenTTL time.Duration) (*TokenManager, error) {
-	if signingKey == "" {
-		return nil, ErrEmptySigningKey
+func NewTokenManager(keys KeySet, tokenTTL time.Duration) *TokenManager {
+	return &TokenManager{
+		keys:     keys,
+		tokenTTL: tokenTTL,
 	}
+}
 
-	tm := &TokenManager{
-		signingKey: []byte(signingKey),
-		tokenTTL:   tokenTTL,
+// Create issues a token carrying the user. The id (the jti claim) tells the
+// tokens apart, so that they can be revoked.
+func (m *TokenManager) Create(id string, user interface{}) (string, error) {
+	key, err := m.keys.Current()
+	if err != nil {
+		return "", ErrInternalError
 	}
-	return tm, nil
-}
 
-func (m *TokenManager) Create(user interface{}) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, customClaims{
+	tokenString, err := key.Sign(customClaims{
 		StandardClaims: jwt.StandardClaims{
+			Id:        id,
 			IssuedAt:  time.Now().Unix(),
 			ExpiresAt: time.Now().Add(m.tokenTTL).Unix(),
 		},
 		User: user,
 	})
-
-	tokenString, err := token.SignedString(m.signingKey)
 	if err != nil {
 		return "", ErrInternalError
 	}
@@ -52,20 +53,42 @@ func (m *TokenManager) Create(user interface{}) (string, error) {
 	return tokenString, nil
 }
 
-func (m *TokenManager) Check(tokenString string) (interface{}, error) {
+// Check returns the id and the user of a valid token. The token is verified
+// with the key of its kid header, which has to be of the token algorithm.
+func (m *TokenManager) Check(tokenString string) (string, interface{}, error) {
 	signingKeyGetter := func(token *jwt.Token) (interface{}, error) {
-		if method, ok := token.Method.(*jwt.SigningMethodHMAC); !ok || method.Alg() != "HS256" {
+		id, _ := token.Header["kid"].(string)
+		key, err := m.keys.Get(id)
+		if err != nil {
+			return nil, err
+		}
+
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, ErrBadSigningMethod
 		}
 
-		return m.signingKey, nil
+		return key.public, nil
 	}
 
 	claims := &customClaims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, signingKeyGetter)
 	if err != nil || !token.Valid {
-		return nil, ErrBadToken
+		return "", nil, ErrBadToken
+	}
+
+	return claims.Id, claims.User, nil
+}
+
+// JWKS returns the public keys verifying the tokens.
+func (m *TokenManager) JWKS() JWKS {
+	keys := JWKS{
+		Keys: make([]JWK, 0),
+	}
+	for _, key := range m.keys.Keys() {
+		if jwk, ok := key.JWK(); ok {
+			keys.Keys = append(keys.Keys, jwk)
+		}
 	}
 
-	return claims.User, nil
+	return keys
 }
@@ -0,0 +1,42 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes the messages to a directory, one .eml file per message,
+// for development. The files open in the mail clients.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	data, err := msg.Bytes(m.from)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	name := time.Now().UTC().Format("20060102T150405.000000") + "-" + hex.EncodeToString(b) + ".eml"
+
+	return os.WriteFile(filepath.Join(m.dir, name), data, 0600)
+}
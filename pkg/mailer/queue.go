@@ -0,0 +1,58 @@
+package mailer
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrQueueFull = errors.New("mail queue full")
+
+// Queue sends the messages through the mailer in the background, so that
+// the senders do not wait for the delivery and the time of a request does
+// not tell whether a message was sent.
+type Queue struct {
+	mailer   Mailer
+	messages chan Message
+
+	wg sync.WaitGroup
+}
+
+// NewQueue returns a queue holding up to size messages, the messages over
+// it are refused.
+func NewQueue(mailer Mailer, size int) *Queue {
+	return &Queue{
+		mailer:   mailer,
+		messages: make(chan Message, size),
+	}
+}
+
+// Send queues the message.
+func (q *Queue) Send(msg Message) error {
+	select {
+	case q.messages <- msg:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Start sends the queued messages until Stop, the delivery errors are
+// passed to notify.
+func (q *Queue) Start(notify func(error)) {
+	q.wg.Add(1)
+	go func() {
+		defer q.wg.Done()
+
+		for msg := range q.messages {
+			if err := q.mailer.Send(msg); err != nil {
+				notify(err)
+			}
+		}
+	}()
+}
+
+// Stop sends the messages left and stops, nothing may be queued after it.
+func (q *Queue) Stop() {
+	close(q.messages)
+	q.wg.Wait()
+}
@@ -0,0 +1,116 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+var ErrUnknownTemplate = errors.New("unknown template")
+
+// Templates render the messages. A message named name is made of the
+// templates name.txt, the plain text body with the subject defined as
+// "subject", and name.html, the optional HTML body.
+type Templates struct {
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// NewTemplates parses the templates of the directory of fsys.
+func NewTemplates(fsys fs.FS, dir string) (*Templates, error) {
+	t := &Templates{
+		text: make(map[string]*texttemplate.Template),
+		html: make(map[string]*htmltemplate.Template),
+	}
+
+	paths, err := fs.Glob(fsys, path.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		tmpl, err := texttemplate.ParseFS(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+		if tmpl.Lookup("subject") == nil {
+			return nil, fmt.Errorf("%s: no subject", p)
+		}
+
+		t.text[templateName(p)] = tmpl
+	}
+
+	paths, err = fs.Glob(fsys, path.Join(dir, "*.html"))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range paths {
+		name := templateName(p)
+		if _, ok := t.text[name]; !ok {
+			return nil, fmt.Errorf("%s: no %s.txt", p, name)
+		}
+
+		tmpl, err := htmltemplate.ParseFS(fsys, p)
+		if err != nil {
+			return nil, err
+		}
+
+		t.html[name] = tmpl
+	}
+
+	return t, nil
+}
+
+// templateName returns the name of the message of the template file.
+func templateName(p string) string {
+	return strings.TrimSuffix(path.Base(p), path.Ext(p))
+}
+
+// MustTemplates is NewTemplates panicking on errors, for the templates
+// embedded in the binary.
+func MustTemplates(fsys fs.FS, dir string) *Templates {
+	t, err := NewTemplates(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// Render returns the message to the address made of the named templates
+// filled with the data.
+func (t *Templates) Render(name, to string, data interface{}) (Message, error) {
+	text, ok := t.text[name]
+	if !ok {
+		return Message{}, fmt.Errorf("%s: %w", name, ErrUnknownTemplate)
+	}
+
+	subject := new(bytes.Buffer)
+	if err := text.ExecuteTemplate(subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	body := new(bytes.Buffer)
+	if err := text.Execute(body, data); err != nil {
+		return Message{}, err
+	}
+
+	msg := Message{
+		To:      to,
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimLeft(body.String(), "\n"),
+	}
+
+	if html, ok := t.html[name]; ok {
+		body.Reset()
+		if err := html.Execute(body, data); err != nil {
+			return Message{}, err
+		}
+		msg.HTML = body.String()
+	}
+
+	return msg, nil
+}
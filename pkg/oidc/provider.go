@@ -0,0 +1,343 @@
+// Package oidc logs the users in with OpenID Connect providers: the
+// authorization code flow with PKCE (RFC 7636), the ID tokens are verified
+// with the keys the provider publishes.
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	golangjwt "github.com/golang-jwt/jwt"
+	"github.com/s02190058/spa/pkg/jwt"
+)
+
+var (
+	ErrDiscovery  = errors.New("discovery failed")
+	ErrExchange   = errors.New("code exchange failed")
+	ErrBadIDToken = errors.New("bad id token")
+)
+
+const (
+	// timeout limits the requests to the provider.
+	timeout = 10 * time.Second
+	// reloadInterval limits the reloads of the keys on unknown key ids.
+	reloadInterval = 10 * time.Second
+	// leeway is the clock skew tolerated in the ID tokens.
+	leeway = time.Minute
+	// maxResponse limits the size of the responses of the provider.
+	maxResponse = 1 << 20
+)
+
+// algorithms are the accepted signing algorithms of the ID tokens, never
+// none nor the HMAC ones, whose keys are not public.
+var algorithms = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// Config is the registration of the application with a provider. Issuer is
+// the URL the provider metadata is discovered from, the openid scope is
+// always requested.
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// Claims identify the user of an ID token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+}
+
+// metadata is the part of the provider metadata the flow needs.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect provider. The metadata is discovered on the
+// first use, the keys are reloaded when a token is signed with an unknown
+// one.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu     sync.Mutex
+	meta   *metadata
+	keys   map[string]interface{}
+	loaded time.Time
+}
+
+func NewProvider(cfg Config) *Provider {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+
+	return &Provider{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout: timeout,
+		},
+	}
+}
+
+// AuthCodeURL returns the URL the user is sent to for the login. The
+// provider redirects back to redirectURI with the code and the state, the
+// nonce comes back in the ID token and challenge is the PKCE challenge of
+// the verifier the code is exchanged with.
+func (p *Provider) AuthCodeURL(redirectURI, state, nonce, challenge string) (string, error) {
+	meta, err := p.discover()
+	if err != nil {
+		return "", err
+	}
+
+	scopes := []string{"openid"}
+	for _, scope := range p.cfg.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + params.Encode(), nil
+}
+
+// Exchange exchanges the code for the ID token and returns its claims once
+// the token is verified.
+func (p *Provider) Exchange(redirectURI, code, verifier, nonce string) (*Claims, error) {
+	meta, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic, the credentials are form encoded first
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	status, err := p.do(req, &tokens)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchange, tokens.Error, tokens.ErrorDescription)
+	}
+	if status != http.StatusOK || tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: status %d", ErrExchange, status)
+	}
+
+	return p.verify(meta, tokens.IDToken, nonce)
+}
+
+// verify checks the signature, the issuer, the audience, the lifetime and
+// the nonce of the ID token.
+func (p *Provider) verify(meta *metadata, idToken, nonce string) (*Claims, error) {
+	parser := &golangjwt.Parser{
+		ValidMethods:         algorithms,
+		SkipClaimsValidation: true,
+	}
+	claims := golangjwt.MapClaims{}
+	_, err := parser.ParseWithClaims(idToken, claims, func(token *golangjwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(meta, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadIDToken, err)
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyIssuer(meta.Issuer, true):
+		return nil, fmt.Errorf("%w: issuer", ErrBadIDToken)
+	case !claims.VerifyAudience(p.cfg.ClientID, true):
+		return nil, fmt.Errorf("%w: audience", ErrBadIDToken)
+	case !claims.VerifyExpiresAt(now.Add(-leeway).Unix(), true):
+		return nil, fmt.Errorf("%w: expired", ErrBadIDToken)
+	case !claims.VerifyIssuedAt(now.Add(leeway).Unix(), false):
+		return nil, fmt.Errorf("%w: issued in the future", ErrBadIDToken)
+	}
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: authorized party", ErrBadIDToken)
+	}
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, fmt.Errorf("%w: nonce", ErrBadIDToken)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: subject", ErrBadIDToken)
+	}
+
+	result := &Claims{
+		Subject: subject,
+	}
+	result.Email, _ = claims["email"].(string)
+	result.Username, _ = claims["preferred_username"].(string)
+	result.Name, _ = claims["name"].(string)
+	// some providers send the flag as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+
+	return result, nil
+}
+
+// discover returns the metadata of the provider, fetched once. The issuer of
+// the metadata must be the configured one.
+func (p *Provider) discover() (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.meta != nil {
+		return p.meta, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	meta := new(metadata)
+	status, err := p.do(req, meta)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	switch {
+	case status != http.StatusOK:
+		return nil, fmt.Errorf("%w: status %d", ErrDiscovery, status)
+	case strings.TrimSuffix(meta.Issuer, "/") != p.cfg.Issuer:
+		return nil, fmt.Errorf("%w: issuer %q", ErrDiscovery, meta.Issuer)
+	case meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "":
+		return nil, fmt.Errorf("%w: missing endpoints", ErrDiscovery)
+	}
+
+	p.meta = meta
+	return meta, nil
+}
+
+// key returns the public key of the id, the keys are reloaded if it is
+// unknown and they were not loaded recently. A token without a kid takes
+// the only key.
+func (p *Provider) key(meta *metadata, kid string) (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.loaded) < reloadInterval {
+		return nil, jwt.ErrUnknownKey
+	}
+
+	req, err := http.NewRequest(http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwt.JWKS
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("keys: status %d", status)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		// the unsupported keys are skipped, not the whole set
+		if key, err := jwk.PublicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	p.keys = keys
+	p.loaded = time.Now()
+
+	if key := p.findKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, jwt.ErrUnknownKey
+}
+
+func (p *Provider) findKey(kid string) interface{} {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+
+	return p.keys[kid]
+}
+
+// do sends the request and decodes the JSON response into v, whatever the
+// status, the error responses of the token endpoint are JSON too.
+func (p *Provider) do(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponse)).Decode(v); err != nil && resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, err
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,91 @@
+// Package ratelimit limits the rate of the requests of each client.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket holds the tokens of a key at the time of the last update.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Limiter allows a number of requests per period for each key: the requests
+// take tokens of a bucket of that size, refilled evenly over the period.
+type Limiter struct {
+	size   float64
+	period time.Duration
+	// rate is the number of tokens refilled per second
+	rate float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+// New returns a limiter of the requests per period, nil if requests is not
+// positive. A nil limiter allows everything.
+func New(requests int, period time.Duration) *Limiter {
+	if requests <= 0 || period <= 0 {
+		return nil
+	}
+
+	return &Limiter{
+		size:    float64(requests),
+		period:  period,
+		rate:    float64(requests) / period.Seconds(),
+		buckets: make(map[string]*bucket),
+		swept:   time.Now(),
+	}
+}
+
+// Allow takes a token of the key. Otherwise the time until the next token is
+// returned.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens: l.size,
+		}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(l.size, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets the keys whose buckets are full again, once per period.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < l.period {
+		return
+	}
+
+	for key, b := range l.buckets {
+		if now.Sub(b.updated) >= l.period {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
@@ -0,0 +1,371 @@
+// Package strength estimates the strength of the passwords. The entropy of a
+// password is the number of bits an attacker has to guess, one trying the
+// patterns people use: common words and passwords, names of the user,
+// repeats, sequences, keyboard walks and years. The rest of the password is
+// counted as random characters.
+package strength
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The scores of the passwords, a password of a score takes at least the
+// entropy of it.
+const (
+	ScoreVeryWeak = iota
+	ScoreWeak
+	ScoreFair
+	ScoreStrong
+	ScoreVeryStrong
+)
+
+// scoreEntropy is the entropy in bits of the scores from ScoreWeak.
+var scoreEntropy = []float64{20, 30, 40, 55}
+
+// The kinds of the patterns.
+const (
+	kindWord = iota
+	kindInput
+	kindRepeat
+	kindSequence
+	kindKeyboard
+	kindYear
+	kindRandom
+)
+
+// feedback explains the weakness of a pattern.
+var feedback = map[int]string{
+	kindWord:     "contains a common word or password",
+	kindInput:    "contains the username",
+	kindRepeat:   "contains repeated characters like aaa",
+	kindSequence: "contains a sequence like abc or 123",
+	kindKeyboard: "contains a keyboard pattern like qwerty",
+	kindYear:     "contains a year",
+}
+
+// Result is the estimation of a password. Feedback explains the weak points
+// of a weak password.
+type Result struct {
+	Entropy  float64
+	Score    int
+	Feedback []string
+}
+
+//go:embed words.txt
+var wordList string
+
+// words ranks the common words and passwords, the most common first.
+var words = rankWords(wordList)
+
+func rankWords(list string) map[string]int {
+	ranks := make(map[string]int)
+	for i, word := range strings.Fields(list) {
+		if _, ok := ranks[word]; !ok {
+			ranks[word] = i + 1
+		}
+	}
+
+	return ranks
+}
+
+// maxWordLength is the length in characters of the longest of the words,
+// no longer part of a password is looked up.
+var maxWordLength = longestWord(words)
+
+func longestWord(ranks map[string]int) int {
+	longest := 0
+	for word := range ranks {
+		if n := utf8.RuneCountInString(word); n > longest {
+			longest = n
+		}
+	}
+
+	return longest
+}
+
+// leet undoes the common substitutions of letters.
+var leet = strings.NewReplacer(
+	"4", "a", "@", "a", "3", "e", "1", "i", "!", "i",
+	"0", "o", "$", "s", "5", "s", "7", "t", "+", "t",
+)
+
+var keyboardRows = []string{
+	"`1234567890-=",
+	"qwertyuiop[]\\",
+	"asdfghjkl;'",
+	"zxcvbnm,./",
+}
+
+// match is a pattern found in the password.
+type match struct {
+	kind    int
+	length  int
+	entropy float64
+}
+
+// Estimate returns the estimation of the password. The inputs, such as the
+// username, are easily guessed by an attacker knowing the user.
+func Estimate(password string, inputs ...string) Result {
+	chars := []rune(password)
+	lower := []rune(strings.ToLower(password))
+	unleet := []rune(leet.Replace(strings.ToLower(password)))
+	if len(unleet) != len(lower) {
+		unleet = lower
+	}
+	charset := charsetSize(chars)
+
+	var entropy float64
+	kinds := make(map[int]bool)
+	for i := 0; i < len(chars); {
+		m := match{
+			kind:    kindRandom,
+			length:  1,
+			entropy: math.Log2(charset),
+		}
+		for _, c := range []match{
+			matchWord(chars, lower, unleet, i, inputs),
+			matchRepeat(lower, i),
+			matchSequence(lower, i),
+			matchKeyboard(lower, i),
+			matchYear(lower, i),
+		} {
+			if c.length > m.length || c.length == m.length && c.length > 1 && c.entropy < m.entropy {
+				m = c
+			}
+		}
+
+		entropy += m.entropy
+		kinds[m.kind] = true
+		i += m.length
+	}
+
+	score := ScoreVeryWeak
+	for score < ScoreVeryStrong && entropy >= scoreEntropy[score] {
+		score++
+	}
+
+	res := Result{
+		Entropy: entropy,
+		Score:   score,
+	}
+	if score >= ScoreStrong {
+		return res
+	}
+
+	for kind := kindWord; kind <= kindYear; kind++ {
+		if kinds[kind] {
+			res.Feedback = append(res.Feedback, feedback[kind])
+		}
+	}
+	res.Feedback = append(res.Feedback, "add more words or characters of other kinds")
+
+	return res
+}
+
+// charsetSize returns the number of the characters of the kinds the password
+// is made of.
+func charsetSize(chars []rune) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, c := range chars {
+		switch {
+		case c >= 'a' && c <= 'z':
+			lower = true
+		case c >= 'A' && c <= 'Z':
+			upper = true
+		case c >= '0' && c <= '9':
+			digit = true
+		case c < unicode.MaxASCII && unicode.IsPrint(c):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	var size float64
+	for _, kind := range []struct {
+		used bool
+		size float64
+	}{
+		{lower, 26},
+		{upper, 26},
+		{digit, 10},
+		{symbol, 33},
+		{other, 100},
+	} {
+		if kind.used {
+			size += kind.size
+		}
+	}
+	if size == 0 {
+		size = 1
+	}
+
+	return size
+}
+
+// charSize returns the number of the characters of the kind of c.
+func charSize(c rune) float64 {
+	return charsetSize([]rune{c})
+}
+
+// matchWord finds the longest common word or input at i. Capitals and
+// substitutions add a bit each.
+func matchWord(chars, lower, unleet []rune, i int, inputs []string) match {
+	longest := maxWordLength
+	for _, input := range inputs {
+		if n := utf8.RuneCountInString(input); n > longest {
+			longest = n
+		}
+	}
+
+	end := len(chars)
+	if i+longest < end {
+		end = i + longest
+	}
+
+	for j := end; j >= i+3; j-- {
+		word := string(unleet[i:j])
+		rank, ok := words[word]
+		kind := kindWord
+		if !ok {
+			word = string(lower[i:j])
+			rank, ok = words[word]
+		}
+		if !ok {
+			for _, input := range inputs {
+				input = strings.ToLower(input)
+				if len(input) >= 3 && (word == input || string(unleet[i:j]) == input) {
+					rank, ok, kind = 1, true, kindInput
+					break
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+
+		entropy := math.Log2(float64(rank) + 1)
+		if string(chars[i:j]) != string(lower[i:j]) {
+			entropy++
+		}
+		if string(unleet[i:j]) != string(lower[i:j]) {
+			entropy++
+		}
+
+		return match{
+			kind:    kind,
+			length:  j - i,
+			entropy: entropy,
+		}
+	}
+
+	return match{}
+}
+
+// matchRepeat finds a character repeated at least three times at i.
+func matchRepeat(lower []rune, i int) match {
+	j := i + 1
+	for j < len(lower) && lower[j] == lower[i] {
+		j++
+	}
+	if j-i < 3 {
+		return match{}
+	}
+
+	return match{
+		kind:    kindRepeat,
+		length:  j - i,
+		entropy: math.Log2(charSize(lower[i])) + math.Log2(float64(j-i)),
+	}
+}
+
+// matchSequence finds at least three consecutive characters at i, such as
+// abc or 321.
+func matchSequence(lower []rune, i int) match {
+	if i+1 >= len(lower) {
+		return match{}
+	}
+	step := lower[i+1] - lower[i]
+	if step != 1 && step != -1 {
+		return match{}
+	}
+
+	j := i + 1
+	for j < len(lower) && lower[j]-lower[j-1] == step {
+		j++
+	}
+	if j-i < 3 {
+		return match{}
+	}
+
+	entropy := math.Log2(charSize(lower[i])) + math.Log2(float64(j-i))
+	if step < 0 {
+		entropy++
+	}
+
+	return match{
+		kind:    kindSequence,
+		length:  j - i,
+		entropy: entropy,
+	}
+}
+
+// matchKeyboard finds at least three neighbouring keys of a row at i.
+func matchKeyboard(lower []rune, i int) match {
+	best := match{}
+	for _, row := range keyboardRows {
+		keys := []rune(row)
+		pos := func(c rune) int {
+			for k, key := range keys {
+				if key == c {
+					return k
+				}
+			}
+			return -1
+		}
+
+		j := i + 1
+		for j < len(lower) {
+			prev, cur := pos(lower[j-1]), pos(lower[j])
+			if prev < 0 || cur < 0 || cur-prev != 1 && prev-cur != 1 {
+				break
+			}
+			j++
+		}
+		if j-i >= 3 && j-i > best.length {
+			best = match{
+				kind:    kindKeyboard,
+				length:  j - i,
+				entropy: math.Log2(float64(len(keys))) + math.Log2(float64(j-i)),
+			}
+		}
+	}
+
+	return best
+}
+
+// matchYear finds a year from 1900 to 2099 at i.
+func matchYear(lower []rune, i int) match {
+	if i+4 > len(lower) {
+		return match{}
+	}
+	year := string(lower[i : i+4])
+	if !strings.HasPrefix(year, "19") && !strings.HasPrefix(year, "20") {
+		return match{}
+	}
+	for _, c := range year[2:] {
+		if c < '0' || c > '9' {
+			return match{}
+		}
+	}
+
+	return match{
+		kind:    kindYear,
+		length:  4,
+		entropy: math.Log2(200),
+	}
+}
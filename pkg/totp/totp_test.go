@@ -0,0 +1,135 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of RFC 6238, Appendix B: "12345678901234567890".
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// RFC 6238, Appendix B, SHA-1, the codes cut to 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestCodeBadSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err != ErrBadSecret {
+		t.Errorf("Code() error = %v, want %v", err, ErrBadSecret)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	code := func(step int64) string {
+		c, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatalf("Code(%d): %v", step, err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		skew     int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{
+			name:     "current step",
+			code:     code(step),
+			skew:     1,
+			wantStep: step,
+			wantOK:   true,
+		},
+		{
+			name:     "late within skew",
+			code:     code(step - 1),
+			skew:     1,
+			wantStep: step - 1,
+			wantOK:   true,
+		},
+		{
+			name:     "early within skew",
+			code:     code(step + 1),
+			skew:     1,
+			wantStep: step + 1,
+			wantOK:   true,
+		},
+		{
+			name: "late beyond skew",
+			code: code(step - 2),
+			skew: 1,
+		},
+		{
+			name: "late without skew",
+			code: code(step - 1),
+			skew: 0,
+		},
+		{
+			name: "wrong code",
+			code: "000000",
+			skew: 1,
+		},
+		{
+			name: "short code",
+			code: code(step)[:Digits-1],
+			skew: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotOK := Validate(rfcSecret, tt.code, now, tt.skew)
+			if gotOK != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("Validate(%q) = %d, %v, want %d, %v", tt.code, gotStep, gotOK, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
+
+// TestValidateReplay checks that a code accepted in the next step is matched
+// to the step it was issued for, which the callers remember to refuse it
+// again.
+func TestValidateReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+
+	first, ok := Validate(rfcSecret, code, now, 1)
+	if !ok {
+		t.Fatalf("Validate(%q) failed", code)
+	}
+	again, ok := Validate(rfcSecret, code, now.Add(Period), 1)
+	if !ok {
+		t.Fatalf("Validate(%q) failed a step later", code)
+	}
+	if first != again {
+		t.Errorf("Validate(%q) = step %d, then %d, want the same step", code, first, again)
+	}
+}
@@ -0,0 +1,186 @@
+// Keeps the session of the SPA alive with short-lived access tokens. The
+// bundle sends the token it got at login with every request; the requests to
+// the API are sent with the latest token instead, which is refreshed with the
+// refresh token when it is about to expire or gets rejected. The refresh
+// token is kept in localStorage next to the token and is revoked on logout.
+(function () {
+    "use strict";
+
+    var TOKEN = "token";
+    var REFRESH_TOKEN = "refresh_token";
+    // tokens this close to their expiry (in seconds) are refreshed before use
+    var LEEWAY = 30;
+
+    var send = window.fetch.bind(window);
+    var removeItem = Storage.prototype.removeItem;
+    var refreshing = null;
+
+    function isAPI(url) {
+        return typeof url === "string" && url.indexOf("/api/") === 0;
+    }
+
+    function bearer(init) {
+        var header = init && init.headers && init.headers.Authorization;
+        return header && header.indexOf("Bearer ") === 0 ? header.slice(7) : null;
+    }
+
+    function withToken(init, token) {
+        var copy = {};
+        var headers = {};
+        var name;
+        for (name in init) {
+            copy[name] = init[name];
+        }
+        for (name in init.headers) {
+            headers[name] = init.headers[name];
+        }
+        headers.Authorization = "Bearer " + token;
+        copy.headers = headers;
+        return copy;
+    }
+
+    function expiring(token) {
+        try {
+            var payload = token.split(".")[1].replace(/-/g, "+").replace(/_/g, "/");
+            var exp = JSON.parse(atob(payload)).exp;
+            return typeof exp === "number" && exp - LEEWAY < Date.now() / 1000;
+        } catch (e) {
+            return false;
+        }
+    }
+
+    // keepRefreshToken stores the refresh token of a login or a registration.
+    function keepRefreshToken(res) {
+        if (res.ok) {
+            res.clone().json().then(function (data) {
+                if (data && data.refresh_token) {
+                    localStorage.setItem(REFRESH_TOKEN, data.refresh_token);
+                }
+            }).catch(function () {});
+        }
+        return res;
+    }
+
+    function exchange(refreshToken) {
+        return send("/api/refresh", {
+            method: "POST",
+            headers: {"Content-Type": "application/json"},
+            body: JSON.stringify({refresh_token: refreshToken})
+        }).then(function (res) {
+            if (res.status === 401) {
+                return null;
+            }
+            if (!res.ok) {
+                throw new Error("refresh failed: " + res.status);
+            }
+            return res.json();
+        });
+    }
+
+    // renew returns the token to use instead of the stale one, null when the
+    // session is over. A refresh token is exchanged once, a second exchange
+    // ends the session, so another tab may have renewed the token already.
+    function renew(stale) {
+        var token = localStorage.getItem(TOKEN);
+        if (token && token !== stale) {
+            return Promise.resolve(token);
+        }
+        var refreshToken = localStorage.getItem(REFRESH_TOKEN);
+        if (!refreshToken) {
+            return Promise.resolve(null);
+        }
+
+        return exchange(refreshToken).then(function (tokens) {
+            if (!tokens) {
+                removeItem.call(localStorage, REFRESH_TOKEN);
+                removeItem.call(localStorage, TOKEN);
+                return null;
+            }
+            localStorage.setItem(TOKEN, tokens.token);
+            localStorage.setItem(REFRESH_TOKEN, tokens.refresh_token);
+            return tokens.token;
+        });
+    }
+
+    // refresh renews the token once for the concurrent requests of the tab
+    // and, where the browser supports it, one tab at a time.
+    function refresh(stale) {
+        if (!refreshing) {
+            var run = function () {
+                return renew(stale);
+            };
+            var done = function () {
+                refreshing = null;
+            };
+            refreshing = navigator.locks ? navigator.locks.request("spa-refresh", run) : run();
+            refreshing.then(done, done);
+        }
+        return refreshing;
+    }
+
+    window.fetch = function (input, init) {
+        if (!isAPI(input)) {
+            return send(input, init);
+        }
+        if (input === "/api/login" || input === "/api/register") {
+            return send(input, init).then(keepRefreshToken);
+        }
+
+        var token = bearer(init);
+        if (!token) {
+            return send(input, init);
+        }
+        token = localStorage.getItem(TOKEN) || token;
+
+        var ready = expiring(token) ? refresh(token).then(function (fresh) {
+            return fresh || token;
+        }, function () {
+            return token;
+        }) : Promise.resolve(token);
+
+        return ready.then(function (token) {
+            return send(input, withToken(init, token)).then(function (res) {
+                if (res.status !== 401) {
+                    return res;
+                }
+                return refresh(token).then(function (fresh) {
+                    return fresh ? send(input, withToken(init, fresh)) : res;
+                }, function () {
+                    return res;
+                });
+            });
+        });
+    };
+
+    // logout ends the session of the tokens, the access token may have
+    // expired already.
+    function logout(token, refreshToken) {
+        var end = function (token) {
+            return send("/api/logout", {
+                method: "POST",
+                headers: {Authorization: "Bearer " + token}
+            });
+        };
+
+        end(token).then(function (res) {
+            if (res.status === 401 && refreshToken) {
+                return exchange(refreshToken).then(function (tokens) {
+                    return tokens && end(tokens.token);
+                });
+            }
+        }).catch(function () {});
+    }
+
+    // the bundle removes the token on logout
+    Storage.prototype.removeItem = function (key) {
+        if (this === localStorage && key === TOKEN) {
+            var token = localStorage.getItem(TOKEN);
+            var refreshToken = localStorage.getItem(REFRESH_TOKEN);
+            removeItem.call(this, REFRESH_TOKEN);
+            if (token) {
+                logout(token, refreshToken);
+            }
+        }
+        return removeItem.call(this, key);
+    };
+})();